@@ -13,4 +13,5 @@ require (
 	github.com/stretchr/testify v1.5.1
 	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,283 @@
+package orm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// tagOrmEncrypt - value of field (string, []byte or orm_json) is stored encrypted by AES-GCM with key of key name:
+// `db:"token" orm_use_in:"select,create,update" orm_encrypt:"tokens"`. Keys are provided by KeyProvider
+// (see SetKeyProvider), encrypted fields are not used by GetDataForExample (ciphertexts are random).
+const tagOrmEncrypt = "orm_encrypt"
+
+// ciphertextVersion - first byte of ciphertext: version(1) | len(key id)(1) | key id | nonce | sealed value.
+const ciphertextVersion byte = 1
+
+var (
+	// ErrNoKeyProvider - KeyProvider is not set by SetKeyProvider.
+	ErrNoKeyProvider = errors.New("orm: key provider is not set")
+	// ErrUnknownKey - key provider has no key of key name (or key id).
+	ErrUnknownKey = errors.New("orm: unknown encryption key")
+	// ErrBadCiphertext - value can't be decrypted: it is not ciphertext of orm, or it is corrupted.
+	ErrBadCiphertext = errors.New("orm: bad ciphertext")
+
+	keyProviderMu sync.RWMutex
+	keyProvider   KeyProvider
+)
+
+type (
+	// KeyProvider - provider of keys (16, 24 or 32 bytes for AES-128, AES-192, AES-256) for encrypted fields.
+	// Id of key is stored in ciphertext, so keys are rotated by change of current key, previous keys are
+	// kept for decryption of old values.
+	KeyProvider interface {
+		// CurrentKey return key and its id for encryption of new values of key name.
+		CurrentKey(name string) (id string, key []byte, err error)
+		// Key return key of key name by id for decryption.
+		Key(name, id string) ([]byte, error)
+	}
+
+	// KeyRing - static KeyProvider: key name -> set of keys.
+	KeyRing map[string]KeySet
+
+	// KeySet - keys of key name by id, Current - id of key for encryption.
+	KeySet struct {
+		Current string
+		Keys    map[string][]byte
+	}
+
+	// Encrypted - argument of orm_encrypt field for create/update, it is encrypted by driver.Valuer.
+	// V is string, []byte or driver.Valuer (e.g. JSON) with such value, nil value is stored as NULL.
+	Encrypted struct {
+		V   interface{}
+		Key string // key name
+	}
+
+	// EncryptedScanner - sql.Scanner which decrypt column into Dest: sql.Scanner, *string, **string or *[]byte.
+	EncryptedScanner struct {
+		Dest interface{}
+		Key  string // key name
+	}
+)
+
+// SetKeyProvider set provider of keys for orm_encrypt fields.
+func SetKeyProvider(p KeyProvider) {
+	keyProviderMu.Lock()
+	defer keyProviderMu.Unlock()
+
+	keyProvider = p
+}
+
+func getKeyProvider() (KeyProvider, error) {
+	keyProviderMu.RLock()
+	defer keyProviderMu.RUnlock()
+
+	if keyProvider == nil {
+		return nil, ErrNoKeyProvider
+	}
+
+	return keyProvider, nil
+}
+
+// EncryptKeyName - return key name of orm_encrypt tag of field, empty if field is not encrypted.
+func EncryptKeyName(field reflect.StructField) string {
+	name := field.Tag.Get(tagOrmEncrypt)
+	if isTagEmpty(name) {
+		return ""
+	}
+
+	return name
+}
+
+func (r KeyRing) CurrentKey(name string) (string, []byte, error) {
+	set, found := r[name]
+	if !found {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+	}
+
+	key, err := r.Key(name, set.Current)
+
+	return set.Current, key, err
+}
+
+func (r KeyRing) Key(name, id string) ([]byte, error) {
+	key, found := r[name].Keys[id]
+	if !found {
+		return nil, fmt.Errorf("%w: %s (id %q)", ErrUnknownKey, name, id)
+	}
+
+	return key, nil
+}
+
+// Encrypt encrypt plaintext by current key of key name, return base64 ciphertext with id of key.
+// Key name is additional authenticated data, so value can't be decrypted with key of other name.
+func Encrypt(name string, plaintext []byte) (string, error) {
+	provider, err := getKeyProvider()
+	if err != nil {
+		return "", err
+	}
+
+	id, key, err := provider.CurrentKey(name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(id) > 255 {
+		return "", fmt.Errorf("orm: id of key %s is longer than 255 bytes", name)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, 0, 2+len(id)+gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	data = append(append(data, ciphertextVersion, byte(len(id))), id...)
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("orm: nonce: %w", err)
+	}
+
+	data = gcm.Seal(append(data, nonce...), nonce, plaintext, []byte(name))
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt decrypt ciphertext of Encrypt by key of key name with id from ciphertext.
+func Decrypt(name string, ciphertext string) ([]byte, error) {
+	id, data, err := parseCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := getKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := provider.Key(name, id)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrBadCiphertext
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadCiphertext, err)
+	}
+
+	return plaintext, nil
+}
+
+// CiphertextKeyID return id of key of ciphertext (e.g. to find values which must be re-encrypted after rotation).
+func CiphertextKeyID(ciphertext string) (string, error) {
+	id, _, err := parseCiphertext(ciphertext)
+	return id, err
+}
+
+func parseCiphertext(ciphertext string) (string, []byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < 2 || data[0] != ciphertextVersion || len(data) < 2+int(data[1]) {
+		return "", nil, ErrBadCiphertext
+	}
+
+	n := 2 + int(data[1])
+
+	return string(data[2:n]), data[n:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("orm: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Value - driver.Valuer.
+func (e Encrypted) Value() (driver.Value, error) {
+	v := e.V
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return nil, err
+		}
+		v = value
+	}
+
+	if isNilValue(v) {
+		return nil, nil
+	}
+
+	switch plaintext := v.(type) {
+	case string:
+		return Encrypt(e.Key, []byte(plaintext))
+	case []byte:
+		return Encrypt(e.Key, plaintext)
+	}
+
+	return nil, fmt.Errorf("orm: can't encrypt %T, only string and []byte are encrypted", v)
+}
+
+// Scan - sql.Scanner.
+func (e *EncryptedScanner) Scan(src interface{}) error {
+	var plaintext []byte
+
+	switch v := src.(type) {
+	case nil:
+	case string:
+		data, err := Decrypt(e.Key, v)
+		if err != nil {
+			return err
+		}
+		plaintext = data
+	case []byte:
+		data, err := Decrypt(e.Key, string(v))
+		if err != nil {
+			return err
+		}
+		plaintext = data
+	default:
+		return fmt.Errorf("orm: can't scan %T into encrypted field %T", src, e.Dest)
+	}
+
+	switch dest := e.Dest.(type) {
+	case sql.Scanner:
+		if src == nil {
+			return dest.Scan(nil)
+		}
+		return dest.Scan(plaintext)
+	case *string:
+		*dest = string(plaintext)
+	case **string:
+		*dest = nil
+		if src != nil {
+			s := string(plaintext)
+			*dest = &s
+		}
+	case *[]byte:
+		*dest = plaintext
+	default:
+		return fmt.Errorf("orm: can't decrypt into %T", e.Dest)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// tagOrmJSON - field (struct, map, slice) is stored in json/jsonb column: `db:"attrs" orm_json:"jsonb"`.
+const tagOrmJSON = "orm_json"
+
+type (
+	// JSON - argument of orm_json field for create/update, it is marshaled to JSON by driver.Valuer.
+	// Nil value (nil map, slice, pointer) is stored as NULL.
+	JSON struct {
+		V interface{}
+	}
+
+	// JSONScanner - sql.Scanner which unmarshal JSON column into Dest (pointer to field), NULL - zero value.
+	JSONScanner struct {
+		Dest interface{}
+	}
+)
+
+// IsJSONField - field has orm_json tag.
+func IsJSONField(field reflect.StructField) bool {
+	return !isTagEmpty(field.Tag.Get(tagOrmJSON))
+}
+
+// Value - driver.Valuer.
+func (j JSON) Value() (driver.Value, error) {
+	if isNilValue(j.V) {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, fmt.Errorf("orm: marshal json: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// Scan - sql.Scanner.
+func (j *JSONScanner) Scan(src interface{}) error {
+	dest := reflect.ValueOf(j.Dest)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("orm: json scanner destination must be not nil pointer, got %T", j.Dest)
+	}
+
+	var data []byte
+
+	switch v := src.(type) {
+	case nil:
+		dest.Elem().Set(reflect.Zero(dest.Elem().Type()))
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("orm: can't scan %T into json field %T", src, j.Dest)
+	}
+
+	// unmarshal into new value, so old content of map/struct is not merged with new one
+	value := reflect.New(dest.Elem().Type())
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return fmt.Errorf("orm: unmarshal json: %w", err)
+	}
+
+	dest.Elem().Set(value.Elem())
+
+	return nil
+}
+
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+
+	return false
+}
@@ -1,6 +1,8 @@
 package orm
 
 import (
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -16,7 +18,8 @@ import (
 // This micro library use the same approach like sqlx with `db` tag parsing
 //
 // Before start work with this package
-// You should call function InitMetaTagInfoCache() for warm and init cache (cacheMetaDTO)
+// You should call function InitMetaTagInfoCache() for warm and init cache (cacheMetaDTO),
+// otherwise meta info of DTO type is calculated and cached on first usage
 
 type (
 	Column   = string
@@ -26,7 +29,6 @@ type (
 	Alias    = string
 	Argument = interface{}
 
-	structName       = string
 	ormUseInTagValue = string
 
 	MetaDTO = struct {
@@ -42,9 +44,56 @@ const (
 	Undefined = ""
 )
 
+type (
+	// SelectField - field of DTO selected by GetDataForSelect.
+	SelectField struct {
+		Name    Column // name of result column: "alias.col" for fields of aliased nested struct, otherwise "col"
+		Index   []int  // index path of field in DTO (for reflect.Value.FieldByIndex)
+		JSON    bool   // field has orm_json tag
+		Encrypt string // key name of orm_encrypt tag, value is decrypted by EncryptedScanner
+	}
+
+	// JoinPart - table of part of composite DTO (orm_join), parts are joined in order of fields.
+	JoinPart struct {
+		Table Table
+		Alias Alias
+		On    JoinCond // join condition, e.g. "ON a.id = b.id", empty for first part
+	}
+
+	// fieldMeta - column of DTO and index path of its field (for reflect.Value.FieldByIndex).
+	fieldMeta struct {
+		column    Column
+		name      Column
+		path      string // Go names of fields of index path, e.g. "BaseDTO.UpdatedAt"
+		index     []int
+		json      bool
+		encrypt   string
+		omitEmpty bool
+		rules     []ruleCall // rules of orm_validate tag
+	}
+
+	// typeMeta - cached meta info of DTO type.
+	typeMeta struct {
+		meta         *MetaDTO
+		fields       map[ormUseInTagValue][]fieldMeta
+		selectFields []SelectField
+		joinParts    []JoinPart
+		tracking     []int // index path of Tracking field, nil if DTO is not trackable
+	}
+)
+
 var (
-	m            sync.RWMutex
-	cacheMetaDTO = map[structName]*MetaDTO{}
+	// ErrNotUpdatable - field of update mask is not found or has no orm_use_in:"update" tag.
+	ErrNotUpdatable = errors.New("orm: field is not updatable")
+	// ErrEmptyMask - update mask has no fields.
+	ErrEmptyMask = errors.New("orm: empty update mask")
+
+	// cacheMetaDTO - reflect.Type of struct -> *typeMeta, reads are lock free.
+	cacheMetaDTO sync.Map
+
+	nilTypeMeta = newTypeMeta(nil)
+
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
 )
 
 // custom tag for "sugar" columns values prepare for Update squirrel library staff
@@ -56,6 +105,7 @@ const (
 	tagOrmAlias     = "orm_alias"
 	tagOrmJoin      = "orm_join"
 	tagOrmTableName = "orm_table_name"
+	tagOrmOmitEmpty = "orm_omitempty" // zero value of field is not updated: `orm_use_in:"update" orm_omitempty:"true"`
 
 	ormUseInSelect = "select"
 	ormUseInCreate = "create"
@@ -65,33 +115,33 @@ const (
 )
 
 func InitMetaTagInfoCache(objs ...interface{}) {
-	m.Lock()
-	defer m.Unlock()
-
 	for _, obj := range objs {
 		if obj == nil {
 			continue
 		}
-		cacheMetaDTO[getObjTypeNameByReflect(obj)] = getNoneCacheMetaDTO(obj)
+
+		t := objType(obj)
+		cacheMetaDTO.Store(t, newTypeMeta(t))
 	}
 }
 
 func GetMetaDTO(obj interface{}) *MetaDTO {
-	return getMetaDTO(getObjTypeNameByReflect(obj), obj)
+	return getTypeMeta(obj).meta
 }
 
-func getMetaDTO(structName string, obj interface{}) *MetaDTO {
-	m.RLock()
-	if _, found := cacheMetaDTO[structName]; !found {
-		m.RUnlock()
-		m.Lock()
-		defer m.Unlock()
-		cacheMetaDTO[structName] = getNoneCacheMetaDTO(obj)
-	} else {
-		m.RUnlock()
+func getTypeMeta(obj interface{}) *typeMeta {
+	if obj == nil {
+		return nilTypeMeta
+	}
+
+	t := objType(obj)
+	if tm, found := cacheMetaDTO.Load(t); found {
+		return tm.(*typeMeta)
 	}
 
-	return cacheMetaDTO[structName]
+	tm, _ := cacheMetaDTO.LoadOrStore(t, newTypeMeta(t))
+
+	return tm.(*typeMeta)
 }
 
 func GetDataForSelect(obj interface{}) ([]Column, JoinCond) {
@@ -99,13 +149,96 @@ func GetDataForSelect(obj interface{}) ([]Column, JoinCond) {
 	return meta.ColsMap[ormUseInSelect], meta.JoinCond
 }
 
+// GetSelectFields - return fields of DTO in order of GetDataForSelect columns, result must not be modified.
+func GetSelectFields(obj interface{}) []SelectField {
+	return getTypeMeta(obj).selectFields
+}
+
+// GetJoinParts - return tables of parts of composite DTO (with orm_join tag), nil for other DTOs.
+// First part is FROM, second part is joined by orm_join of `_` field (or of its own field),
+// next parts are joined by orm_join tag of their fields:
+//
+//	type C struct {
+//		A `orm_alias:"a"`
+//		B `orm_alias:"b"`
+//		D `orm_alias:"d" orm_join:"ON d.b_id = b.id"`
+//		_ bool `orm_join:"ON a.id = b.id"`
+//	}
+func GetJoinParts(obj interface{}) []JoinPart {
+	return getTypeMeta(obj).joinParts
+}
+
+// GetDataForCreate - return create columns and values, nil pointers are NULL, driver.Valuer values are passed as is,
+// columns of nil embedded pointer structs are skipped.
 func GetDataForCreate(obj interface{}) ([]Column, []Argument) {
-	cols, args := getMetaInfoUseInTag(obj, ormUseInCreate, emptyRootAlias)
+	cols, args := getData(obj, ormUseInCreate, nil)
 	return cols, args
 }
 
+// GetDataForUpdateMask - return update columns and values like GetDataForUpdate, but only for fields of mask.
+// Mask contains Go names of fields (or paths like "BaseDTO.UpdatedAt") or db columns, fields of mask
+// are updated even if they are zero (orm_omitempty is ignored). ErrNotUpdatable is returned if mask names
+// unknown field or field without orm_use_in:"update", ErrEmptyMask - if mask is empty.
+func GetDataForUpdateMask(obj interface{}, mask []string) (map[Column]Argument, error) {
+	masked, err := maskedFields(obj, mask)
+	if err != nil {
+		return nil, err
+	}
+
+	cols, args := getData(obj, ormUseInUpdate, func(f fieldMeta, _ reflect.Value) bool { return masked[f.path] })
+
+	cv := make(map[Column]Argument, len(cols))
+	for i, v := range cols {
+		cv[v] = args[i]
+	}
+	return cv, nil
+}
+
+// maskedFields return paths of update fields of mask, see GetDataForUpdateMask.
+func maskedFields(obj interface{}, mask []string) (map[string]bool, error) {
+	if len(mask) == 0 {
+		return nil, ErrEmptyMask
+	}
+
+	fields := getTypeMeta(obj).fields[ormUseInUpdate]
+
+	masked := make(map[string]bool, len(mask))
+	for _, name := range mask {
+		found := false
+		for _, f := range fields {
+			if f.matches(name) {
+				masked[f.path], found = true, true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%w: %q", ErrNotUpdatable, name)
+		}
+	}
+
+	return masked, nil
+}
+
+// GetDataForUpdate - return update columns and values like GetDataForCreate,
+// zero values of fields with orm_omitempty tag are skipped.
 func GetDataForUpdate(obj interface{}) map[Column]Argument {
-	cols, args := getMetaInfoUseInTag(obj, ormUseInUpdate, emptyRootAlias)
+	cols, args := getData(obj, ormUseInUpdate, func(f fieldMeta, v reflect.Value) bool {
+		return !f.omitEmpty || !v.IsZero()
+	})
+
+	cv := make(map[Column]Argument, len(cols))
+	for i, v := range cols {
+		cv[v] = args[i]
+	}
+	return cv
+}
+
+// GetDataForExample - return select columns with non-zero values (query-by-example staff),
+// encrypted fields are skipped
+func GetDataForExample(obj interface{}) map[Column]Argument {
+	cols, args := getData(obj, ormUseInSelect, func(f fieldMeta, v reflect.Value) bool {
+		return f.encrypt == "" && !v.IsZero()
+	})
 
 	cv := make(map[Column]Argument, len(cols))
 	for i, v := range cols {
@@ -146,46 +279,143 @@ func GetTableNameWithAlias(obj interface{}) string {
 	return fmt.Sprintf(" %s as %s ", meta.TableName, alias)
 }
 
-func getNoneCacheMetaDTO(obj interface{}) *MetaDTO {
+func newTypeMeta(t reflect.Type) *typeMeta {
 	meta := &MetaDTO{
 		ColsMap:    map[ormUseInTagValue][]Column{ormUseInSelect: {}, ormUseInCreate: {}, ormUseInUpdate: {}},
 		JoinCond:   Undefined,
 		TableName:  Undefined,
 		TableAlias: Undefined,
-		StructName: getObjTypeNameByReflect(obj),
+		StructName: typeName(t),
 	}
-	if obj == nil {
-		return meta
+
+	tm := &typeMeta{meta: meta, fields: map[ormUseInTagValue][]fieldMeta{}}
+	if t == nil || t.Kind() != reflect.Struct {
+		return tm
 	}
 
-	meta.JoinCond = getMetaInfoForOrmTagOnlyOne(tagOrmJoin, obj)
+	meta.JoinCond = getMetaInfoForOrmTagOnlyOne(tagOrmJoin, t)
+
+	tm.tracking = trackingIndex(t)
 
-	meta.TableName = getMetaInfoForOrmTagOnlyOne(tagOrmTableName, obj)
+	meta.TableName = getMetaInfoForOrmTagOnlyOne(tagOrmTableName, t)
 
-	meta.TableAlias = getMetaInfoForOrmTagOnlyOne(tagOrmAlias, obj)
+	meta.TableAlias = getMetaInfoForOrmTagOnlyOne(tagOrmAlias, t)
 
 	for _, v := range []string{ormUseInSelect, ormUseInCreate, ormUseInUpdate} {
-		meta.ColsMap[v], _ = getMetaInfoUseInTag(obj, v, emptyRootAlias)
+		fields := getMetaInfoUseInTag(t, v, emptyRootAlias, nil, "", nil)
+
+		cols := make([]Column, len(fields))
+		for i, f := range fields {
+			cols[i] = f.column
+		}
+
+		tm.fields[v], meta.ColsMap[v] = fields, cols
+	}
+
+	tm.selectFields = make([]SelectField, len(tm.fields[ormUseInSelect]))
+	for i, f := range tm.fields[ormUseInSelect] {
+		tm.selectFields[i] = SelectField{Name: f.name, Index: f.index, JSON: f.json, Encrypt: f.encrypt}
+	}
+
+	if meta.JoinCond != Undefined {
+		tm.joinParts = getJoinParts(t, meta.JoinCond)
 	}
 
-	return meta
+	return tm
 }
 
-func getObjTypeNameByReflect(obj interface{}) string {
-	if obj == nil {
-		return "nil"
+// partTable return table and alias of part of composite DTO (struct field with orm_table_name), alias is orm_alias
+// of field, then orm_alias of struct, then table. Table is Undefined if field is not part.
+func partTable(field reflect.StructField) (Table, Alias) {
+	if field.Type.Kind() != reflect.Struct {
+		return Undefined, Undefined
 	}
-	return reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+
+	table := getMetaInfoForOrmTagOnlyOne(tagOrmTableName, field.Type)
+	if table == Undefined {
+		return Undefined, Undefined
+	}
+
+	alias := field.Tag.Get(tagOrmAlias)
+	if isTagEmpty(alias) {
+		alias = getMetaInfoForOrmTagOnlyOne(tagOrmAlias, field.Type)
+	}
+	if alias == Undefined {
+		alias = table
+	}
+
+	return table, alias
 }
 
-func getMetaInfoForOrmTagOnlyOne(value ormUseInTagValue, obj interface{}) string {
-	v := reflect.Indirect(reflect.ValueOf(obj))
-	t := v.Type()
+// getJoinParts return tables of parts (nested structs with orm_table_name) of composite DTO t.
+func getJoinParts(t reflect.Type, joinCond JoinCond) []JoinPart {
+	parts := []JoinPart{}
 
-	if t.Kind() != reflect.Struct {
-		return ""
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Name == underscored || field.Type.Kind() != reflect.Struct {
+			continue
+		}
+
+		table, alias := partTable(field)
+		if table == Undefined {
+			continue
+		}
+
+		on := field.Tag.Get(tagOrmJoin)
+		if isTagEmpty(on) {
+			on = Undefined
+		}
+		switch len(parts) {
+		case 0:
+			on = Undefined
+		case 1:
+			if on == Undefined {
+				on = joinCond
+			}
+		}
+
+		parts = append(parts, JoinPart{Table: table, Alias: alias, On: strings.TrimSpace(on)})
+	}
+
+	return parts
+}
+
+// objType return type of obj without pointers.
+func objType(obj interface{}) reflect.Type {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// objValue return struct value of obj without pointers, false if obj is not struct or nil pointer.
+func objValue(obj interface{}) (reflect.Value, bool) {
+	if obj == nil {
+		return reflect.Value{}, false
+	}
+
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+
+	return v, v.Kind() == reflect.Struct
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "nil"
 	}
+	return t.Name()
+}
 
+func getMetaInfoForOrmTagOnlyOne(value ormUseInTagValue, t reflect.Type) string {
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
@@ -201,22 +431,119 @@ func isTagEmpty(tag string) bool {
 	return tag == "" || tag == "-"
 }
 
-func getMetaInfoUseInTag(obj interface{}, useInTag ormUseInTagValue, alias Alias) ([]Column, []Argument) {
-	cols, args := []Column{}, []Argument{}
+// getData return columns and values of fields of obj by cached index paths,
+// if include is not nil, only fields for which it returns true are returned.
+func getData(
+	obj interface{},
+	useInTag ormUseInTagValue,
+	include func(f fieldMeta, v reflect.Value) bool,
+) ([]Column, []Argument) {
+	v, ok := objValue(obj)
+	if !ok {
+		return []Column{}, []Argument{}
+	}
 
-	if obj == nil {
-		return cols, args
+	fields := getTypeMeta(obj).fields[useInTag]
+
+	cols, args := make([]Column, 0, len(fields)), make([]Argument, 0, len(fields))
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (include != nil && !include(f, fv)) {
+			continue
+		}
+
+		cols, args = append(cols, f.column), append(args, argument(fv, f))
 	}
 
-	v := reflect.Indirect(reflect.ValueOf(obj))
-	t := v.Type()
+	return cols, args
+}
+
+// matches - name is db column, Go name or path of field.
+func (f fieldMeta) matches(name string) bool {
+	return name == f.column || name == f.path || name == f.path[strings.LastIndex(f.path, pathSeparator)+1:]
+}
+
+// fieldByIndex - reflect.Value.FieldByIndex, which follows embedded pointers and return false for nil one.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, true
+}
 
-	if t.Kind() != reflect.Struct {
-		return cols, args
+// argument return value of field for squirrel: orm_json field is wrapped by JSON, orm_encrypt - by Encrypted.
+func argument(v reflect.Value, f fieldMeta) Argument {
+	var arg Argument
+	if f.json {
+		arg = JSON{V: v.Interface()}
+	} else {
+		arg = value(v)
 	}
 
+	if f.encrypt != "" && arg != nil {
+		arg = Encrypted{V: arg, Key: f.encrypt}
+	}
+
+	return arg
+}
+
+// value return value of field: driver.Valuer is passed as is, nil pointer is NULL (untyped nil),
+// other pointers are dereferenced.
+func value(v reflect.Value) Argument {
+	for {
+		switch {
+		case v.Kind() == reflect.Ptr && v.IsNil():
+			return nil
+		case v.Type().Implements(valuerType):
+			return v.Interface()
+		case v.CanAddr() && v.Addr().Type().Implements(valuerType):
+			return v.Addr().Interface()
+		case v.Kind() == reflect.Ptr:
+			v = v.Elem()
+		default:
+			return v.Interface()
+		}
+	}
+}
+
+// getMetaInfoUseInTag return fields of struct t used in useInTag, index is index path of t in root struct.
+// Unexported fields are skipped, nested structs and embedded pointers to structs (without orm_use_in tag)
+// are processed recursively, parents - types of structs of index path (recursive embedded pointers are skipped).
+// Columns of nested struct are aliased by its orm_alias field tag, parts of composite DTO - by alias of partTable.
+func getMetaInfoUseInTag(
+	t reflect.Type,
+	useInTag ormUseInTagValue,
+	alias Alias,
+	index []int,
+	path string,
+	parents []reflect.Type,
+) []fieldMeta {
+	parents = append(parents[:len(parents):len(parents)], t)
+
+	// parts of composite DTO are aliased like in getJoinParts
+	composite := len(parents) == 1 && getMetaInfoForOrmTagOnlyOne(tagOrmJoin, t) != Undefined
+
+	fields := []fieldMeta{}
+
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fieldIndex := append(append(make([]int, 0, len(index)+1), index...), i)
+
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + pathSeparator + field.Name
+		}
 
 		if tagValue := field.Tag.Get(tagOrmUseIN); !isTagEmpty(tagValue) {
 			if !strings.Contains(tagValue, useInTag) {
@@ -228,29 +555,58 @@ func getMetaInfoUseInTag(obj interface{}, useInTag ormUseInTagValue, alias Alias
 				continue
 			}
 
-			colValue := dbTagValue
+			colValue, name := dbTagValue, dbTagValue
 			if alias != "" && useInTag == ormUseInSelect {
-				colValue = fmt.Sprintf("%s.%s", alias, dbTagValue)
-				colValue = fmt.Sprintf("%s as \"%s\"", colValue, colValue)
+				name = fmt.Sprintf("%s.%s", alias, dbTagValue)
+				colValue = fmt.Sprintf("%s as \"%s\"", name, name)
 			}
 
-			cols, args = append(cols, colValue), append(args, v.Field(i).Interface())
+			fields = append(fields, fieldMeta{
+				column:    colValue,
+				name:      name,
+				path:      fieldPath,
+				index:     fieldIndex,
+				json:      IsJSONField(field),
+				encrypt:   EncryptKeyName(field),
+				omitEmpty: !isTagEmpty(field.Tag.Get(tagOrmOmitEmpty)),
+				rules:     parseRules(field.Tag.Get(tagOrmValidate)),
+			})
 			continue
 		}
 
-		if v.Field(i).Kind() == reflect.Struct {
-			if aliasTagValue := field.Tag.Get(tagOrmAlias); !isTagEmpty(aliasTagValue) {
-				alias = field.Tag.Get(tagOrmAlias)
+		if nested, ok := nestedStruct(field); ok && !containsType(parents, nested) {
+			fieldAlias := alias
+			if table, partAlias := partTable(field); composite && table != Undefined {
+				fieldAlias = partAlias
+			} else if aliasTagValue := field.Tag.Get(tagOrmAlias); !isTagEmpty(aliasTagValue) {
+				fieldAlias = aliasTagValue
 			}
 
-			c, a := []Column{}, []Argument{}
-			if v.Field(i).CanAddr() && v.Field(i).Addr().CanInterface() {
-				c, a = getMetaInfoUseInTag(v.Field(i).Addr().Interface(), useInTag, alias)
-			}
-			cols, args = append(cols, c...), append(args, a...)
+			fields = append(fields, getMetaInfoUseInTag(nested, useInTag, fieldAlias, fieldIndex, fieldPath, parents)...)
 		}
+	}
 
+	return fields
+}
+
+// nestedStruct return type of struct of field which is processed recursively: struct or embedded pointer to struct.
+func nestedStruct(field reflect.StructField) (reflect.Type, bool) {
+	switch {
+	case field.Type.Kind() == reflect.Struct:
+		return field.Type, true
+	case field.Anonymous && field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct:
+		return field.Type.Elem(), true
 	}
 
-	return cols, args
+	return nil, false
+}
+
+func containsType(types []reflect.Type, t reflect.Type) bool {
+	for _, tt := range types {
+		if tt == t {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,89 @@
+package orm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type BenchDTO struct {
+	BaseDTO
+	Name    string            `db:"name"     orm_use_in:"select,create,update"`
+	Email   string            `db:"email"    orm_use_in:"select,create,update"`
+	Age     int               `db:"age"      orm_use_in:"select,create,update"`
+	Rights  int64             `db:"rights"   orm_use_in:"select,create"`
+	Deleted bool              `db:"deleted"  orm_use_in:"select,update"`
+	Birth   time.Time         `db:"birth"    orm_use_in:"select,create"`
+	Attrs   map[string]string `db:"attrs"    orm_use_in:"select,create,update" orm_json:"jsonb"`
+	_       interface{}       `orm_table_name:"bench" orm_alias:"b"`
+}
+
+func newBenchDTO() *BenchDTO {
+	return &BenchDTO{Name: "name", Email: "email", Age: 10, Rights: 100, Attrs: map[string]string{"a": "b"}}
+}
+
+func BenchmarkGetDataForCreate(b *testing.B) {
+	obj := newBenchDTO()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		GetDataForCreate(obj)
+	}
+}
+
+func BenchmarkGetDataForUpdate(b *testing.B) {
+	obj := newBenchDTO()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		GetDataForUpdate(obj)
+	}
+}
+
+func BenchmarkGetDataForSelect(b *testing.B) {
+	obj := newBenchDTO()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		GetDataForSelect(obj)
+	}
+}
+
+func BenchmarkGetDataForSelect_Composite(b *testing.B) {
+	obj := &C{}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		GetDataForSelect(obj)
+	}
+}
+
+func BenchmarkGetDataForExample(b *testing.B) {
+	obj := newBenchDTO()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		GetDataForExample(obj)
+	}
+}
+
+func BenchmarkGetMetaDTO_Parallel(b *testing.B) {
+	objs := []interface{}{newBenchDTO(), &A{}, &B{}, &C{}, &D{}}
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			GetMetaDTO(objs[i%len(objs)])
+		}
+	})
+}
+
+// BenchmarkNewTypeMeta - calculation of meta info without cache, for comparison with cached Get* functions.
+func BenchmarkNewTypeMeta(b *testing.B) {
+	t := reflect.TypeOf(BenchDTO{})
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		newTypeMeta(t)
+	}
+}
@@ -1,6 +1,11 @@
 package orm
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -150,7 +155,7 @@ func (suite *OrmTestSuit) Test_BadGetOrmDataForCreate() {
 func (suite *OrmTestSuit) Test_BadGetOrmDataForSelect() {
 	t := suite.T()
 	col, join := GetDataForSelect(&BadStruct{})
-	assert.Equal(t, []string{}, col)
+	assert.Equal(t, []string{"id", "created_at", "updated_at", "select_field"}, col, "embedded *A is followed")
 	assert.Equal(t, "", join)
 
 	col, join = GetDataForSelect(nil)
@@ -205,3 +210,548 @@ func (suite *OrmTestSuit) Test_GetTableNameWithAlias() {
 	assert.Equal(t, "", GetTableNameWithAlias(nil))
 	assert.Equal(t, "", GetTableNameWithAlias(&BadStruct{}))
 }
+
+func (suite *OrmTestSuit) Test_GetDataForExample() {
+	t := suite.T()
+
+	cv := GetDataForExample(&B{
+		BaseDTO: BaseDTO{ID: 10},
+		CUS2:    5,
+	})
+	assert.Equal(t, map[string]interface{}{"id": int64(10), "cus2_field": 5}, cv)
+
+	assert.Equal(t, map[string]interface{}{}, GetDataForExample(&B{}))
+	assert.Equal(t, map[string]interface{}{}, GetDataForExample(nil))
+	assert.Equal(t, map[string]interface{}{}, GetDataForExample(&BadStruct{}))
+}
+
+type JSONDTO struct {
+	ID    int64             `db:"id"    orm_use_in:"select"`
+	Attrs map[string]string `db:"attrs" orm_use_in:"select,create,update" orm_json:"jsonb"`
+	Tags  []string          `db:"tags"  orm_use_in:"select,create"        orm_json:"json"`
+	Plain []string          `db:"plain" orm_use_in:"select,create"`
+}
+
+func TestJSON(t *testing.T) {
+	cols, args := GetDataForCreate(&JSONDTO{Attrs: map[string]string{"color": "red"}, Plain: []string{"a"}})
+	assert.Equal(t, []string{"attrs", "tags", "plain"}, cols)
+	assert.Equal(t,
+		[]interface{}{JSON{V: map[string]string{"color": "red"}}, JSON{V: []string(nil)}, []string{"a"}}, args)
+
+	value, err := args[0].(JSON).Value()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"color":"red"}`, value)
+
+	value, err = args[1].(JSON).Value()
+	assert.Nil(t, err)
+	assert.Nil(t, value, "nil slice is NULL")
+
+	_, err = JSON{V: make(chan int)}.Value()
+	assert.NotNil(t, err)
+
+	assert.Equal(t, map[string]interface{}{"tags": JSON{V: []string{"x"}}},
+		GetDataForExample(&JSONDTO{Tags: []string{"x"}}))
+
+	dto := JSONDTO{Attrs: map[string]string{"old": "value"}}
+	assert.Nil(t, (&JSONScanner{Dest: &dto.Attrs}).Scan([]byte(`{"color":"blue"}`)))
+	assert.Equal(t, map[string]string{"color": "blue"}, dto.Attrs)
+	assert.Nil(t, (&JSONScanner{Dest: &dto.Tags}).Scan(`["a","b"]`))
+	assert.Equal(t, []string{"a", "b"}, dto.Tags)
+	assert.Nil(t, (&JSONScanner{Dest: &dto.Attrs}).Scan(nil))
+	assert.Nil(t, dto.Attrs)
+
+	assert.NotNil(t, (&JSONScanner{Dest: &dto.Tags}).Scan(123))
+	assert.NotNil(t, (&JSONScanner{Dest: &dto.Tags}).Scan("{"))
+	assert.NotNil(t, (&JSONScanner{Dest: dto.Tags}).Scan("[]"))
+}
+
+type (
+	ValidDTO struct {
+		BaseDTO
+		Name  string            `db:"name"  orm_use_in:"select, create,update"`
+		Attrs map[string]string `db:"attrs" orm_use_in:"select" orm_json:"jsonb"`
+		_     interface{}       `orm_table_name:"valid" orm_alias:"v"`
+	}
+
+	invalidBase struct {
+		Hidden string `db:"hidden" orm_use_in:"select"`
+	}
+
+	InvalidDTO struct {
+		invalidBase
+		Name    string `db:"name"  orm_use_in:"select,craete"`
+		Name2   string `db:"name"  orm_use_in:"select"`
+		NoDB    string `orm_use_in:"select"`
+		Table   string `orm_table_name:"invalid"`
+		Unknown string `db:"unknown" orm_omit:"true"`
+		Omit    string `db:"omit"    orm_use_in:"select" orm_omitempty:"true"`
+	}
+)
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Validate(&ValidDTO{}, ValidDTO{}, &B{}, &D{}, nil))
+
+	kinds := func(diags Diagnostics) map[string]DiagnosticKind {
+		res := map[string]DiagnosticKind{}
+		for _, d := range diags {
+			res[d.Field] = d.Kind
+		}
+		return res
+	}
+
+	assert.Equal(t, map[string]DiagnosticKind{"NoDbTagField": DiagUnknownTag}, kinds(Validate(&A{})))
+	assert.Equal(t, map[string]DiagnosticKind{"A.NoDbTagField": DiagUnknownTag}, kinds(Validate(&C{})))
+	assert.Equal(t, map[string]DiagnosticKind{
+		"":               DiagMissingTableName,
+		"A.NoDbTagField": DiagUnknownTag,
+		"bad_name_field": DiagMisplacedTag,
+	}, kinds(Validate(&BadStruct{})))
+
+	diags := Validate(&InvalidDTO{})
+	assert.Equal(t, map[string]DiagnosticKind{
+		"invalidBase": DiagUnaddressable,
+		"Name":        DiagUnknownUseIn,
+		"NoDB":        DiagMissingDBTag,
+		"Table":       DiagMisplacedTag,
+		"Unknown":     DiagUnknownTag,
+		"Omit":        DiagMisplacedTag,
+		"":            DiagDuplicateColumn,
+	}, kinds(diags))
+	assert.Contains(t, diags.Error(), `InvalidDTO.Name: unknown_use_in: unknown orm_use_in value "craete"`)
+	assert.Contains(t, diags.Error(), `InvalidDTO: duplicate_column: column "name" is used several times in select`)
+
+	keys, ok := tagKeys(`db:"a" orm_use_in:"select"  json:"a,omitempty"`)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"db", "orm_use_in", "json"}, keys)
+	for _, tag := range []reflect.StructTag{`db:"broken`, `db`, `db: "a"`, `:"a"`} {
+		_, ok = tagKeys(tag)
+		assert.False(t, ok, tag)
+	}
+
+	assert.Equal(t, Diagnostics{{Struct: "int", Kind: DiagNotStruct, Message: "DTO must be struct or pointer to struct"}},
+		Validate(1))
+
+	type strictDTO struct { // it is not cached by other tests
+		ID int64       `db:"id" orm_use_in:"select"`
+		_  interface{} `orm_table_name:"strict"`
+	}
+	assert.Equal(t, diags, InitMetaTagInfoCacheStrict(&strictDTO{}, &InvalidDTO{}))
+	_, cached := cacheMetaDTO.Load(reflect.TypeOf(strictDTO{}))
+	assert.False(t, cached, "cache is not changed by failed strict init")
+
+	assert.Nil(t, InitMetaTagInfoCacheStrict(&ValidDTO{}))
+	assert.Equal(t, "valid", GetTableName(&ValidDTO{}))
+}
+
+func TestCacheKeyedByType(t *testing.T) {
+	pkgA := &A{}
+
+	type A struct { // the same name as package level A
+		Name string      `db:"name" orm_use_in:"select,create"`
+		_    interface{} `orm_table_name:"local_a"`
+	}
+
+	assert.Equal(t, "A", GetTableName(pkgA))
+	assert.Equal(t, "local_a", GetTableName(&A{}))
+	assert.Equal(t, "local_a", GetTableName(A{}))
+
+	anon1 := struct {
+		ID int64       `db:"id" orm_use_in:"select"`
+		_  interface{} `orm_table_name:"anon1"`
+	}{}
+	anon2 := struct {
+		Name string      `db:"name" orm_use_in:"select"`
+		_    interface{} `orm_table_name:"anon2"`
+	}{}
+
+	assert.Equal(t, "anon1", GetTableName(&anon1))
+	assert.Equal(t, "anon2", GetTableName(&anon2))
+	assert.Equal(t, []Column{"name"}, GetMetaDTO(&anon2).ColsMap[ormUseInSelect])
+
+	var nilPtr *D
+	assert.Equal(t, "D", GetTableName(nilPtr))
+	cols, args := GetDataForCreate(nilPtr)
+	assert.Equal(t, []Column{}, cols)
+	assert.Equal(t, []Argument{}, args)
+
+	cols, args = GetDataForCreate(D{CUS: 1.5, CUS2: 2})
+	assert.Equal(t, []Column{"cus_field", "cus2_field"}, cols, "DTO passed by value")
+	assert.Equal(t, []Argument{1.5, 2}, args)
+}
+
+type (
+	ThreePartsDTO struct {
+		A `orm_alias:"a"`
+		B `orm_alias:"b"`
+		D `orm_alias:"d" orm_join:"ON d.id = b.id"`
+		_ bool `orm_join:"ON a.id = b.id"`
+	}
+
+	// parts without field orm_alias: B is aliased by orm_alias of struct, D - by table
+	UnaliasedPartsDTO struct {
+		A `orm_alias:"a"`
+		B
+		D `orm_join:"ON D.id = b.id"`
+		_ bool `orm_join:"ON a.id = b.id"`
+	}
+
+	BadJoinDTO struct {
+		A `orm_alias:"a"`
+		B `orm_alias:"b"`
+		D `orm_alias:"d"`
+		_ bool `orm_join:"ON a.id = b.id"`
+	}
+)
+
+func TestJoin(t *testing.T) {
+	assert.Equal(t, []JoinPart{
+		{Table: "A", Alias: "a"},
+		{Table: "B", Alias: "b", On: "ON a.id = b.id"},
+	}, GetJoinParts(&C{}))
+	assert.Nil(t, GetJoinParts(&A{}))
+	assert.Nil(t, GetJoinParts(nil))
+
+	assert.Equal(t, []JoinPart{
+		{Table: "A", Alias: "a"},
+		{Table: "B", Alias: "b", On: "ON a.id = b.id"},
+		{Table: "D", Alias: "d", On: "ON d.id = b.id"},
+	}, GetJoinParts(ThreePartsDTO{}))
+	if diags := Validate(&ThreePartsDTO{}); assert.Len(t, diags, 1) {
+		assert.Equal(t, DiagUnknownTag, diags[0].Kind, "orm_join of part is not misplaced")
+	}
+
+	parts := GetJoinParts(&UnaliasedPartsDTO{})
+	assert.Equal(t, []JoinPart{
+		{Table: "A", Alias: "a"},
+		{Table: "B", Alias: "b", On: "ON a.id = b.id"},
+		{Table: "D", Alias: "D", On: "ON D.id = b.id"},
+	}, parts)
+
+	prefixes := map[string]int{}
+	for _, f := range GetSelectFields(&UnaliasedPartsDTO{}) {
+		prefixes[f.Name[:strings.Index(f.Name, ".")]]++
+	}
+	assert.Equal(t, map[string]int{"a": 4, "b": 5, "D": 5}, prefixes, "columns are aliased like parts of join")
+
+	diags := Validate(&BadJoinDTO{})
+	assert.Len(t, diags, 2)
+	assert.Equal(t, DiagMissingJoin, diags[1].Kind)
+	assert.Contains(t, diags[1].Message, "part D as d has no orm_join condition")
+
+	cols, _ := GetDataForSelect(&C{})
+	fields := GetSelectFields(&C{})
+	assert.Len(t, fields, len(cols))
+	assert.Equal(t, SelectField{Name: "a.id", Index: []int{0, 0, 0}}, fields[0])
+	assert.Equal(t, SelectField{Name: "b.cus_field", Index: []int{1, 1}}, fields[7])
+	assert.Equal(t, `b.cus_field as "b.cus_field"`, cols[7])
+
+	c := C{}
+	reflect.ValueOf(&c).Elem().FieldByIndex(fields[7].Index).SetFloat(1.5)
+	assert.Equal(t, 1.5, c.B.CUS)
+
+	assert.Equal(t, SelectField{Name: "id", Index: []int{0, 0}}, GetSelectFields(&A{})[0])
+}
+
+type (
+	Cents int64  // driver.Valuer with value receiver
+	Upper string // driver.Valuer with pointer receiver
+
+	Author struct {
+		CreatedBy *string `db:"created_by" orm_use_in:"select,create"`
+	}
+
+	NullableDTO struct {
+		*Author
+		Note  *string        `db:"note"  orm_use_in:"select,create,update"`
+		Score *int           `db:"score" orm_use_in:"create,update" orm_omitempty:"true"`
+		Title string         `db:"title" orm_use_in:"create,update" orm_omitempty:"true"`
+		Nick  sql.NullString `db:"nick"  orm_use_in:"create,update"`
+		Price Cents          `db:"price" orm_use_in:"create,update"`
+		Code  Upper          `db:"code"  orm_use_in:"create"`
+		_     interface{}    `orm_table_name:"nullables"`
+	}
+
+	Node struct {
+		*Node
+		Name string      `db:"name" orm_use_in:"create"`
+		_    interface{} `orm_table_name:"nodes"`
+	}
+)
+
+func (c Cents) Value() (driver.Value, error) {
+	return float64(c) / 100, nil
+}
+
+func (u *Upper) Value() (driver.Value, error) {
+	return strings.ToUpper(string(*u)), nil
+}
+
+func TestNullable(t *testing.T) {
+	obj := &NullableDTO{Price: 150, Code: "ab"}
+
+	cols, args := GetDataForCreate(obj)
+	assert.Equal(t, []string{"note", "score", "title", "nick", "price", "code"}, cols, "nil *Author is skipped")
+	assert.Equal(t, []interface{}{nil, nil, "", sql.NullString{}, Cents(150), &obj.Code}, args)
+
+	code, err := args[5].(driver.Valuer).Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "AB", code)
+
+	author, note, score := "bob", "note", 0
+	obj = &NullableDTO{Author: &Author{CreatedBy: &author}, Note: &note, Nick: sql.NullString{String: "n", Valid: true}}
+
+	cols, args = GetDataForCreate(obj)
+	assert.Equal(t, "created_by", cols[0])
+	assert.Equal(t, []interface{}{"bob", "note"}, args[:2], "pointers are dereferenced")
+
+	assert.Equal(t, map[string]interface{}{
+		"note":  "note",
+		"nick":  sql.NullString{String: "n", Valid: true},
+		"price": Cents(0),
+	}, GetDataForUpdate(obj), "zero title and nil score are omitted")
+
+	obj.Score, obj.Title = &score, "title"
+	update := GetDataForUpdate(obj)
+	assert.Equal(t, 0, update["score"], "not nil pointer to zero is updated")
+	assert.Equal(t, "title", update["title"])
+
+	assert.Equal(t, map[string]interface{}{"created_by": "bob", "note": "note"}, GetDataForExample(obj))
+
+	selectCols, _ := GetDataForSelect(&NullableDTO{})
+	assert.Equal(t, []string{"created_by", "note"}, selectCols)
+
+	cols, args = GetDataForCreate(&Node{Node: &Node{Name: "parent"}, Name: "child"})
+	assert.Equal(t, []string{"name"}, cols, "recursive embedded pointer is not followed")
+	assert.Equal(t, []interface{}{"child"}, args)
+	assert.Nil(t, Validate(&Node{}, &NullableDTO{}))
+}
+
+func TestUpdateMask(t *testing.T) {
+	obj := &NullableDTO{Title: "", Price: 250}
+
+	cv, err := GetDataForUpdateMask(obj, []string{"Title", "price"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"title": "", "price": Cents(250)}, cv, "zero omitempty field of mask")
+
+	cv, err = GetDataForUpdateMask(&B{BaseDTO: BaseDTO{ID: 1}, CUS: 1.5}, []string{"BaseDTO.UpdatedAt", "CUS"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"updated_at": time.Time{}, "cus_field": 1.5}, cv)
+
+	for _, mask := range [][]string{{"Code"}, {"ID"}, {"unknown"}, {"Title", "code"}} {
+		_, err = GetDataForUpdateMask(obj, mask)
+		assert.True(t, errors.Is(err, ErrNotUpdatable), mask)
+	}
+
+	_, err = GetDataForUpdateMask(obj, []string{"Code"})
+	assert.EqualError(t, err, `orm: field is not updatable: "Code"`)
+
+	_, err = GetDataForUpdateMask(obj, nil)
+	assert.Equal(t, ErrEmptyMask, err)
+}
+
+type TrackedNullableDTO struct {
+	NullableDTO
+	Tracking
+}
+
+type TrackedJSONDTO struct {
+	Tracking
+	JSONDTO
+}
+
+func TestTrack(t *testing.T) {
+	note := "note"
+	obj := &TrackedNullableDTO{NullableDTO: NullableDTO{Note: &note, Price: 100, Code: "ab"}}
+	json := &TrackedJSONDTO{JSONDTO: JSONDTO{Attrs: map[string]string{"a": "1"}}}
+
+	_, err := Changes(obj)
+	assert.Equal(t, ErrNotTracked, err)
+	assert.Equal(t, ErrNotTrackable, Track(*obj))
+	assert.Equal(t, ErrNotTrackable, Track((*TrackedNullableDTO)(nil)))
+	assert.Equal(t, ErrNotTrackable, Track(&obj.NullableDTO), "DTO without Tracking field")
+
+	assert.Nil(t, Track(obj))
+	assert.Nil(t, Track(json))
+
+	changes, err := Changes(obj)
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+
+	newNote := "note" // other pointer to the same value
+	obj.Note, obj.Title, obj.Price = &newNote, "title", 200
+	json.Attrs["a"] = "2" // in place change of json field
+
+	changes, err = Changes(obj)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"title": "title", "price": Cents(200)}, changes)
+
+	changes, err = Changes(json)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"attrs": JSON{V: map[string]string{"a": "2"}}}, changes)
+
+	assert.Nil(t, Track(obj))
+	obj.Note = nil
+	changes, err = Changes(obj)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"note": nil}, changes)
+
+	Untrack(obj)
+	Untrack(*obj)
+	_, err = Changes(obj)
+	assert.Equal(t, ErrNotTracked, err)
+}
+
+type SecretDTO struct {
+	ID    int64             `db:"id"    orm_use_in:"select"`
+	Token string            `db:"token" orm_use_in:"select,create,update" orm_encrypt:"tokens"`
+	Phone *string           `db:"phone" orm_use_in:"select,create"        orm_encrypt:"personal"`
+	Attrs map[string]string `db:"attrs" orm_use_in:"select,create"        orm_encrypt:"personal" orm_json:"jsonb"`
+	Bad   int               `db:"bad"   orm_use_in:"select"               orm_encrypt:"personal"`
+	_     interface{}       `orm_table_name:"secrets"`
+}
+
+func TestEncrypt(t *testing.T) {
+	key := func(b byte) []byte { return []byte(strings.Repeat(string(rune('a'+b)), 32)) }
+	ring := KeyRing{
+		"tokens":   {Current: "k1", Keys: map[string][]byte{"k1": key(1)}},
+		"personal": {Current: "p1", Keys: map[string][]byte{"p1": key(2)}},
+	}
+
+	_, err := Encrypt("tokens", []byte("secret"))
+	assert.Equal(t, ErrNoKeyProvider, err)
+
+	SetKeyProvider(ring)
+	defer SetKeyProvider(nil)
+
+	cols, args := GetDataForCreate(&SecretDTO{Token: "secret", Attrs: map[string]string{"a": "1"}})
+	assert.Equal(t, []string{"token", "phone", "attrs"}, cols)
+	assert.Equal(t, Encrypted{V: "secret", Key: "tokens"}, args[0])
+	assert.Nil(t, args[1], "nil pointer is NULL")
+
+	value, err := args[0].(driver.Valuer).Value()
+	assert.Nil(t, err)
+	ciphertext := value.(string)
+	assert.NotContains(t, ciphertext, "secret")
+
+	id, err := CiphertextKeyID(ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, "k1", id)
+
+	// rotation: new values are encrypted by current key, old values are decrypted by their key
+	ring["tokens"] = KeySet{Current: "k2", Keys: map[string][]byte{"k1": key(1), "k2": key(3)}}
+
+	dto := SecretDTO{}
+	assert.Nil(t, (&EncryptedScanner{Dest: &dto.Token, Key: "tokens"}).Scan([]byte(ciphertext)))
+	assert.Equal(t, "secret", dto.Token)
+
+	value, err = Encrypted{V: "secret", Key: "tokens"}.Value()
+	assert.Nil(t, err)
+	id, _ = CiphertextKeyID(value.(string))
+	assert.Equal(t, "k2", id)
+
+	_, err = Decrypt("personal", ciphertext)
+	assert.True(t, errors.Is(err, ErrUnknownKey), "key id of other key name")
+	ring["personal"].Keys["k1"] = key(1)
+	_, err = Decrypt("personal", ciphertext)
+	assert.True(t, errors.Is(err, ErrBadCiphertext), "key name is authenticated")
+
+	tampered := []byte(ciphertext)
+	tampered[len(tampered)-3] ^= 1
+	_, err = Decrypt("tokens", string(tampered))
+	assert.True(t, errors.Is(err, ErrBadCiphertext))
+	_, err = Decrypt("tokens", "plain text")
+	assert.True(t, errors.Is(err, ErrBadCiphertext))
+
+	value, err = args[2].(driver.Valuer).Value()
+	assert.Nil(t, err)
+	assert.Nil(t, (&EncryptedScanner{Dest: &JSONScanner{Dest: &dto.Attrs}, Key: "personal"}).Scan(value))
+	assert.Equal(t, map[string]string{"a": "1"}, dto.Attrs)
+
+	value, _ = Encrypted{V: "+1", Key: "personal"}.Value()
+	assert.Nil(t, (&EncryptedScanner{Dest: &dto.Phone, Key: "personal"}).Scan(value))
+	assert.Equal(t, "+1", *dto.Phone)
+	assert.Nil(t, (&EncryptedScanner{Dest: &dto.Phone, Key: "personal"}).Scan(nil))
+	assert.Nil(t, dto.Phone)
+	assert.NotNil(t, (&EncryptedScanner{Dest: &dto.Bad, Key: "personal"}).Scan(value))
+
+	_, err = Encrypted{V: 1, Key: "personal"}.Value()
+	assert.NotNil(t, err)
+
+	assert.Equal(t, map[string]interface{}{"id": int64(1)}, GetDataForExample(&SecretDTO{ID: 1, Token: "secret"}))
+
+	diags := Validate(&SecretDTO{})
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "Bad", diags[0].Field)
+		assert.Equal(t, DiagMisplacedTag, diags[0].Kind)
+	}
+
+	tracked := struct {
+		SecretDTO
+		Tracking
+	}{SecretDTO: dto}
+	assert.Nil(t, Track(&tracked))
+	changes, err := Changes(&tracked)
+	assert.Nil(t, err)
+	assert.Empty(t, changes, "random ciphertexts are not changes")
+}
+
+type SignupDTO struct {
+	ID    int64          `db:"id"     orm_use_in:"select"`
+	Email string         `db:"email"  orm_use_in:"create,update" orm_validate:"required,max=20,email"`
+	Name  *string        `db:"name"   orm_use_in:"create,update" orm_validate:"min=2"`
+	Plan  string         `db:"plan"   orm_use_in:"create,update" orm_validate:"oneof=free pro"`
+	Age   int            `db:"age"    orm_use_in:"create,update" orm_validate:"max=150" orm_omitempty:"true"`
+	Code  sql.NullString `db:"code"   orm_use_in:"create"        orm_validate:"required,slug"`
+	Tags  []string       `db:"tags"   orm_use_in:"create"        orm_validate:"max=2"`
+	Notes string         `db:"-"      orm_validate:"required"`
+	_     interface{}    `orm_table_name:"signups"`
+}
+
+func TestValidateFields(t *testing.T) {
+	RegisterRule("slug", func(value interface{}, _ string) bool {
+		s, _ := value.(string)
+		return s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyz-") == ""
+	})
+
+	name := "Bob"
+	valid := SignupDTO{Email: "bob@example.com", Name: &name, Plan: "pro",
+		Code: sql.NullString{String: "bob-1", Valid: true}, Tags: []string{"a"}}
+	assert.Equal(t, ValidationErrors{{Field: "Code", Column: "code", Rule: "slug"}}, ValidateForCreate(&valid))
+	valid.Code.String = "bob"
+	assert.Nil(t, ValidateForCreate(&valid))
+	assert.Nil(t, ValidateForUpdate(valid))
+
+	short := ""
+	err := ValidateForCreate(&SignupDTO{Email: "Bob <b@x.io>", Name: &short, Plan: "vip", Age: 200,
+		Tags: []string{"a", "b", "c"}})
+	assert.Equal(t, ValidationErrors{
+		{Field: "Email", Column: "email", Rule: "email"},
+		{Field: "Name", Column: "name", Rule: "min", Param: "2"},
+		{Field: "Plan", Column: "plan", Rule: "oneof", Param: "free pro"},
+		{Field: "Age", Column: "age", Rule: "max", Param: "150"},
+		{Field: "Code", Column: "code", Rule: "required"},
+		{Field: "Tags", Column: "tags", Rule: "max", Param: "2"},
+	}, err)
+	assert.Equal(t, "orm: validation failed: email: email; name: min=2; plan: oneof=free pro; age: max=150; "+
+		"code: required; tags: max=2", err.Error())
+
+	err = ValidateForUpdate(&SignupDTO{Email: "very.long.name@example.com", Plan: "free"})
+	assert.Equal(t, ValidationErrors{{Field: "Email", Column: "email", Rule: "max", Param: "20"}}, err,
+		"nil name is checked only by required, zero age with orm_omitempty is not updated")
+
+	assert.Nil(t, ValidateForUpdateMask(&SignupDTO{Plan: "free"}, []string{"plan"}), "fields out of mask")
+	assert.Equal(t, ErrEmptyMask, ValidateForUpdateMask(&SignupDTO{}, nil))
+
+	type UnknownRuleDTO struct {
+		Name string      `db:"name" orm_use_in:"create" orm_validate:"required,nope"`
+		_    interface{} `orm_table_name:"unknown_rules"`
+	}
+	assert.True(t, errors.Is(ValidateForCreate(&UnknownRuleDTO{Name: "x"}), ErrUnknownRule))
+
+	diags := Validate(&UnknownRuleDTO{}, &SignupDTO{})
+	if assert.Len(t, diags, 2) {
+		assert.Equal(t, DiagUnknownRule, diags[0].Kind)
+		assert.Equal(t, Diagnostic{Struct: "SignupDTO", Field: "Notes", Kind: DiagMisplacedTag,
+			Message: "orm_validate is used only for fields with orm_use_in, it is ignored"}, diags[1])
+	}
+}
@@ -0,0 +1,281 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// tagOrmValidate - rules of value of field, which are checked by ValidateForCreate, ValidateForUpdate:
+// `db:"email" orm_use_in:"create,update" orm_validate:"required,max=255,email"`.
+// Built-in rules: required, min=N, max=N, len=N (length of string, slice, map or value of number),
+// email, oneof=a b c. Custom rules are added by RegisterRule.
+const tagOrmValidate = "orm_validate"
+
+const (
+	rulesSeparator     = ","
+	ruleParamSeparator = "="
+)
+
+// ErrUnknownRule - orm_validate tag has rule which is not registered.
+var ErrUnknownRule = errors.New("orm: unknown validation rule")
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{
+		"required": ruleRequired,
+		"min":      ruleMin,
+		"max":      ruleMax,
+		"len":      ruleLen,
+		"email":    ruleEmail,
+		"oneof":    ruleOneOf,
+	}
+)
+
+type (
+	// Rule - validation rule of orm_validate tag, return true if value satisfies rule, param - text after "="
+	// ("255" of "max=255"). Value is value of field: pointers are dereferenced, driver.Valuer is replaced
+	// by its Value. Nil values (nil pointers, NULL Valuers) are checked only by "required",
+	// other rules of field are not checked if "required" is not satisfied.
+	Rule func(value interface{}, param string) bool
+
+	// ValidationError - value of field violates rule of orm_validate tag.
+	ValidationError struct {
+		Field  string // path of field, e.g. "BaseDTO.Email"
+		Column Column
+		Rule   string
+		Param  string
+	}
+
+	// ValidationErrors - all violations of rules of DTO, it is error.
+	ValidationErrors []ValidationError
+
+	ruleCall struct {
+		name  string
+		param string
+	}
+)
+
+func (e ValidationError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("%s: %s", e.Column, e.Rule)
+	}
+
+	return fmt.Sprintf("%s: %s=%s", e.Column, e.Rule, e.Param)
+}
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return "orm: validation failed: " + strings.Join(msgs, diagsSeparator)
+}
+
+// RegisterRule add (or replace) rule of orm_validate tag, e.g. RegisterRule("slug", isSlug) for `orm_validate:"slug"`.
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules[name] = rule
+}
+
+func getRule(name string) (Rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	rule, found := rules[name]
+
+	return rule, found
+}
+
+// ValidateForCreate check rules of create fields (see GetDataForCreate), return ValidationErrors
+// or nil if all rules are satisfied. ErrUnknownRule is returned for rule which is not registered.
+func ValidateForCreate(obj interface{}) error {
+	return validateFields(obj, ormUseInCreate, nil)
+}
+
+// ValidateForUpdate check rules of update fields like ValidateForCreate,
+// zero fields with orm_omitempty are not checked (they are not updated).
+func ValidateForUpdate(obj interface{}) error {
+	return validateFields(obj, ormUseInUpdate, func(f fieldMeta, v reflect.Value) bool {
+		return !f.omitEmpty || !v.IsZero()
+	})
+}
+
+// ValidateForUpdateMask check rules of update fields of mask (see GetDataForUpdateMask).
+func ValidateForUpdateMask(obj interface{}, mask []string) error {
+	masked, err := maskedFields(obj, mask)
+	if err != nil {
+		return err
+	}
+
+	return validateFields(obj, ormUseInUpdate, func(f fieldMeta, _ reflect.Value) bool { return masked[f.path] })
+}
+
+func validateFields(
+	obj interface{},
+	useInTag ormUseInTagValue,
+	include func(f fieldMeta, v reflect.Value) bool,
+) error {
+	v, ok := objValue(obj)
+	if !ok {
+		return nil
+	}
+
+	var errs ValidationErrors
+
+	for _, f := range getTypeMeta(obj).fields[useInTag] {
+		if len(f.rules) == 0 {
+			continue
+		}
+
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (include != nil && !include(f, fv)) {
+			continue
+		}
+
+		val, err := ruleValue(fv)
+		if err != nil {
+			return fmt.Errorf("orm: value of %s: %w", f.path, err)
+		}
+
+		for _, call := range f.rules {
+			rule, found := getRule(call.name)
+			if !found {
+				return fmt.Errorf("%w: %s of %s", ErrUnknownRule, call.name, f.path)
+			}
+
+			if (val == nil && call.name != "required") || rule(val, call.param) {
+				continue
+			}
+
+			errs = append(errs, ValidationError{Field: f.path, Column: f.column, Rule: call.name, Param: call.param})
+			if call.name == "required" {
+				break // other rules of missing value are not reported
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// ruleValue return value of field for Rule: dereferenced value, Value of driver.Valuer, nil for nil pointer.
+func ruleValue(v reflect.Value) (interface{}, error) {
+	val := value(v)
+	if valuer, ok := val.(driver.Valuer); ok {
+		return valuer.Value()
+	}
+
+	return val, nil
+}
+
+// parseRules parse value of orm_validate tag: "required,max=255".
+func parseRules(tag string) []ruleCall {
+	if isTagEmpty(tag) {
+		return nil
+	}
+
+	var calls []ruleCall
+	for _, s := range strings.Split(tag, rulesSeparator) {
+		name, param := strings.TrimSpace(s), ""
+		if i := strings.Index(name, ruleParamSeparator); i >= 0 {
+			name, param = strings.TrimSpace(name[:i]), strings.TrimSpace(name[i+1:])
+		}
+
+		if name != "" {
+			calls = append(calls, ruleCall{name: name, param: param})
+		}
+	}
+
+	return calls
+}
+
+func ruleRequired(value interface{}, _ string) bool {
+	if value == nil {
+		return false
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() > 0
+	}
+
+	return !v.IsZero()
+}
+
+func ruleMin(value interface{}, param string) bool {
+	size, ok := ruleSize(value)
+	limit, err := strconv.ParseFloat(param, 64)
+
+	return ok && err == nil && size >= limit
+}
+
+func ruleMax(value interface{}, param string) bool {
+	size, ok := ruleSize(value)
+	limit, err := strconv.ParseFloat(param, 64)
+
+	return ok && err == nil && size <= limit
+}
+
+func ruleLen(value interface{}, param string) bool {
+	size, ok := ruleSize(value)
+	limit, err := strconv.ParseFloat(param, 64)
+
+	return ok && err == nil && size == limit
+}
+
+// ruleSize return length of string (in runes), slice, map, array or value of number.
+func ruleSize(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+
+	return 0, false
+}
+
+// ruleEmail - value is address without display name, e.g. "bob@example.com".
+func ruleEmail(value interface{}, _ string) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(s)
+
+	return err == nil && addr.Address == s
+}
+
+// ruleOneOf - value is one of words of param: `orm_validate:"oneof=new paid"`.
+func ruleOneOf(value interface{}, param string) bool {
+	s := fmt.Sprint(value)
+	for _, word := range strings.Fields(param) {
+		if word == s {
+			return true
+		}
+	}
+
+	return false
+}
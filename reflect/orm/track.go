@@ -0,0 +1,166 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+)
+
+var (
+	// ErrNotTracked - DTO was not tracked by Track (or was untracked).
+	ErrNotTracked = errors.New("orm: DTO is not tracked")
+	// ErrNotTrackable - only not nil pointers to structs with Tracking field are tracked.
+	ErrNotTrackable = errors.New("orm: DTO must be not nil pointer to struct with orm.Tracking field")
+
+	trackingType = reflect.TypeOf(Tracking{})
+)
+
+type (
+	// Tracking - snapshot of DTO taken by Track, DTO is trackable if it has exported field of this type
+	// (usually embedded). Snapshot is kept in DTO, so it is collected with DTO.
+	//
+	//	type User struct {
+	//		orm.Tracking
+	//		ID   int64  `db:"id"   orm_use_in:"select"`
+	//		Name string `db:"name" orm_use_in:"select,update"`
+	//	}
+	Tracking struct {
+		snap snapshot
+	}
+
+	// snapshot - values of update columns, driver.Valuer (and orm_json) values are stored as result of Value.
+	snapshot map[Column]interface{}
+)
+
+// Track record values of update columns of DTO (pointer to struct with Tracking field) in its Tracking field,
+// Changes return columns changed since Track. Repeated Track replaces snapshot.
+//
+//	_ = repo.Get(ctx, id, &user)
+//	_ = orm.Track(&user)
+//	user.Name = "new"
+//	changes, _ := orm.Changes(&user) // map[name:new]
+func Track(obj interface{}) error {
+	tracking, err := trackingOf(obj)
+	if err != nil {
+		return err
+	}
+
+	snap, err := takeSnapshot(obj)
+	if err != nil {
+		return err
+	}
+
+	tracking.snap = snap
+
+	return nil
+}
+
+// Untrack remove snapshot of DTO.
+func Untrack(obj interface{}) {
+	if tracking, err := trackingOf(obj); err == nil {
+		tracking.snap = nil
+	}
+}
+
+// Changes return update columns of DTO which are changed since Track (empty map if nothing is changed),
+// ErrNotTracked if DTO is not tracked. Columns of embedded pointer struct which became nil are not returned.
+func Changes(obj interface{}) (map[Column]Argument, error) {
+	tracking, err := trackingOf(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if tracking.snap == nil {
+		return nil, ErrNotTracked
+	}
+
+	cols, args := getData(obj, ormUseInUpdate, nil)
+
+	changes := make(map[Column]Argument)
+	for i, col := range cols {
+		value, err := snapshotValue(args[i])
+
+		prev, found := tracking.snap[col]
+		if err != nil || !found || !reflect.DeepEqual(prev, value) {
+			changes[col] = args[i]
+		}
+	}
+
+	return changes, nil
+}
+
+// trackingOf return Tracking field of DTO.
+func trackingOf(obj interface{}) (*Tracking, error) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, ErrNotTrackable
+	}
+
+	index := getTypeMeta(obj).tracking
+	if index == nil {
+		return nil, ErrNotTrackable
+	}
+
+	return v.Elem().FieldByIndex(index).Addr().Interface().(*Tracking), nil
+}
+
+// trackingIndex return index path of exported Tracking field of struct t (or of its embedded structs), nil if
+// there is no such field.
+func trackingIndex(t reflect.Type) []int {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath == "" && field.Type == trackingType {
+			return []int{i}
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.PkgPath == "" && field.Type.Kind() == reflect.Struct {
+			if index := trackingIndex(field.Type); index != nil {
+				return append([]int{i}, index...)
+			}
+		}
+	}
+
+	return nil
+}
+
+func takeSnapshot(obj interface{}) (snapshot, error) {
+	cols, args := getData(obj, ormUseInUpdate, nil)
+
+	snap := make(snapshot, len(cols))
+	for i, col := range cols {
+		value, err := snapshotValue(args[i])
+		if err != nil {
+			return nil, err
+		}
+
+		snap[col] = value
+	}
+
+	return snap, nil
+}
+
+// snapshotValue return copy of argument which is not changed by changes of DTO: Encrypted is replaced by
+// its plain value, driver.Valuer (JSON of orm_json fields, pointers of pointer receivers) is replaced
+// by its Value, []byte is copied.
+func snapshotValue(arg Argument) (interface{}, error) {
+	if e, ok := arg.(Encrypted); ok {
+		arg = e.V // ciphertexts of the same value are different
+	}
+
+	if valuer, ok := arg.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return nil, err
+		}
+		arg = value
+	}
+
+	if b, ok := arg.([]byte); ok {
+		return append([]byte(nil), b...), nil
+	}
+
+	return arg, nil
+}
@@ -0,0 +1,327 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Kinds of Diagnostic.
+const (
+	DiagNotStruct       DiagnosticKind = "not_struct"       // DTO is not struct or pointer to struct
+	DiagUnknownTag      DiagnosticKind = "unknown_tag"      // orm_* tag key is unknown (e.g. orm_use_for)
+	DiagUnknownUseIn    DiagnosticKind = "unknown_use_in"   // orm_use_in value is not select, create or update
+	DiagMissingDBTag    DiagnosticKind = "missing_db_tag"   // field with orm_use_in has no db tag, it is skipped
+	DiagDuplicateColumn DiagnosticKind = "duplicate_column" // column is used by several fields
+	DiagMisplacedTag    DiagnosticKind = "misplaced_tag"    // orm_table_name, orm_join, orm_omitempty on wrong field
+	DiagUnaddressable   DiagnosticKind = "unaddressable"    // unexported struct, its columns are lost
+	DiagMalformedTag    DiagnosticKind = "malformed_tag"    // struct tag is not `key:"value"` pairs
+	DiagMissingJoin     DiagnosticKind = "missing_join"     // part of composite DTO has no join condition
+	DiagUnknownRule     DiagnosticKind = "unknown_rule"     // orm_validate rule is not registered (see RegisterRule)
+
+	DiagMissingTableName DiagnosticKind = "missing_table_name" // DTO has no orm_table_name, its table is Undefined
+)
+
+const (
+	tagOrmPrefix     = "orm_"
+	useInSeparator   = ","
+	pathSeparator    = "."
+	diagsSeparator   = "; "
+	diagsErrorPrefix = "orm: invalid DTO: "
+)
+
+// knownOrmTags - tag keys which are used by orm.
+var knownOrmTags = map[string]bool{
+	tagOrmUseIN:     true,
+	tagOrmAlias:     true,
+	tagOrmJoin:      true,
+	tagOrmTableName: true,
+	tagOrmJSON:      true,
+	tagOrmOmitEmpty: true,
+	tagOrmEncrypt:   true,
+	tagOrmValidate:  true,
+}
+
+type (
+	// DiagnosticKind - kind of problem of orm metadata.
+	DiagnosticKind string
+
+	// Diagnostic - problem of orm metadata of DTO.
+	Diagnostic struct {
+		Struct  Typ    // name of DTO type
+		Field   string // path of field, e.g. "BaseDTO.ID", empty for problems of whole DTO
+		Kind    DiagnosticKind
+		Message string
+	}
+
+	// Diagnostics - problems of orm metadata, it is error.
+	Diagnostics []Diagnostic
+)
+
+func (d Diagnostic) String() string {
+	if d.Field == "" {
+		return fmt.Sprintf("%s: %s: %s", d.Struct, d.Kind, d.Message)
+	}
+
+	return fmt.Sprintf("%s.%s: %s: %s", d.Struct, d.Field, d.Kind, d.Message)
+}
+
+func (d Diagnostics) Error() string {
+	msgs := make([]string, len(d))
+	for i, diag := range d {
+		msgs[i] = diag.String()
+	}
+
+	return diagsErrorPrefix + strings.Join(msgs, diagsSeparator)
+}
+
+// Validate check orm tags of DTOs, return nil if there are no problems. Nil objs are skipped.
+func Validate(objs ...interface{}) Diagnostics {
+	var diags Diagnostics
+
+	for _, obj := range objs {
+		if obj == nil {
+			continue
+		}
+
+		diags = append(diags, validateObj(obj)...)
+	}
+
+	return diags
+}
+
+// InitMetaTagInfoCacheStrict - InitMetaTagInfoCache which fails fast: objs are validated by Validate,
+// if any problem is found, Diagnostics are returned and cache is not changed.
+func InitMetaTagInfoCacheStrict(objs ...interface{}) error {
+	if diags := Validate(objs...); len(diags) > 0 {
+		return diags
+	}
+
+	InitMetaTagInfoCache(objs...)
+
+	return nil
+}
+
+func validateObj(obj interface{}) Diagnostics {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return Diagnostics{{Struct: t.String(), Kind: DiagNotStruct, Message: "DTO must be struct or pointer to struct"}}
+	}
+
+	v := &validator{structName: t.Name()}
+	v.walk(t, "", nil)
+
+	tm := newTypeMeta(t)
+	meta := tm.meta
+
+	if meta.JoinCond == Undefined && meta.TableName == Undefined {
+		v.add("", DiagMissingTableName, "DTO has no field `_` with %s tag", tagOrmTableName)
+	}
+
+	useIns := []ormUseInTagValue{ormUseInSelect, ormUseInCreate, ormUseInUpdate}
+	if meta.JoinCond != Undefined {
+		useIns = useIns[:1] // composite DTO is used only for select, columns of its parts are aliased
+
+		parts := tm.joinParts
+		if len(parts) < 2 {
+			v.add("", DiagMissingJoin, "composite DTO must have at least two parts with %s, got %d",
+				tagOrmTableName, len(parts))
+		}
+		for i, part := range parts {
+			if i > 0 && part.On == Undefined {
+				v.add("", DiagMissingJoin, "part %s as %s has no %s condition", part.Table, part.Alias, tagOrmJoin)
+			}
+		}
+	}
+
+	for _, useIn := range useIns {
+		cols := meta.ColsMap[useIn]
+
+		seen := map[Column]bool{}
+		for _, col := range cols {
+			if seen[col] {
+				v.add("", DiagDuplicateColumn, "column %q is used several times in %s", col, useIn)
+			}
+			seen[col] = true
+		}
+	}
+
+	return v.diags
+}
+
+type validator struct {
+	structName Typ
+	diags      Diagnostics
+}
+
+func (v *validator) add(field string, kind DiagnosticKind, format string, args ...interface{}) {
+	v.diags = append(v.diags, Diagnostic{
+		Struct:  v.structName,
+		Field:   field,
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// walk check fields of struct t the same way as getMetaInfoUseInTag collects columns.
+func (v *validator) walk(t reflect.Type, path string, parents []reflect.Type) {
+	parents = append(parents[:len(parents):len(parents)], t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + pathSeparator + field.Name
+		}
+
+		v.checkTags(field, fieldPath)
+
+		if useIn := field.Tag.Get(tagOrmUseIN); !isTagEmpty(useIn) {
+			for _, value := range strings.Split(useIn, useInSeparator) {
+				switch strings.TrimSpace(value) {
+				case ormUseInSelect, ormUseInCreate, ormUseInUpdate:
+				default:
+					v.add(fieldPath, DiagUnknownUseIn, "unknown %s value %q", tagOrmUseIN, value)
+				}
+			}
+
+			if isTagEmpty(field.Tag.Get(tagDB)) && field.Name != underscored {
+				v.add(fieldPath, DiagMissingDBTag, "field with %s has no %s tag, it is skipped", tagOrmUseIN, tagDB)
+			}
+
+			if EncryptKeyName(field) != "" && !IsJSONField(field) && !isEncryptable(field.Type) {
+				v.add(fieldPath, DiagMisplacedTag, "%s is used only for string, []byte or %s fields, got %s",
+					tagOrmEncrypt, tagOrmJSON, field.Type)
+			}
+
+			if !isTagEmpty(field.Tag.Get(tagOrmOmitEmpty)) && !strings.Contains(useIn, ormUseInUpdate) {
+				v.add(fieldPath, DiagMisplacedTag, "%s is used only for %s fields, it is ignored",
+					tagOrmOmitEmpty, ormUseInUpdate)
+			}
+
+			for _, call := range parseRules(field.Tag.Get(tagOrmValidate)) {
+				if _, found := getRule(call.name); !found {
+					v.add(fieldPath, DiagUnknownRule, "unknown %s rule %q", tagOrmValidate, call.name)
+				}
+			}
+
+			continue
+		}
+
+		nested, ok := nestedStruct(field)
+		switch {
+		case !ok || containsType(parents, nested):
+		case field.PkgPath == "":
+			v.walk(nested, fieldPath, parents)
+		case hasOrmFields(nested, nil):
+			v.add(fieldPath, DiagUnaddressable, "unexported struct field, its columns are skipped")
+		}
+	}
+}
+
+func (v *validator) checkTags(field reflect.StructField, fieldPath string) {
+	keys, ok := tagKeys(field.Tag)
+	if !ok {
+		v.add(fieldPath, DiagMalformedTag, "can't parse tag `%s`", field.Tag)
+	}
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, tagOrmPrefix) && !knownOrmTags[key] {
+			v.add(fieldPath, DiagUnknownTag, "unknown tag %s", key)
+		}
+	}
+
+	if !isTagEmpty(field.Tag.Get(tagOrmTableName)) && field.Name != underscored {
+		v.add(fieldPath, DiagMisplacedTag, "%s is used only on field `_`, it is ignored", tagOrmTableName)
+	}
+
+	if !isTagEmpty(field.Tag.Get(tagOrmValidate)) && isTagEmpty(field.Tag.Get(tagOrmUseIN)) {
+		v.add(fieldPath, DiagMisplacedTag, "%s is used only for fields with %s, it is ignored",
+			tagOrmValidate, tagOrmUseIN)
+	}
+
+	// orm_join of part of composite DTO is its join condition
+	if !isTagEmpty(field.Tag.Get(tagOrmJoin)) && field.Name != underscored && field.Type.Kind() != reflect.Struct {
+		v.add(fieldPath, DiagMisplacedTag, "%s is used only on field `_` or part of composite DTO, it is ignored",
+			tagOrmJoin)
+	}
+}
+
+// isEncryptable - type of field can be encrypted: string, []byte, pointers to them, driver.Valuer.
+func isEncryptable(t reflect.Type) bool {
+	if t.Implements(valuerType) || reflect.PtrTo(t).Implements(valuerType) {
+		return true
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+}
+
+// hasOrmFields - struct t (or nested structs) has fields with orm_use_in.
+func hasOrmFields(t reflect.Type, parents []reflect.Type) bool {
+	parents = append(parents[:len(parents):len(parents)], t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !isTagEmpty(field.Tag.Get(tagOrmUseIN)) {
+			return true
+		}
+
+		if nested, ok := nestedStruct(field); ok && !containsType(parents, nested) && hasOrmFields(nested, parents) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tagKeys return keys of struct tag (conventional format `key:"value" key2:"value2"`),
+// false if tag is malformed. Parsing is the same as in reflect.StructTag.Lookup.
+func tagKeys(tag reflect.StructTag) ([]string, bool) {
+	var keys []string
+
+	for tag != "" {
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return keys, false
+		}
+		name := string(tag[:i])
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return keys, false
+		}
+		tag = tag[i+1:]
+
+		keys = append(keys, name)
+	}
+
+	return keys, true
+}
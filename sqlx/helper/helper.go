@@ -2,8 +2,12 @@ package helper
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
 // InsertAndGetLastID helper which Usefully for sql query like this
@@ -13,3 +17,44 @@ func InsertAndGetLastID(ctx context.Context, lastInsertID interface{}, query str
 		return t.QueryRowContext(ctx, query, args...).Scan(lastInsertID)
 	}
 }
+
+// StatementTimeout set Postgres statement_timeout for rest of transaction (SET LOCAL), see StatementTimeoutQuery.
+func StatementTimeout(ctx context.Context, timeout time.Duration) TxFn {
+	query := StatementTimeoutQuery(timeout)
+
+	return func(t *sqlx.Tx) error {
+		_, err := t.ExecContext(ctx, query)
+		return errors.Wrap(err, "[StatementTimeout]")
+	}
+}
+
+// StatementTimeoutQuery return SET LOCAL statement_timeout query, timeout is rounded up to milliseconds,
+// Postgres treats 0 as no timeout, so it is at least 1ms.
+func StatementTimeoutQuery(timeout time.Duration) string {
+	ms := (timeout + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	}
+
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)
+}
+
+// EncodePayload encode payload of event or notification: string and []byte are used as is,
+// other values are encoded to JSON, nil is empty payload.
+func EncodePayload(payload interface{}) (string, error) {
+	switch p := payload.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return p, nil
+	case []byte:
+		return string(p), nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.Wrap(err, "[EncodePayload] json.Marshal")
+	}
+
+	return string(data), nil
+}
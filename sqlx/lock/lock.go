@@ -0,0 +1,215 @@
+// Package lock - distributed locks by Postgres advisory locks.
+// String keys are mapped to advisory lock ids by ID (64-bit FNV-1a hash).
+//
+// Session locks (Locker) are held by dedicated connection until Unlock, transaction locks (LockTx, TryLockTx)
+// are released automatically by commit or rollback.
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+// unlockTimeout - timeout of unlock in WithLock, lock is released even if ctx of caller is canceled.
+const unlockTimeout = 10 * time.Second
+
+var (
+	// ErrLocked - lock is held by another session or transaction.
+	ErrLocked = errors.New("lock: key is locked")
+	// ErrAlreadyHeld - lock is already held by this Locker.
+	ErrAlreadyHeld = errors.New("lock: key is already held by this locker")
+	// ErrNotHeld - Unlock of key which is not held by this Locker.
+	ErrNotHeld = errors.New("lock: key is not held by this locker")
+)
+
+type (
+	// DB - pool of connections (e.g. *sqlx.DB or *sql.DB).
+	DB interface {
+		Conn(ctx context.Context) (*sql.Conn, error)
+	}
+
+	// Locker - session advisory locks, each held key uses own connection from pool.
+	// If connection is lost, Postgres releases lock, so long jobs should not rely on lock forever.
+	Locker struct {
+		db   DB
+		mu   sync.Mutex
+		held map[string]*sql.Conn
+	}
+)
+
+// ID return advisory lock id of key.
+func ID(key string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	return int64(h.Sum64())
+}
+
+// New - constructor of Locker.
+func New(db DB) *Locker {
+	return &Locker{db: db, held: map[string]*sql.Conn{}}
+}
+
+// TryLock try acquire lock of key without waiting, return false if it is held by another session.
+func (l *Locker) TryLock(ctx context.Context, key string) (bool, error) {
+	err := l.lock(ctx, key, "SELECT pg_try_advisory_lock($1)")
+	switch errors.Cause(err) {
+	case nil:
+		return true, nil
+	case ErrLocked, ErrAlreadyHeld:
+		return false, nil
+	}
+
+	return false, errors.WithMessage(err, "[lock.TryLock]")
+}
+
+// Lock acquire lock of key, wait until it is released by another session or ctx is done.
+func (l *Locker) Lock(ctx context.Context, key string) error {
+	return errors.WithMessage(l.lock(ctx, key, "SELECT pg_advisory_lock($1)"), "[lock.Lock]")
+}
+
+func (l *Locker) lock(ctx context.Context, key string, query string) error {
+	l.mu.Lock()
+	if _, found := l.held[key]; found {
+		l.mu.Unlock()
+		return ErrAlreadyHeld
+	}
+	l.held[key] = nil // reserve key while waiting
+	l.mu.Unlock()
+
+	conn, err := l.acquire(ctx, key, query)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err != nil {
+		delete(l.held, key)
+		return err
+	}
+
+	l.held[key] = conn
+
+	return nil
+}
+
+func (l *Locker) acquire(ctx context.Context, key string, query string) (*sql.Conn, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "db.Conn")
+	}
+
+	// pg_advisory_lock returns void, so scan into interface
+	var locked interface{}
+	if err = conn.QueryRowContext(ctx, query, ID(key)).Scan(&locked); err != nil {
+		discard(conn)
+		return nil, errors.Wrap(err, "acquire")
+	}
+
+	if b, ok := locked.(bool); ok && !b {
+		_ = conn.Close()
+		return nil, ErrLocked
+	}
+
+	return conn, nil
+}
+
+// Unlock release lock of key held by this Locker.
+func (l *Locker) Unlock(ctx context.Context, key string) error {
+	l.mu.Lock()
+	conn := l.held[key]
+	if conn == nil {
+		l.mu.Unlock()
+		return ErrNotHeld
+	}
+	delete(l.held, key)
+	l.mu.Unlock()
+
+	var unlocked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", ID(key)).Scan(&unlocked); err != nil {
+		discard(conn) // session is closed, so lock is released by Postgres
+		return errors.Wrap(err, "[lock.Unlock]")
+	}
+
+	_ = conn.Close()
+
+	if !unlocked {
+		return errors.WithMessage(ErrNotHeld, "[lock.Unlock] lock was lost")
+	}
+
+	return nil
+}
+
+// discard close connection instead of return it to pool.
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	_ = conn.Close()
+}
+
+// WithLock execute fn under lock of key (waits lock).
+func (l *Locker) WithLock(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	if err := l.Lock(ctx, key); err != nil {
+		return err
+	}
+
+	return l.run(ctx, key, fn)
+}
+
+// WithTryLock execute fn under lock of key if lock is free, return false if fn was not executed.
+func (l *Locker) WithTryLock(ctx context.Context, key string, fn func(ctx context.Context) error) (bool, error) {
+	ok, err := l.TryLock(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, l.run(ctx, key, fn)
+}
+
+func (l *Locker) run(ctx context.Context, key string, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+
+		if errU := l.Unlock(unlockCtx, key); errU != nil && err == nil {
+			err = errU
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// LockTx return TxFn which acquire transaction lock of key (waits lock), it is released by commit or rollback.
+func LockTx(ctx context.Context, key string) helper.TxFn {
+	return func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", ID(key)); err != nil {
+			return errors.Wrap(err, "[lock.LockTx]")
+		}
+
+		return nil
+	}
+}
+
+// TryLockTx return TxFn which try acquire transaction lock of key, return ErrLocked if lock is busy
+// (so next TxFns are not executed and transaction is rolled back).
+func TryLockTx(ctx context.Context, key string) helper.TxFn {
+	return func(tx *sqlx.Tx) error {
+		var locked bool
+		if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", ID(key)).Scan(&locked); err != nil {
+			return errors.Wrap(err, "[lock.TryLockTx]")
+		}
+
+		if !locked {
+			return ErrLocked
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,340 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+// advisory - fake of Postgres advisory locks, sessions are driver connections.
+type (
+	advisory struct {
+		mu     sync.Mutex
+		cond   *sync.Cond
+		owners map[int64]*fakeConn
+		counts map[int64]int
+	}
+
+	fakeDriver struct{ a *advisory }
+
+	fakeConn struct {
+		a        *advisory
+		xact     []int64
+		inTx     bool
+		isClosed bool
+	}
+
+	fakeRows struct {
+		value driver.Value
+		done  bool
+	}
+)
+
+func newAdvisory() *advisory {
+	a := &advisory{owners: map[int64]*fakeConn{}, counts: map[int64]int{}}
+	a.cond = sync.NewCond(&a.mu)
+
+	return a
+}
+
+func (a *advisory) try(c *fakeConn, id int64) bool {
+	if owner, found := a.owners[id]; found && owner != c {
+		return false
+	}
+
+	a.owners[id] = c
+	a.counts[id]++
+
+	return true
+}
+
+func (a *advisory) release(c *fakeConn, id int64) bool {
+	if a.owners[id] != c {
+		return false
+	}
+
+	if a.counts[id]--; a.counts[id] == 0 {
+		delete(a.owners, id)
+		delete(a.counts, id)
+	}
+	a.cond.Broadcast()
+
+	return true
+}
+
+func (a *advisory) releaseAll(c *fakeConn) {
+	for id, owner := range a.owners {
+		if owner == c {
+			delete(a.owners, id)
+			delete(a.counts, id)
+		}
+	}
+	a.cond.Broadcast()
+}
+
+func (a *advisory) locked(id int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, found := a.owners[id]
+
+	return found
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{a: d.a}, nil
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	c.a.mu.Lock()
+	defer c.a.mu.Unlock()
+
+	c.isClosed = true
+	c.a.releaseAll(c)
+
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.inTx = true
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return c.endTx()
+}
+
+func (c *fakeConn) Rollback() error {
+	return c.endTx()
+}
+
+func (c *fakeConn) endTx() error {
+	c.a.mu.Lock()
+	defer c.a.mu.Unlock()
+
+	for _, id := range c.xact {
+		c.a.release(c, id)
+	}
+	c.xact, c.inTx = nil, false
+
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.QueryContext(ctx, query, args); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	id := args[0].Value.(int64)
+	fn := query[strings.Index(query, "pg_"):strings.Index(query, "(")]
+
+	c.a.mu.Lock()
+	defer c.a.mu.Unlock()
+
+	switch fn {
+	case "pg_try_advisory_lock":
+		return &fakeRows{value: c.a.try(c, id)}, nil
+
+	case "pg_try_advisory_xact_lock":
+		ok := c.a.try(c, id)
+		if ok {
+			c.xact = append(c.xact, id)
+		}
+		return &fakeRows{value: ok}, nil
+
+	case "pg_advisory_lock", "pg_advisory_xact_lock":
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.a.mu.Lock()
+				c.a.cond.Broadcast()
+				c.a.mu.Unlock()
+			case <-stop:
+			}
+		}()
+
+		for !c.a.try(c, id) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			c.a.cond.Wait()
+		}
+
+		if fn == "pg_advisory_xact_lock" {
+			c.xact = append(c.xact, id)
+		}
+
+		return &fakeRows{value: nil}, nil
+
+	case "pg_advisory_unlock":
+		return &fakeRows{value: c.a.release(c, id)}, nil
+	}
+
+	return nil, errors.Errorf("unknown function %s", fn)
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"result"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done, dest[0] = true, r.value
+
+	return nil
+}
+
+var (
+	registerOnce sync.Once
+	fakeLocks    = newAdvisory()
+)
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	registerOnce.Do(func() { sql.Register("fake_advisory", fakeDriver{a: fakeLocks}) })
+
+	db, err := sqlx.Open("fake_advisory", "")
+	assert.Nil(t, err)
+
+	return db
+}
+
+func TestID(t *testing.T) {
+	assert.Equal(t, ID("cron:report"), ID("cron:report"))
+	assert.NotEqual(t, ID("cron:report"), ID("cron:cleanup"))
+}
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	replica1, replica2 := New(db), New(db)
+
+	ok, err := replica1.TryLock(ctx, "cron")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, fakeLocks.locked(ID("cron")))
+
+	ok, err = replica1.TryLock(ctx, "cron")
+	assert.Nil(t, err)
+	assert.False(t, ok, "already held")
+	assert.Equal(t, ErrAlreadyHeld, errors.Cause(replica1.Lock(ctx, "cron")))
+
+	ok, err = replica2.TryLock(ctx, "cron")
+	assert.Nil(t, err)
+	assert.False(t, ok, "held by another session")
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, replica2.Lock(ctxTimeout, "cron"), "wait until ctx is done")
+
+	locked := make(chan struct{})
+	go func() {
+		assert.Nil(t, replica2.Lock(ctx, "cron"))
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("lock is held by replica1")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.Nil(t, replica1.Unlock(ctx, "cron"))
+	assert.Equal(t, ErrNotHeld, errors.Cause(replica1.Unlock(ctx, "cron")))
+
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("lock is not acquired after unlock")
+	}
+
+	assert.Nil(t, replica2.Unlock(ctx, "cron"))
+	assert.False(t, fakeLocks.locked(ID("cron")))
+}
+
+func TestLocker_WithLock(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	replica1, replica2 := New(db), New(db)
+	errJob := errors.New("job failed")
+
+	err := replica1.WithLock(ctx, "job", func(ctx context.Context) error {
+		executed, err := replica2.WithTryLock(ctx, "job", func(ctx context.Context) error {
+			t.Fatal("must not be executed")
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.False(t, executed)
+
+		return errJob
+	})
+	assert.Equal(t, errJob, err)
+	assert.False(t, fakeLocks.locked(ID("job")), "unlocked after error")
+
+	executed, err := replica2.WithTryLock(ctx, "job", func(ctx context.Context) error { return nil })
+	assert.Nil(t, err)
+	assert.True(t, executed)
+	assert.False(t, fakeLocks.locked(ID("job")))
+}
+
+func TestLockTx(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	inTx := func(tx *sqlx.Tx) error {
+		assert.True(t, fakeLocks.locked(ID("tx")))
+
+		ok, err := New(db).TryLock(ctx, "tx")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		// TryLockTx in another transaction
+		err = helper.WithTransaction(ctx, nil, db, TryLockTx(ctx, "tx"), func(*sqlx.Tx) error {
+			t.Fatal("must not be executed")
+			return nil
+		})
+		assert.Equal(t, ErrLocked, errors.Cause(err))
+
+		return nil
+	}
+
+	assert.Nil(t, helper.WithTransaction(ctx, nil, db, LockTx(ctx, "tx"), inTx))
+	assert.False(t, fakeLocks.locked(ID("tx")), "released by commit")
+
+	assert.NotNil(t, helper.WithTransaction(ctx, nil, db, TryLockTx(ctx, "tx"), inTx,
+		func(*sqlx.Tx) error { return errors.New("rollback") }))
+	assert.False(t, fakeLocks.locked(ID("tx")), "released by rollback")
+}
@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ContentType - content type of Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ServeHTTP serve metrics in Prometheus text format.
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+
+	if err := m.WriteMetrics(w); err != nil {
+		m.logger.Warn("[monitor.ServeHTTP] write metrics", zap.Error(err))
+	}
+}
+
+// HealthHandler return http.Handler which responds 200 if last ping succeeded, otherwise 503 with error.
+func (m *Monitor) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		health := m.Health()
+		if !health.Up {
+			msg := "db was not pinged"
+			if health.Err != nil {
+				msg = health.Err.Error()
+			}
+
+			http.Error(w, msg, http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = io.WriteString(w, "ok")
+	})
+}
+
+// WriteMetrics write health, pool statistics and query metrics in Prometheus text format.
+func (m *Monitor) WriteMetrics(out io.Writer) error {
+	w := &metricWriter{w: bufio.NewWriter(out), ns: m.opts.Namespace}
+
+	health := m.Health()
+	w.header("up", "gauge", "Whether last ping of database succeeded.")
+	w.sample("up", "", boolValue(health.Up))
+	w.header("ping_duration_seconds", "gauge", "Duration of last ping of database.")
+	w.sample("ping_duration_seconds", "", health.Duration.Seconds())
+
+	stats := m.DB.Stats()
+	w.gauge("pool_max_open_connections", "Maximum number of open connections to the database.",
+		float64(stats.MaxOpenConnections))
+	w.gauge("pool_open_connections", "The number of established connections both in use and idle.",
+		float64(stats.OpenConnections))
+	w.gauge("pool_in_use_connections", "The number of connections currently in use.", float64(stats.InUse))
+	w.gauge("pool_idle_connections", "The number of idle connections.", float64(stats.Idle))
+	w.counter("pool_wait_count_total", "The total number of connections waited for.", float64(stats.WaitCount))
+	w.counter("pool_wait_duration_seconds_total", "The total time blocked waiting for a new connection.",
+		stats.WaitDuration.Seconds())
+	w.counter("pool_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.",
+		float64(stats.MaxIdleClosed))
+	w.counter("pool_max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime.",
+		float64(stats.MaxIdleTimeClosed))
+	w.counter("pool_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.",
+		float64(stats.MaxLifetimeClosed))
+
+	m.writeQueryMetrics(w)
+
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.w.Flush()
+}
+
+func (m *Monitor) writeQueryMetrics(w *metricWriter) {
+	m.mu.RLock()
+	keys := make([]metricKey, 0, len(m.metrics))
+	metrics := make(map[metricKey]*queryMetric, len(m.metrics))
+	for key, metric := range m.metrics {
+		keys = append(keys, key)
+		metrics[key] = metric
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].repo != keys[j].repo {
+			return keys[i].repo < keys[j].repo
+		}
+		return keys[i].op < keys[j].op
+	})
+
+	w.header("queries_total", "counter", "The total number of queries by repository and operation.")
+	for _, key := range keys {
+		w.sample("queries_total", key.labels(), float64(atomic.LoadUint64(&metrics[key].count)))
+	}
+
+	w.header("query_errors_total", "counter", "The total number of failed queries by repository and operation.")
+	for _, key := range keys {
+		w.sample("query_errors_total", key.labels(), float64(atomic.LoadUint64(&metrics[key].errors)))
+	}
+
+	w.header("query_duration_seconds", "histogram", "Latency of queries by repository and operation.")
+	for _, key := range keys {
+		metric, labels := metrics[key], key.labels()
+
+		cumulative := uint64(0)
+		for i, le := range m.opts.Buckets {
+			cumulative += atomic.LoadUint64(&metric.buckets[i])
+			w.sample("query_duration_seconds_bucket", labels+`,le="`+formatFloat(le)+`"`, float64(cumulative))
+		}
+
+		count := atomic.LoadUint64(&metric.count)
+		w.sample("query_duration_seconds_bucket", labels+`,le="+Inf"`, float64(count))
+		w.sample("query_duration_seconds_sum", labels,
+			time.Duration(atomic.LoadUint64(&metric.sumNano)).Seconds())
+		w.sample("query_duration_seconds_count", labels, float64(count))
+	}
+}
+
+func (k metricKey) labels() string {
+	return `repo="` + labelEscaper.Replace(k.repo) + `",op="` + labelEscaper.Replace(k.op) + `"`
+}
+
+// metricWriter - writer of Prometheus text format, first error stops writing.
+type metricWriter struct {
+	w   *bufio.Writer
+	ns  string
+	err error
+}
+
+func (w *metricWriter) header(name, typ, help string) {
+	w.printf("# HELP %s_%s %s\n# TYPE %s_%s %s\n", w.ns, name, help, w.ns, name, typ)
+}
+
+func (w *metricWriter) sample(name, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+
+	w.printf("%s_%s%s %s\n", w.ns, name, labels, formatFloat(value))
+}
+
+func (w *metricWriter) gauge(name, help string, value float64) {
+	w.header(name, "gauge", help)
+	w.sample(name, "", value)
+}
+
+func (w *metricWriter) counter(name, help string, value float64) {
+	w.header(name, "counter", help)
+	w.sample(name, "", value)
+}
+
+func (w *metricWriter) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
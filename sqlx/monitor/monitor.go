@@ -0,0 +1,297 @@
+// Package monitor - health checking and metrics of database connection pool.
+//
+// Monitor wraps *sqlx.DB and implements repository.SqlxDBConnectorI, so it is passed to repository.NewSqlxMapRepo
+// instead of db. Queries are counted and timed per repository and operation (repository.OperationFromContext),
+// queries executed not by repository are reported with labels repo="unknown", op="unknown".
+// Begin of transaction is counted with op="tx", queries of repositories inside transactions are counted
+// like other queries (Monitor implements repository.TxConnector). Queries of repository.StmtCache wrapping Monitor
+// are counted too (Monitor implements repository.QueryObserver).
+// Metrics and pool statistics (sql.DBStats) are served in Prometheus text format by ServeHTTP:
+//
+//	mon := monitor.New(logger, db, monitor.Options{})
+//	go mon.Run(ctx)
+//	repos := repository.NewSqlxMapRepo(logger, mon, tables, objs)
+//	repos = repos.WithStmtCache(repository.NewStmtCache(mon, repository.StmtCacheOptions{})) // optional
+//	http.Handle("/metrics", mon)
+//	http.Handle("/health", mon.HealthHandler())
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository"
+)
+
+const (
+	NamespaceDefault    = "sqlx"           // NamespaceDefault - default prefix of metric names
+	PingIntervalDefault = 10 * time.Second // PingIntervalDefault - default interval between pings
+	PingTimeoutDefault  = 5 * time.Second  // PingTimeoutDefault - default timeout of ping
+
+	labelUnknown = "unknown"
+	opTx         = "tx"
+)
+
+// BucketsDefault - default buckets (seconds) of query latency histogram.
+var BucketsDefault = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	// DB - database pool (e.g. *sqlx.DB).
+	DB interface {
+		repository.SqlxDBConnectorI
+		PingContext(ctx context.Context) error
+		Stats() sql.DBStats
+		Conn(ctx context.Context) (*sql.Conn, error) // dedicated connection (CopyFrom, locks), it is not monitored
+	}
+
+	// Options - options of Monitor, zero values are replaced by defaults.
+	Options struct {
+		Namespace    string        // prefix of metric names
+		PingInterval time.Duration // interval between pings in Run
+		PingTimeout  time.Duration // timeout of one ping
+		Buckets      []float64     // upper bounds (seconds) of latency histogram buckets, sorted
+	}
+
+	// Health - result of last ping.
+	Health struct {
+		Up       bool
+		Err      error
+		At       time.Time
+		Duration time.Duration
+	}
+
+	// Monitor - SqlxDBConnectorI which collects metrics of queries and checks health of db.
+	Monitor struct {
+		DB
+		logger *zap.Logger
+		opts   Options
+
+		mu      sync.RWMutex
+		metrics map[metricKey]*queryMetric
+
+		healthMu sync.RWMutex
+		health   Health
+	}
+
+	metricKey struct {
+		repo string
+		op   string
+	}
+
+	queryMetric struct {
+		count   uint64
+		errors  uint64
+		buckets []uint64 // not cumulative, last - +Inf
+		sumNano uint64
+	}
+
+	// monitoredTx - transaction which collects metrics of queries like Monitor.
+	monitoredTx struct {
+		*sqlx.Tx
+		m *Monitor
+	}
+)
+
+// New - constructor of Monitor.
+func New(logger *zap.Logger, db DB, opts Options) *Monitor {
+	if opts.Namespace == "" {
+		opts.Namespace = NamespaceDefault
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = PingIntervalDefault
+	}
+	if opts.PingTimeout <= 0 {
+		opts.PingTimeout = PingTimeoutDefault
+	}
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = BucketsDefault
+	}
+
+	return &Monitor{
+		DB:      db,
+		logger:  logger,
+		opts:    opts,
+		metrics: map[metricKey]*queryMetric{},
+	}
+}
+
+// Run ping db every PingInterval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		_ = m.Ping(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ping check connection to db and save result (see Health).
+func (m *Monitor) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.opts.PingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := m.DB.PingContext(ctx)
+
+	health := Health{Up: err == nil, Err: err, At: start, Duration: time.Since(start)}
+
+	m.healthMu.Lock()
+	changed := m.health.Up != health.Up || m.health.At.IsZero()
+	m.health = health
+	m.healthMu.Unlock()
+
+	if err != nil {
+		m.logger.Error("[monitor.Ping] db is down", zap.Error(err))
+	} else if changed {
+		m.logger.Info("[monitor.Ping] db is up", zap.Duration("duration", health.Duration))
+	}
+
+	return err
+}
+
+// Health return result of last ping (zero Health if db was not pinged).
+func (m *Monitor) Health() Health {
+	m.healthMu.RLock()
+	defer m.healthMu.RUnlock()
+
+	return m.health
+}
+
+// observe count query (or begin of transaction) of operation from ctx.
+func (m *Monitor) observe(ctx context.Context, tx bool, start time.Time, err error) {
+	key := metricKey{repo: labelUnknown, op: labelUnknown}
+	if info, ok := repository.OperationFromContext(ctx); ok {
+		key = metricKey{repo: info.Repo, op: string(info.Op)}
+	}
+	if tx {
+		key.op = opTx
+	}
+
+	m.mu.RLock()
+	metric, found := m.metrics[key]
+	m.mu.RUnlock()
+
+	if !found {
+		m.mu.Lock()
+		if metric, found = m.metrics[key]; !found {
+			metric = &queryMetric{buckets: make([]uint64, len(m.opts.Buckets)+1)}
+			m.metrics[key] = metric
+		}
+		m.mu.Unlock()
+	}
+
+	elapsed := time.Since(start)
+
+	bucket := len(m.opts.Buckets)
+	for i, le := range m.opts.Buckets {
+		if elapsed.Seconds() <= le {
+			bucket = i
+			break
+		}
+	}
+
+	atomic.AddUint64(&metric.count, 1)
+	atomic.AddUint64(&metric.buckets[bucket], 1)
+	atomic.AddUint64(&metric.sumNano, uint64(elapsed))
+
+	if err != nil && err != sql.ErrNoRows {
+		atomic.AddUint64(&metric.errors, 1)
+	}
+}
+
+func (m *Monitor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	m.observe(ctx, false, start, err)
+
+	return res, err
+}
+
+func (m *Monitor) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	m.observe(ctx, false, start, err)
+
+	return rows, err
+}
+
+func (m *Monitor) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := m.DB.QueryxContext(ctx, query, args...)
+	m.observe(ctx, false, start, err)
+
+	return rows, err
+}
+
+func (m *Monitor) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	start := time.Now()
+	row := m.DB.QueryRowxContext(ctx, query, args...)
+	m.observe(ctx, false, start, row.Err())
+
+	return row
+}
+
+// ObserveQuery count query executed by connection of db which is not wrapped by Monitor,
+// e.g. by prepared statement of repository.StmtCache (repository.QueryObserver).
+func (m *Monitor) ObserveQuery(ctx context.Context, start time.Time, err error) {
+	m.observe(ctx, false, start, err)
+}
+
+// BeginTxx count begin of transaction, queries of transaction are counted if they are executed
+// by connection of TxConn.
+func (m *Monitor) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	start := time.Now()
+	tx, err := m.DB.BeginTxx(ctx, opts)
+	m.observe(ctx, true, start, err)
+
+	return tx, err
+}
+
+// TxConn return connection of tx which counts queries per repository and operation (repository.TxConnector).
+func (m *Monitor) TxConn(tx *sqlx.Tx) sqlx.ExtContext {
+	return &monitoredTx{Tx: tx, m: m}
+}
+
+func (t *monitoredTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := t.Tx.ExecContext(ctx, query, args...)
+	t.m.observe(ctx, false, start, err)
+
+	return res, err
+}
+
+func (t *monitoredTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	t.m.observe(ctx, false, start, err)
+
+	return rows, err
+}
+
+func (t *monitoredTx) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := t.Tx.QueryxContext(ctx, query, args...)
+	t.m.observe(ctx, false, start, err)
+
+	return rows, err
+}
+
+func (t *monitoredTx) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	start := time.Now()
+	row := t.Tx.QueryRowxContext(ctx, query, args...)
+	t.m.observe(ctx, false, start, row.Err())
+
+	return row
+}
@@ -0,0 +1,138 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository"
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type Role struct {
+	ID     int64  `db:"id"`
+	Name   string `db:"name"   orm_use_in:"select,create,update"`
+	Rights int    `db:"rights" orm_use_in:"select,create,update"`
+}
+
+func TestMonitor(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	mon := New(zap.NewNop(), db, Options{Buckets: []float64{0.5, 10}})
+
+	rec := httptest.NewRecorder()
+	mon.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "not pinged yet")
+
+	assert.Nil(t, mon.Ping(ctx))
+	assert.True(t, mon.Health().Up)
+
+	rec = httptest.NewRecorder()
+	mon.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	repo := repository.NewSqlxMapRepo(zap.NewNop(), mon, []repository.Table{"Roles"}, nil).Repo("Roles")
+
+	_, err := repo.Create(ctx, &Role{Name: "admin", Rights: 100})
+	assert.Nil(t, err)
+
+	var roles []Role
+	assert.Nil(t, repo.FindBy(ctx, []repository.Column{"id", "name", "rights"}, squirrel.Gt{"rights": 0}, &roles))
+	assert.NotNil(t, repo.FindBy(ctx, []repository.Column{"id"}, squirrel.Eq{"bad column": 1}, &roles))
+
+	_, err = mon.ExecContext(ctx, "DELETE FROM Roles WHERE id = $1", 100)
+	assert.Nil(t, err)
+
+	rec = httptest.NewRecorder()
+	mon.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE sqlx_up gauge",
+		"sqlx_up 1",
+		"sqlx_pool_open_connections 1",
+		"sqlx_pool_in_use_connections 0",
+		`sqlx_queries_total{repo="Roles",op="read"} 2`,
+		`sqlx_query_errors_total{repo="Roles",op="read"} 1`,
+		`sqlx_queries_total{repo="Roles",op="tx"} 1`,
+		`sqlx_queries_total{repo="Roles",op="write"} 1`, // INSERT in transaction of Create
+		`sqlx_queries_total{repo="unknown",op="unknown"} 1`,
+		"# TYPE sqlx_query_duration_seconds histogram",
+		`sqlx_query_duration_seconds_bucket{repo="Roles",op="read",le="0.5"} 2`,
+		`sqlx_query_duration_seconds_bucket{repo="Roles",op="read",le="10"} 2`,
+		`sqlx_query_duration_seconds_bucket{repo="Roles",op="read",le="+Inf"} 2`,
+		`sqlx_query_duration_seconds_count{repo="Roles",op="read"} 2`,
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+}
+
+func TestMonitor_Run(t *testing.T) {
+	db := repotest.New()
+	mon := New(zap.NewNop(), db, Options{PingInterval: 5 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mon.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return mon.Health().Up }, time.Second, time.Millisecond)
+
+	_ = db.Close()
+	assert.Eventually(t, func() bool { return !mon.Health().Up }, time.Second, time.Millisecond)
+	assert.NotNil(t, mon.Health().Err)
+
+	cancel()
+	<-done
+}
+
+func TestMetricKeyLabels(t *testing.T) {
+	assert.Equal(t, `repo="a\"b\\c\nd",op="read"`, metricKey{repo: "a\"b\\c\nd", op: "read"}.labels())
+}
+
+func TestMonitor_StmtCache(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	mon := New(zap.NewNop(), db, Options{})
+	cache := repository.NewStmtCache(mon, repository.StmtCacheOptions{})
+	defer func() { _ = cache.Close() }()
+
+	repo := repository.NewSqlxMapRepo(zap.NewNop(), db, []repository.Table{"Roles"}, nil).
+		WithStmtCache(cache).Repo("Roles")
+
+	_, err := repo.Create(ctx, &Role{Name: "admin", Rights: 100})
+	assert.Nil(t, err)
+
+	var roles []Role
+	for i := 0; i < 3; i++ {
+		roles = nil
+		assert.Nil(t, repo.FindBy(ctx, []repository.Column{"id", "name"}, squirrel.Gt{"rights": 0}, &roles))
+	}
+	assert.Equal(t, uint64(2), cache.Stats().Hits)
+
+	rec := httptest.NewRecorder()
+	mon.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		`sqlx_queries_total{repo="Roles",op="read"} 3`, // queries of cached statements
+		`sqlx_queries_total{repo="Roles",op="tx"} 1`,
+		`sqlx_queries_total{repo="Roles",op="write"} 1`, // INSERT in transaction of Create by TxConn of cache
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	BufferSizeDefault        = 64               // BufferSizeDefault - default size of notifications channel
+	ReconnectDelayDefault    = time.Second      // ReconnectDelayDefault - default first delay before reconnect
+	MaxReconnectDelayDefault = 30 * time.Second // MaxReconnectDelayDefault - default max delay before reconnect
+)
+
+type (
+	// Conn - dedicated connection which can LISTEN and wait notifications.
+	Conn interface {
+		Exec(ctx context.Context, sql string) error
+		WaitForNotification(ctx context.Context) (Notification, error)
+		Close(ctx context.Context) error
+	}
+
+	// Dialer - open new Conn, called on start and on every reconnect.
+	Dialer = func(ctx context.Context) (Conn, error)
+
+	// Options - options of Listener.
+	Options struct {
+		BufferSize        int           // size of notifications channel, 0 - BufferSizeDefault
+		ReconnectDelay    time.Duration // first delay before reconnect, doubled on every fail, 0 - ReconnectDelayDefault
+		MaxReconnectDelay time.Duration // max delay before reconnect, 0 - MaxReconnectDelayDefault
+		// OnReconnect called after reconnect and re-LISTEN. Notifications sent while connection was lost
+		// are not delivered, so here is good place to reload state (e.g. caches).
+		OnReconnect func()
+	}
+
+	// Listener - LISTEN channels on dedicated connection.
+	Listener struct {
+		logger *zap.Logger
+		dial   Dialer
+		opts   Options
+	}
+
+	pgxConn struct {
+		conn *pgx.Conn
+	}
+)
+
+// PgxDialer return Dialer which connects by pgx.Connect (connString - DSN or URL).
+func PgxDialer(connString string) Dialer {
+	return func(ctx context.Context) (Conn, error) {
+		conn, err := pgx.Connect(ctx, connString)
+		if err != nil {
+			return nil, err
+		}
+
+		return pgxConn{conn: conn}, nil
+	}
+}
+
+func (c pgxConn) Exec(ctx context.Context, sql string) error {
+	_, err := c.conn.Exec(ctx, sql)
+	return err
+}
+
+func (c pgxConn) WaitForNotification(ctx context.Context) (Notification, error) {
+	n, err := c.conn.WaitForNotification(ctx)
+	if err != nil {
+		return Notification{}, err
+	}
+
+	return Notification{Channel: n.Channel, Payload: n.Payload, PID: n.PID}, nil
+}
+
+func (c pgxConn) Close(ctx context.Context) error {
+	return c.conn.Close(ctx)
+}
+
+// NewListener - constructor of Listener.
+func NewListener(logger *zap.Logger, dial Dialer, opts Options) *Listener {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = BufferSizeDefault
+	}
+
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = ReconnectDelayDefault
+	}
+
+	if opts.MaxReconnectDelay <= 0 {
+		opts.MaxReconnectDelay = MaxReconnectDelayDefault
+	}
+
+	return &Listener{logger: logger, dial: dial, opts: opts}
+}
+
+// Listen connect and LISTEN channels, return channel of notifications, which is closed when ctx is done.
+// Error is returned only if first connect fails, after that connection is restored automatically.
+func (l *Listener) Listen(ctx context.Context, channels ...string) (<-chan Notification, error) {
+	if len(channels) == 0 {
+		return nil, ErrNoChannels
+	}
+
+	conn, err := l.connect(ctx, channels)
+	if err != nil {
+		return nil, errors.WithMessage(err, "[notify.Listen]")
+	}
+
+	out := make(chan Notification, l.opts.BufferSize)
+
+	go l.loop(ctx, conn, channels, out)
+
+	return out, nil
+}
+
+func (l *Listener) connect(ctx context.Context, channels []string) (Conn, error) {
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial")
+	}
+
+	for _, ch := range channels {
+		if err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{ch}.Sanitize()); err != nil {
+			_ = conn.Close(context.Background())
+			return nil, errors.Wrapf(err, "LISTEN %s", ch)
+		}
+	}
+
+	return conn, nil
+}
+
+func (l *Listener) loop(ctx context.Context, conn Conn, channels []string, out chan<- Notification) {
+	defer close(out)
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err == nil {
+			select {
+			case out <- n:
+				continue
+			case <-ctx.Done():
+			}
+		}
+
+		_ = conn.Close(context.Background())
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		l.logger.Warn("[notify.Listen] connection lost, reconnect", zap.Strings("channels", channels), zap.Error(err))
+
+		if conn = l.reconnect(ctx, channels); conn == nil {
+			return
+		}
+
+		l.logger.Info("[notify.Listen] reconnected", zap.Strings("channels", channels))
+
+		if l.opts.OnReconnect != nil {
+			l.opts.OnReconnect()
+		}
+	}
+}
+
+// reconnect try connect with exponential backoff until success or ctx is done (then return nil).
+func (l *Listener) reconnect(ctx context.Context, channels []string) Conn {
+	delay := l.opts.ReconnectDelay
+
+	for {
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		conn, err := l.connect(ctx, channels)
+		if err == nil {
+			return conn
+		}
+
+		l.logger.Warn("[notify.Listen] reconnect failed", zap.Duration("delay", delay), zap.Error(err))
+
+		if delay *= 2; delay > l.opts.MaxReconnectDelay {
+			delay = l.opts.MaxReconnectDelay
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package notify - Postgres LISTEN/NOTIFY helpers: Listener with automatic reconnect and re-LISTEN,
+// JSON payloads and Notify which can be used inside helper.WithTransaction.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+// MaxPayloadSize - max size of notification payload in bytes (Postgres default config).
+const MaxPayloadSize = 7999
+
+var (
+	// ErrNoChannels - Listen called without channels.
+	ErrNoChannels = errors.New("notify: at least one channel is required")
+	// ErrPayloadTooLarge - payload is bigger than MaxPayloadSize.
+	ErrPayloadTooLarge = errors.New("notify: payload is too large")
+)
+
+// Notification - notification received from Postgres.
+type Notification struct {
+	Channel string // channel from which notification was received
+	Payload string // payload as is
+	PID     uint32 // backend pid that sent the notification
+}
+
+// Decode decode JSON payload into dest (DTO).
+func (n Notification) Decode(dest interface{}) error {
+	if err := json.Unmarshal([]byte(n.Payload), dest); err != nil {
+		return errors.Wrapf(err, "[notify.Decode] channel %s", n.Channel)
+	}
+
+	return nil
+}
+
+// Send send notification to channel by pg_notify, it is delivered after commit if db is transaction.
+// Payload string or []byte is sent as is, other values are encoded to JSON (nil - empty payload).
+func Send(ctx context.Context, db sqlx.ExecerContext, channel string, payload interface{}) error {
+	data, err := encodePayload(payload)
+	if err != nil {
+		return errors.WithMessage(err, "[notify.Send]")
+	}
+
+	if _, err = db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, data); err != nil {
+		return errors.Wrap(err, "[notify.Send] db.ExecContext")
+	}
+
+	return nil
+}
+
+// Notify return TxFn which send notification inside transaction (see helper.WithTransaction).
+func Notify(ctx context.Context, channel string, payload interface{}) helper.TxFn {
+	return func(tx *sqlx.Tx) error {
+		return Send(ctx, tx, channel, payload)
+	}
+}
+
+func encodePayload(payload interface{}) (string, error) {
+	data, err := helper.EncodePayload(payload)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) > MaxPayloadSize {
+		return "", ErrPayloadTooLarge
+	}
+
+	return data, nil
+}
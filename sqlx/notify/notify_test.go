@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type (
+	fakeServer struct {
+		mu      sync.Mutex
+		conns   []*fakeConn
+		dialErr error
+	}
+
+	fakeConn struct {
+		listen []string
+		notify chan Notification
+		broken chan struct{}
+		closed bool
+	}
+
+	fakeExecer struct {
+		query string
+		args  []interface{}
+	}
+)
+
+func (s *fakeServer) dial(ctx context.Context) (Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dialErr != nil {
+		return nil, s.dialErr
+	}
+
+	c := &fakeConn{notify: make(chan Notification, 10), broken: make(chan struct{})}
+	s.conns = append(s.conns, c)
+
+	return c, nil
+}
+
+func (s *fakeServer) last() *fakeConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conns[len(s.conns)-1]
+}
+
+func (s *fakeServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+func (c *fakeConn) Exec(ctx context.Context, sql string) error {
+	c.listen = append(c.listen, sql)
+	return nil
+}
+
+func (c *fakeConn) WaitForNotification(ctx context.Context) (Notification, error) {
+	select {
+	case n := <-c.notify:
+		return n, nil
+	case <-c.broken:
+		return Notification{}, errors.New("connection reset")
+	case <-ctx.Done():
+		return Notification{}, ctx.Err()
+	}
+}
+
+func (c *fakeConn) Close(ctx context.Context) error {
+	c.closed = true
+	return nil
+}
+
+func (e *fakeExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.query, e.args = query, args
+	return nil, nil
+}
+
+func receive(t *testing.T, ch <-chan Notification) Notification {
+	select {
+	case n, ok := <-ch:
+		assert.True(t, ok)
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	return Notification{}
+}
+
+func TestListener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := &fakeServer{}
+	reconnected := make(chan struct{}, 1)
+
+	l := NewListener(zap.NewNop(), server.dial, Options{
+		ReconnectDelay: time.Millisecond,
+		OnReconnect:    func() { reconnected <- struct{}{} },
+	})
+
+	_, err := l.Listen(ctx)
+	assert.Equal(t, ErrNoChannels, err)
+
+	ch, err := l.Listen(ctx, "cache_reload", `we"ird`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`LISTEN "cache_reload"`, `LISTEN "we""ird"`}, server.last().listen)
+
+	server.last().notify <- Notification{Channel: "cache_reload", Payload: `{"table":"users","id":1}`, PID: 42}
+
+	n := receive(t, ch)
+	assert.Equal(t, "cache_reload", n.Channel)
+	assert.Equal(t, uint32(42), n.PID)
+
+	var dto struct {
+		Table string `json:"table"`
+		ID    int64  `json:"id"`
+	}
+	assert.Nil(t, n.Decode(&dto))
+	assert.Equal(t, "users", dto.Table)
+	assert.Equal(t, int64(1), dto.ID)
+	assert.NotNil(t, Notification{Payload: "not json"}.Decode(&dto))
+
+	// reconnect and re-LISTEN
+	first := server.last()
+	close(first.broken)
+
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("not reconnected")
+	}
+
+	assert.Equal(t, 2, server.count())
+	assert.Equal(t, first.listen, server.last().listen)
+
+	server.last().notify <- Notification{Channel: "cache_reload", Payload: "after reconnect"}
+	assert.Equal(t, "after reconnect", receive(t, ch).Payload)
+
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok, "channel is closed when ctx is done")
+	case <-time.After(time.Second):
+		t.Fatal("channel is not closed")
+	}
+}
+
+func TestListener_DialError(t *testing.T) {
+	server := &fakeServer{dialErr: errors.New("connection refused")}
+
+	_, err := NewListener(zap.NewNop(), server.dial, Options{}).Listen(context.Background(), "ch")
+	assert.NotNil(t, err)
+	assert.Equal(t, server.dialErr, errors.Cause(err))
+}
+
+func TestSend(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeExecer{}
+
+	assert.Nil(t, Send(ctx, db, "ch", map[string]int{"id": 1}))
+	assert.Equal(t, "SELECT pg_notify($1, $2)", db.query)
+	assert.Equal(t, []interface{}{"ch", `{"id":1}`}, db.args)
+
+	assert.Nil(t, Send(ctx, db, "ch", "raw"))
+	assert.Equal(t, "raw", db.args[1])
+
+	assert.Nil(t, Send(ctx, db, "ch", nil))
+	assert.Equal(t, "", db.args[1])
+
+	assert.Equal(t, ErrPayloadTooLarge, errors.Cause(Send(ctx, db, "ch", strings.Repeat("x", MaxPayloadSize+1))))
+	assert.NotNil(t, Send(ctx, db, "ch", make(chan int)))
+}
@@ -0,0 +1,101 @@
+// Package outbox - transactional outbox: events are added in transaction of business changes
+// and delivered to Publisher by Relay with at-least-once guarantee.
+//
+// Outbox table, e.g. for Postgres:
+//
+//	CREATE TABLE outbox (
+//	    id              BIGSERIAL   PRIMARY KEY,
+//	    topic           TEXT        NOT NULL,
+//	    payload         TEXT        NOT NULL,
+//	    attempts        INTEGER     NOT NULL DEFAULT 0,
+//	    last_error      TEXT        NOT NULL DEFAULT '',
+//	    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+//	    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+//	    delivered_at    TIMESTAMPTZ
+//	);
+//	CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE delivered_at IS NULL;
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+// TableDefault - default outbox table.
+const TableDefault = "outbox"
+
+type (
+	// Message - row of outbox table.
+	Message struct {
+		ID            int64      `db:"id"              orm_use_in:"select"`
+		Topic         string     `db:"topic"           orm_use_in:"select,create"`
+		Payload       []byte     `db:"payload"         orm_use_in:"select"`
+		Attempts      int        `db:"attempts"        orm_use_in:"select,create"`
+		LastError     string     `db:"last_error"      orm_use_in:"select,create"`
+		CreatedAt     time.Time  `db:"created_at"      orm_use_in:"select,create"`
+		NextAttemptAt time.Time  `db:"next_attempt_at" orm_use_in:"select,create"`
+		DeliveredAt   *time.Time `db:"delivered_at"    orm_use_in:"select"`
+	}
+
+	// Publisher - deliver messages to broker (Kafka, NATS, HTTP and etc).
+	// Publish can be called several times for one message (at-least-once), so consumers must be idempotent,
+	// Message.ID can be used as idempotency key.
+	Publisher interface {
+		Publish(ctx context.Context, msg Message) error
+	}
+
+	// PublisherFunc - adapter of func to Publisher.
+	PublisherFunc func(ctx context.Context, msg Message) error
+)
+
+// Publish - implementation of Publisher.
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// Add add message to outbox table (TableDefault) in caller transaction tx.
+// Payload string or []byte is stored as is, other values are encoded to JSON.
+func Add(ctx context.Context, tx sqlx.ExecerContext, topic string, payload interface{}) error {
+	return AddTo(ctx, tx, TableDefault, topic, payload)
+}
+
+// AddTo same as Add, but for custom outbox table.
+func AddTo(ctx context.Context, tx sqlx.ExecerContext, table string, topic string, payload interface{}) error {
+	data, err := helper.EncodePayload(payload)
+	if err != nil {
+		return errors.WithMessage(err, "[outbox.Add]")
+	}
+
+	now := time.Now().UTC()
+
+	cols, vals := orm.GetDataForCreate(&Message{Topic: topic, CreatedAt: now, NextAttemptAt: now})
+
+	query, args, err := squirrel.Insert(table).
+		Columns(append(cols, "payload")...).
+		Values(append(vals, data)...).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "[outbox.Add] squirrel")
+	}
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "[outbox.Add] tx.ExecContext")
+	}
+
+	return nil
+}
+
+// AddFn return TxFn which add message to outbox (see helper.WithTransaction).
+func AddFn(ctx context.Context, topic string, payload interface{}) helper.TxFn {
+	return func(tx *sqlx.Tx) error {
+		return Add(ctx, tx, topic, payload)
+	}
+}
@@ -0,0 +1,169 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/helper"
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type event struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+func newTestDB() *repotest.DB {
+	return repotest.New(repotest.Table{Name: TableDefault, Columns: []string{
+		"id", "topic", "payload", "attempts", "last_error", "created_at", "next_attempt_at", "delivered_at",
+	}})
+}
+
+func TestAdd(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB()
+	defer func() { _ = db.Close() }()
+
+	fail := func(tx *sqlx.Tx) error { return errors.New("business logic failed") }
+
+	assert.NotNil(t, helper.WithTransaction(ctx, nil, db, AddFn(ctx, "users", event{UserID: 1}), fail))
+	assert.Equal(t, 0, len(db.Rows(TableDefault)), "rollback with caller transaction")
+
+	assert.Nil(t, helper.WithTransaction(ctx, nil, db,
+		AddFn(ctx, "users", event{UserID: 1, Name: "created"}),
+		func(tx *sqlx.Tx) error { return Add(ctx, tx, "raw", "as is") },
+	))
+
+	rows := db.Rows(TableDefault)
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, "users", rows[0]["topic"])
+	assert.Equal(t, `{"user_id":1,"name":"created"}`, rows[0]["payload"])
+	assert.Equal(t, int64(0), rows[0]["attempts"])
+	assert.Nil(t, rows[0]["delivered_at"])
+	assert.Equal(t, "as is", rows[1]["payload"])
+
+	assert.NotNil(t, Add(ctx, db, "bad", make(chan int)))
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB()
+	defer func() { _ = db.Close() }()
+
+	for i := 1; i <= 3; i++ {
+		assert.Nil(t, Add(ctx, db, "users", event{UserID: int64(i)}))
+	}
+
+	published := []int64{}
+	failUser := int64(2)
+
+	relay := NewRelay(zap.NewNop(), db, PublisherFunc(func(ctx context.Context, msg Message) error {
+		var e event
+		if err := json.Unmarshal(msg.Payload, &e); err != nil {
+			return err
+		}
+		if e.UserID == failUser {
+			return errors.New("broker is unavailable")
+		}
+		published = append(published, e.UserID)
+		return nil
+	}), RelayOptions{BatchSize: 2, RetryDelay: time.Hour, MaxRetryDelay: 2 * time.Hour, MaxAttempts: 2})
+
+	cnt, err := relay.ProcessBatch(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, cnt)
+
+	cnt, err = relay.ProcessBatch(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, cnt, "failed message is delayed")
+	assert.Equal(t, []int64{1, 3}, published)
+
+	rows := db.Rows(TableDefault)
+	assert.NotNil(t, rows[0]["delivered_at"])
+	assert.Nil(t, rows[1]["delivered_at"])
+	assert.Equal(t, int64(1), rows[1]["attempts"])
+	assert.Equal(t, "broker is unavailable", rows[1]["last_error"])
+	assert.True(t, rows[1]["next_attempt_at"].(time.Time).After(time.Now().Add(50*time.Minute)))
+
+	cnt, err = relay.ProcessBatch(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, cnt)
+
+	// retry: message is ready again
+	_, err = db.ExecContext(ctx, "UPDATE outbox SET next_attempt_at = $1 WHERE id = 2", time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+
+	cnt, err = relay.ProcessBatch(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, int64(2), db.Rows(TableDefault)[1]["attempts"])
+
+	// max attempts reached
+	_, err = db.ExecContext(ctx, "UPDATE outbox SET next_attempt_at = $1 WHERE id = 2", time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+
+	cnt, err = relay.ProcessBatch(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, cnt)
+
+	// cleanup
+	deleted, err := relay.Cleanup(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), deleted, "delivered recently")
+
+	_, err = db.ExecContext(ctx, "UPDATE outbox SET delivered_at = $1 WHERE id = 1", time.Now().Add(-48*time.Hour))
+	assert.Nil(t, err)
+
+	deleted, err = relay.Cleanup(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Equal(t, 2, len(db.Rows(TableDefault)))
+}
+
+func TestRelay_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := newTestDB()
+	defer func() { _ = db.Close() }()
+
+	done := make(chan Message, 10)
+	relay := NewRelay(zap.NewNop(), db, PublisherFunc(func(ctx context.Context, msg Message) error {
+		done <- msg
+		return nil
+	}), RelayOptions{PollInterval: time.Millisecond})
+
+	stopped := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(stopped)
+	}()
+
+	assert.Nil(t, Add(ctx, db, "topic", "payload"))
+
+	select {
+	case msg := <-done:
+		assert.Equal(t, "topic", msg.Topic)
+		assert.Equal(t, []byte("payload"), msg.Payload)
+	case <-time.After(time.Second):
+		t.Fatal("message is not published")
+	}
+
+	cancel()
+	<-stopped
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := NewRelay(zap.NewNop(), nil, nil, RelayOptions{RetryDelay: time.Second, MaxRetryDelay: 5 * time.Second})
+
+	assert.Equal(t, time.Second, r.retryDelay(1))
+	assert.Equal(t, 2*time.Second, r.retryDelay(2))
+	assert.Equal(t, 4*time.Second, r.retryDelay(3))
+	assert.Equal(t, 5*time.Second, r.retryDelay(4))
+	assert.Equal(t, 5*time.Second, r.retryDelay(100))
+}
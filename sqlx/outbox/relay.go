@@ -0,0 +1,253 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+const (
+	BatchSizeDefault       = 100              // BatchSizeDefault - default count of messages per poll
+	PollIntervalDefault    = time.Second      // PollIntervalDefault - default interval between polls
+	RetryDelayDefault      = time.Second      // RetryDelayDefault - default first delay before retry
+	MaxRetryDelayDefault   = 10 * time.Minute // MaxRetryDelayDefault - default max delay before retry
+	CleanupAfterDefault    = 24 * time.Hour   // CleanupAfterDefault - default age of delivered messages for cleanup
+	CleanupIntervalDefault = time.Hour        // CleanupIntervalDefault - default interval between cleanups
+
+	maxErrorLen = 1024
+)
+
+type (
+	// DB - connection used by Relay (e.g. *sqlx.DB or repository.SqlxDBConnectorI).
+	DB interface {
+		sqlx.ExecerContext
+		helper.TxxI
+	}
+
+	// RelayOptions - options of Relay, zero values are replaced by defaults.
+	RelayOptions struct {
+		Table           string        // outbox table, default TableDefault
+		BatchSize       uint64        // messages per poll
+		PollInterval    time.Duration // interval between polls (if previous poll was not full)
+		MaxAttempts     int           // after MaxAttempts failed publishes message is not retried, 0 - unlimited
+		RetryDelay      time.Duration // first delay before retry, doubled on every failed attempt
+		MaxRetryDelay   time.Duration // max delay before retry
+		CleanupAfter    time.Duration // delivered messages older than CleanupAfter are deleted
+		CleanupInterval time.Duration // interval between cleanups
+	}
+
+	// Relay - worker which polls outbox table and delivers messages to Publisher.
+	// Several Relays can work with one table, messages are locked by FOR UPDATE SKIP LOCKED.
+	Relay struct {
+		logger    *zap.Logger
+		db        DB
+		publisher Publisher
+		opts      RelayOptions
+	}
+)
+
+// NewRelay - constructor of Relay.
+func NewRelay(logger *zap.Logger, db DB, publisher Publisher, opts RelayOptions) *Relay {
+	if opts.Table == "" {
+		opts.Table = TableDefault
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = BatchSizeDefault
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = PollIntervalDefault
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = RetryDelayDefault
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = MaxRetryDelayDefault
+	}
+	if opts.CleanupAfter <= 0 {
+		opts.CleanupAfter = CleanupAfterDefault
+	}
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = CleanupIntervalDefault
+	}
+
+	return &Relay{logger: logger, db: db, publisher: publisher, opts: opts}
+}
+
+// Run poll outbox and cleanup delivered messages until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	poll := time.NewTimer(0)
+	defer poll.Stop()
+
+	cleanup := time.NewTicker(r.opts.CleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-cleanup.C:
+			if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Error("[outbox.Relay] cleanup", zap.Error(err))
+			}
+
+		case <-poll.C:
+			cnt, err := r.ProcessBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Error("[outbox.Relay] process batch", zap.Error(err))
+			}
+
+			if cnt == int(r.opts.BatchSize) {
+				poll.Reset(0) // probably there are more messages
+			} else {
+				poll.Reset(r.opts.PollInterval)
+			}
+		}
+	}
+}
+
+// ProcessBatch lock batch of ready messages, publish them and mark delivered or schedule retry.
+// Return count of processed (delivered or failed) messages.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	cnt := 0
+
+	err := helper.WithTransaction(ctx, nil, r.db, func(tx *sqlx.Tx) error {
+		msgs, err := r.lockBatch(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			if err = r.publish(ctx, tx, msg); err != nil {
+				return err
+			}
+			cnt++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return cnt, errors.WithMessage(err, "[outbox.ProcessBatch]")
+	}
+
+	return cnt, nil
+}
+
+func (r *Relay) lockBatch(ctx context.Context, tx *sqlx.Tx) ([]Message, error) {
+	cols, _ := orm.GetDataForSelect(&Message{})
+
+	cond := squirrel.And{
+		squirrel.Eq{"delivered_at": nil},
+		squirrel.LtOrEq{"next_attempt_at": time.Now().UTC()},
+	}
+	if r.opts.MaxAttempts > 0 {
+		cond = append(cond, squirrel.Lt{"attempts": r.opts.MaxAttempts})
+	}
+
+	query, args, err := squirrel.Select(cols...).
+		From(r.opts.Table).
+		Where(cond).
+		OrderBy("id").
+		Limit(r.opts.BatchSize).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "squirrel")
+	}
+
+	msgs := []Message{}
+	if err = sqlx.SelectContext(ctx, tx, &msgs, query, args...); err != nil {
+		return nil, errors.Wrap(err, "lock batch")
+	}
+
+	return msgs, nil
+}
+
+// publish deliver message and save result, error is returned only if result can't be saved.
+func (r *Relay) publish(ctx context.Context, tx *sqlx.Tx, msg Message) error {
+	now := time.Now().UTC()
+
+	set := map[string]interface{}{"delivered_at": now}
+
+	if errPub := r.publisher.Publish(ctx, msg); errPub != nil {
+		r.logger.Warn("[outbox.Relay] publish failed",
+			zap.Int64("id", msg.ID), zap.String("topic", msg.Topic), zap.Int("attempts", msg.Attempts+1),
+			zap.Error(errPub))
+
+		lastError := errPub.Error()
+		if len(lastError) > maxErrorLen {
+			lastError = lastError[:maxErrorLen]
+		}
+
+		set = map[string]interface{}{
+			"attempts":        msg.Attempts + 1,
+			"last_error":      lastError,
+			"next_attempt_at": now.Add(r.retryDelay(msg.Attempts + 1)),
+		}
+	}
+
+	query, args, err := squirrel.Update(r.opts.Table).
+		SetMap(set).
+		Where(squirrel.Eq{"id": msg.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "squirrel")
+	}
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrapf(err, "save result of message %d", msg.ID)
+	}
+
+	return nil
+}
+
+// retryDelay return delay before next attempt: RetryDelay * 2^(attempts-1), but not more than MaxRetryDelay.
+func (r *Relay) retryDelay(attempts int) time.Duration {
+	delay := r.opts.RetryDelay
+	for i := 1; i < attempts && delay < r.opts.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > r.opts.MaxRetryDelay {
+		return r.opts.MaxRetryDelay
+	}
+
+	return delay
+}
+
+// Cleanup delete messages delivered more than CleanupAfter ago, return count of deleted messages.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	query, args, err := squirrel.Delete(r.opts.Table).
+		Where(squirrel.And{
+			squirrel.NotEq{"delivered_at": nil},
+			squirrel.Lt{"delivered_at": time.Now().UTC().Add(-r.opts.CleanupAfter)},
+		}).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "[outbox.Cleanup] squirrel")
+	}
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "[outbox.Cleanup] db.ExecContext")
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "[outbox.Cleanup] res.RowsAffected")
+	}
+
+	r.logger.Info("[outbox.Cleanup]", zap.Int64("deleted", cnt))
+
+	return cnt, nil
+}
@@ -0,0 +1,564 @@
+// Package queue - durable job queue in Postgres table: jobs are claimed by workers with FOR UPDATE SKIP LOCKED,
+// running jobs are kept alive by heartbeats, failed jobs are retried with backoff and moved to dead state
+// after MaxAttempts.
+//
+// Jobs table, e.g. for Postgres:
+//
+//	CREATE TABLE jobs (
+//	    id           BIGSERIAL   PRIMARY KEY,
+//	    queue        TEXT        NOT NULL,
+//	    payload      TEXT        NOT NULL,
+//	    priority     INTEGER     NOT NULL DEFAULT 0,
+//	    state        TEXT        NOT NULL DEFAULT 'pending',
+//	    attempts     INTEGER     NOT NULL DEFAULT 0,
+//	    max_attempts INTEGER     NOT NULL,
+//	    last_error   TEXT        NOT NULL DEFAULT '',
+//	    run_at       TIMESTAMPTZ NOT NULL,
+//	    locked_by    TEXT        NOT NULL DEFAULT '',
+//	    heartbeat_at TIMESTAMPTZ,
+//	    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+//	    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+//	);
+//	CREATE INDEX jobs_claim_idx ON jobs (queue, state, priority DESC, run_at);
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/helper"
+	"github.com/imperiuse/golib/sqlx/repository"
+)
+
+const (
+	StatePending = "pending" // StatePending - job waits run_at
+	StateRunning = "running" // StateRunning - job is claimed by worker
+	StateDone    = "done"    // StateDone - job is finished successfully
+	StateDead    = "dead"    // StateDead - job failed MaxAttempts times (dead-letter)
+
+	TableDefault             = "jobs"           // TableDefault - default jobs table
+	WorkersDefault           = 1                // WorkersDefault - default count of workers
+	PollIntervalDefault      = time.Second      // PollIntervalDefault - default interval of polls when queue is empty
+	HeartbeatIntervalDefault = 10 * time.Second // HeartbeatIntervalDefault - default interval of heartbeats
+	StaleTimeoutDefault      = time.Minute      // StaleTimeoutDefault - default timeout of heartbeat of running job
+	RetryDelayDefault        = time.Second      // RetryDelayDefault - default first delay before retry
+	MaxRetryDelayDefault     = time.Hour        // MaxRetryDelayDefault - default max delay before retry
+	MaxAttemptsDefault       = 5                // MaxAttemptsDefault - default max attempts of job
+	ShutdownTimeoutDefault   = 30 * time.Second // ShutdownTimeoutDefault - default time to finish running jobs
+
+	finishTimeout = 10 * time.Second
+	maxErrorLen   = 1024
+)
+
+// errHeartbeatTimeout - last error of job dead by stale heartbeat.
+const errHeartbeatTimeout = "heartbeat timeout"
+
+type (
+	// Job - row of jobs table.
+	Job struct {
+		ID          int64      `db:"id"            orm_use_in:"select"`
+		Queue       string     `db:"queue"         orm_use_in:"select,create"`
+		Payload     []byte     `db:"payload"       orm_use_in:"select"`
+		Priority    int        `db:"priority"      orm_use_in:"select,create"`
+		State       string     `db:"state"         orm_use_in:"select,create"`
+		Attempts    int        `db:"attempts"      orm_use_in:"select,create"`
+		MaxAttempts int        `db:"max_attempts"  orm_use_in:"select,create"`
+		LastError   string     `db:"last_error"    orm_use_in:"select,create"`
+		RunAt       time.Time  `db:"run_at"        orm_use_in:"select,create"`
+		LockedBy    string     `db:"locked_by"     orm_use_in:"select,create"`
+		HeartbeatAt *time.Time `db:"heartbeat_at"  orm_use_in:"select"`
+		CreatedAt   time.Time  `db:"created_at"    orm_use_in:"select,create"`
+		UpdatedAt   time.Time  `db:"updated_at"    orm_use_in:"select,create"`
+	}
+
+	// EnqueueOptions - options of job.
+	EnqueueOptions struct {
+		Priority    int       // jobs with bigger priority are claimed first
+		RunAt       time.Time // zero - now
+		MaxAttempts int       // 0 - Options.MaxAttempts
+	}
+
+	// Handler - process job. Error means job failed and it will be retried.
+	Handler interface {
+		Handle(ctx context.Context, job Job) error
+	}
+
+	// HandlerFunc - adapter of func to Handler.
+	HandlerFunc func(ctx context.Context, job Job) error
+
+	// Options - options of Queue, zero values are replaced by defaults.
+	Options struct {
+		Table             string        // jobs table
+		Workers           int           // count of concurrent workers in Work
+		PollInterval      time.Duration // interval of polls when queue is empty
+		HeartbeatInterval time.Duration // interval of heartbeats of running job
+		StaleTimeout      time.Duration // running job without heartbeat for StaleTimeout is claimed again
+		RetryDelay        time.Duration // first delay before retry, doubled on every failed attempt
+		MaxRetryDelay     time.Duration // max delay before retry
+		MaxAttempts       int           // default max attempts of job
+		ShutdownTimeout   time.Duration // time to finish running jobs after ctx of Work is done
+		WorkerID          string        // prefix of workers ids, default hostname-pid
+	}
+
+	// Queue - named queue in jobs table.
+	Queue struct {
+		logger *zap.Logger
+		db     repository.SqlxDBConnectorI
+		name   string
+		opts   Options
+	}
+)
+
+// Handle - implementation of Handler.
+func (f HandlerFunc) Handle(ctx context.Context, job Job) error {
+	return f(ctx, job)
+}
+
+// Decode decode JSON payload into dest (DTO).
+func (j Job) Decode(dest interface{}) error {
+	if err := json.Unmarshal(j.Payload, dest); err != nil {
+		return errors.Wrapf(err, "[queue.Decode] job %d", j.ID)
+	}
+
+	return nil
+}
+
+// New - constructor of Queue.
+func New(logger *zap.Logger, db repository.SqlxDBConnectorI, name string, opts Options) *Queue {
+	if opts.Table == "" {
+		opts.Table = TableDefault
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = WorkersDefault
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = PollIntervalDefault
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = HeartbeatIntervalDefault
+	}
+	if opts.StaleTimeout <= 0 {
+		opts.StaleTimeout = StaleTimeoutDefault
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = RetryDelayDefault
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = MaxRetryDelayDefault
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = MaxAttemptsDefault
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = ShutdownTimeoutDefault
+	}
+	if opts.WorkerID == "" {
+		host, _ := os.Hostname()
+		opts.WorkerID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	return &Queue{logger: logger, db: db, name: name, opts: opts}
+}
+
+func (q *Queue) zapFieldQueue() zap.Field {
+	return zap.String("queue", q.name)
+}
+
+func zapFieldJob(job Job) zap.Field {
+	return zap.Int64("job", job.ID)
+}
+
+// Enqueue add job, payload string or []byte is stored as is, other values are encoded to JSON.
+func (q *Queue) Enqueue(ctx context.Context, payload interface{}, opts EnqueueOptions) (int64, error) {
+	return q.EnqueueTx(ctx, q.db, payload, opts)
+}
+
+// EnqueueTx add job in caller transaction tx.
+func (q *Queue) EnqueueTx(ctx context.Context, tx sqlx.QueryerContext, payload interface{}, opts EnqueueOptions) (int64, error) {
+	data, err := helper.EncodePayload(payload)
+	if err != nil {
+		return 0, errors.WithMessage(err, "[queue.Enqueue]")
+	}
+
+	now := time.Now().UTC()
+
+	job := Job{
+		Queue:       q.name,
+		Priority:    opts.Priority,
+		State:       StatePending,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt.UTC(),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = q.opts.MaxAttempts
+	}
+	if opts.RunAt.IsZero() {
+		job.RunAt = now
+	}
+
+	cols, vals := orm.GetDataForCreate(&job)
+
+	query, args, err := squirrel.Insert(q.opts.Table).
+		Columns(append(cols, "payload")...).
+		Values(append(vals, data)...).
+		Suffix("RETURNING id").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "[queue.Enqueue] squirrel")
+	}
+
+	var id int64
+	if err = tx.QueryRowxContext(ctx, query, args...).Scan(&id); err != nil {
+		return 0, errors.Wrap(err, "[queue.Enqueue] insert")
+	}
+
+	return id, nil
+}
+
+// EnqueueFn return TxFn which add job (see helper.WithTransaction).
+func (q *Queue) EnqueueFn(ctx context.Context, payload interface{}, opts EnqueueOptions) helper.TxFn {
+	return func(tx *sqlx.Tx) error {
+		_, err := q.EnqueueTx(ctx, tx, payload, opts)
+		return err
+	}
+}
+
+// Work run Options.Workers workers which process jobs by h until ctx is done.
+// After ctx is done workers stop claiming jobs and running jobs have Options.ShutdownTimeout to finish,
+// after that their ctx is canceled and jobs are returned to queue without counting attempt.
+func (q *Queue) Work(ctx context.Context, h Handler) {
+	q.logger.Info("[queue.Work] start", q.zapFieldQueue(), zap.Int("workers", q.opts.Workers))
+
+	handlerCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+
+		go func(worker string) {
+			defer wg.Done()
+			q.worker(ctx, handlerCtx, worker, h)
+		}(fmt.Sprintf("%s-%d", q.opts.WorkerID, i))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	<-ctx.Done()
+
+	select {
+	case <-done:
+	case <-time.After(q.opts.ShutdownTimeout):
+		q.logger.Warn("[queue.Work] shutdown timeout, cancel running jobs", q.zapFieldQueue())
+		cancel()
+		<-done
+	}
+
+	q.logger.Info("[queue.Work] stop", q.zapFieldQueue())
+}
+
+func (q *Queue) worker(ctx context.Context, handlerCtx context.Context, worker string, h Handler) {
+	for ctx.Err() == nil {
+		job, err := q.Claim(ctx, worker)
+		if err != nil && ctx.Err() == nil {
+			q.logger.Error("[queue.worker] claim", q.zapFieldQueue(), zap.Error(err))
+		}
+
+		if job == nil {
+			sleep(ctx, q.opts.PollInterval)
+			continue
+		}
+
+		q.run(handlerCtx, *job, h)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// run process claimed job with heartbeats and save result.
+func (q *Queue) run(handlerCtx context.Context, job Job, h Handler) {
+	jobCtx, cancel := context.WithCancel(handlerCtx)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		q.heartbeats(jobCtx, cancel, job)
+	}()
+
+	err := handle(jobCtx, h, job)
+
+	cancel()
+	<-stopped
+
+	ctx, cancelFinish := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancelFinish()
+
+	if errFinish := q.finish(ctx, job, err, handlerCtx.Err() != nil); errFinish != nil {
+		q.logger.Error("[queue.run] finish", q.zapFieldQueue(), zapFieldJob(job), zap.Error(errFinish))
+	}
+}
+
+func handle(ctx context.Context, h Handler, job Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.Errorf("panic: %v", p)
+		}
+	}()
+
+	return h.Handle(ctx, job)
+}
+
+// heartbeats update heartbeat_at of job until ctx is done, cancel job if it is claimed by another worker.
+func (q *Queue) heartbeats(ctx context.Context, cancel context.CancelFunc, job Job) {
+	ticker := time.NewTicker(q.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ra, err := q.update(ctx, job, map[string]interface{}{"heartbeat_at": time.Now().UTC()})
+		if err != nil {
+			q.logger.Warn("[queue.heartbeat]", q.zapFieldQueue(), zapFieldJob(job), zap.Error(err))
+			continue
+		}
+
+		if ra == 0 {
+			q.logger.Warn("[queue.heartbeat] job is lost, cancel", q.zapFieldQueue(), zapFieldJob(job))
+			cancel()
+
+			return
+		}
+	}
+}
+
+// update job claimed by worker.
+func (q *Queue) update(ctx context.Context, job Job, set map[string]interface{}) (int64, error) {
+	set["updated_at"] = time.Now().UTC()
+
+	query, args, err := squirrel.Update(q.opts.Table).
+		SetMap(set).
+		Where(squirrel.Eq{"id": job.ID, "locked_by": job.LockedBy, "state": StateRunning}).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "squirrel")
+	}
+
+	res, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "db.ExecContext")
+	}
+
+	return res.RowsAffected()
+}
+
+// finish save result of job: done, retry with backoff, dead or release (shutdown).
+func (q *Queue) finish(ctx context.Context, job Job, errJob error, shutdown bool) error {
+	now := time.Now().UTC()
+	set := map[string]interface{}{"state": StateDone, "locked_by": ""}
+
+	switch {
+	case errJob == nil:
+		q.logger.Info("[queue.run] done", q.zapFieldQueue(), zapFieldJob(job))
+
+	case shutdown:
+		q.logger.Warn("[queue.run] released by shutdown", q.zapFieldQueue(), zapFieldJob(job), zap.Error(errJob))
+		set["state"], set["attempts"], set["run_at"] = StatePending, job.Attempts-1, now
+
+	case job.Attempts >= job.MaxAttempts:
+		q.logger.Error("[queue.run] dead", q.zapFieldQueue(), zapFieldJob(job), zap.Error(errJob))
+		set["state"], set["last_error"] = StateDead, truncateError(errJob.Error())
+
+	default:
+		q.logger.Warn("[queue.run] failed, retry", q.zapFieldQueue(), zapFieldJob(job), zap.Error(errJob))
+		set["state"], set["last_error"] = StatePending, truncateError(errJob.Error())
+		set["run_at"] = now.Add(q.retryDelay(job.Attempts))
+	}
+
+	_, err := q.update(ctx, job, set)
+
+	return err
+}
+
+func truncateError(s string) string {
+	if len(s) > maxErrorLen {
+		return s[:maxErrorLen]
+	}
+
+	return s
+}
+
+// retryDelay return delay before next attempt: RetryDelay * 2^(attempts-1), but not more than MaxRetryDelay.
+func (q *Queue) retryDelay(attempts int) time.Duration {
+	delay := q.opts.RetryDelay
+	for i := 1; i < attempts && delay < q.opts.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > q.opts.MaxRetryDelay {
+		return q.opts.MaxRetryDelay
+	}
+
+	return delay
+}
+
+// Claim lock next ready job for worker (pending job or running job with stale heartbeat), nil if queue is empty.
+// Stale jobs which have no attempts left are moved to dead state.
+func (q *Queue) Claim(ctx context.Context, worker string) (*Job, error) {
+	var job *Job
+
+	err := helper.WithTransaction(ctx, nil, q.db, func(tx *sqlx.Tx) error {
+		now := time.Now().UTC()
+		stale := squirrel.And{squirrel.Eq{"state": StateRunning}, squirrel.Lt{"heartbeat_at": now.Add(-q.opts.StaleTimeout)}}
+
+		query, args, err := squirrel.Update(q.opts.Table).
+			SetMap(map[string]interface{}{"state": StateDead, "last_error": errHeartbeatTimeout, "updated_at": now}).
+			Where(squirrel.And{squirrel.Eq{"queue": q.name}, stale, squirrel.Expr("attempts >= max_attempts")}).
+			PlaceholderFormat(squirrel.Dollar).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "squirrel")
+		}
+
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return errors.Wrap(err, "dead stale jobs")
+		}
+
+		cols, _ := orm.GetDataForSelect(&Job{})
+
+		query, args, err = squirrel.Select(cols...).
+			From(q.opts.Table).
+			Where(squirrel.And{
+				squirrel.Eq{"queue": q.name},
+				squirrel.Or{
+					squirrel.And{squirrel.Eq{"state": StatePending}, squirrel.LtOrEq{"run_at": now}},
+					stale,
+				},
+			}).
+			OrderBy("priority DESC", "run_at", "id").
+			Limit(1).
+			Suffix("FOR UPDATE SKIP LOCKED").
+			PlaceholderFormat(squirrel.Dollar).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "squirrel")
+		}
+
+		jobs := []Job{}
+		if err = sqlx.SelectContext(ctx, tx, &jobs, query, args...); err != nil {
+			return errors.Wrap(err, "select job")
+		}
+
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		j := jobs[0]
+		j.State, j.Attempts, j.LockedBy, j.HeartbeatAt = StateRunning, j.Attempts+1, worker, &now
+
+		query, args, err = squirrel.Update(q.opts.Table).
+			SetMap(map[string]interface{}{
+				"state":        j.State,
+				"attempts":     j.Attempts,
+				"locked_by":    j.LockedBy,
+				"heartbeat_at": now,
+				"updated_at":   now,
+			}).
+			Where(squirrel.Eq{"id": j.ID}).
+			PlaceholderFormat(squirrel.Dollar).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "squirrel")
+		}
+
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return errors.Wrap(err, "claim job")
+		}
+
+		job = &j
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "[queue.Claim]")
+	}
+
+	return job, nil
+}
+
+// Dead return dead jobs of queue, oldest first.
+func (q *Queue) Dead(ctx context.Context, limit uint64) ([]Job, error) {
+	cols, _ := orm.GetDataForSelect(&Job{})
+
+	query, args, err := squirrel.Select(cols...).
+		From(q.opts.Table).
+		Where(squirrel.Eq{"queue": q.name, "state": StateDead}).
+		OrderBy("id").
+		Limit(limit).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "[queue.Dead] squirrel")
+	}
+
+	jobs := []Job{}
+	if err = sqlx.SelectContext(ctx, q.db, &jobs, query, args...); err != nil {
+		return nil, errors.Wrap(err, "[queue.Dead] sqlx.SelectContext")
+	}
+
+	return jobs, nil
+}
+
+// Requeue move dead job back to queue with reset attempts, return false if job is not dead.
+func (q *Queue) Requeue(ctx context.Context, id int64) (bool, error) {
+	now := time.Now().UTC()
+
+	query, args, err := squirrel.Update(q.opts.Table).
+		SetMap(map[string]interface{}{"state": StatePending, "attempts": 0, "run_at": now, "updated_at": now}).
+		Where(squirrel.Eq{"id": id, "queue": q.name, "state": StateDead}).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return false, errors.Wrap(err, "[queue.Requeue] squirrel")
+	}
+
+	res, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "[queue.Requeue] db.ExecContext")
+	}
+
+	ra, err := res.RowsAffected()
+
+	return ra > 0, errors.Wrap(err, "[queue.Requeue] res.RowsAffected")
+}
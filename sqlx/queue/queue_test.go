@@ -0,0 +1,230 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/helper"
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type task struct {
+	N int `json:"n"`
+}
+
+func newTestDB() *repotest.DB {
+	return repotest.New(repotest.Table{Name: TableDefault, Columns: []string{
+		"id", "queue", "payload", "priority", "state", "attempts", "max_attempts", "last_error",
+		"run_at", "locked_by", "heartbeat_at", "created_at", "updated_at",
+	}})
+}
+
+func TestQueue_Claim(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB()
+	defer func() { _ = db.Close() }()
+
+	q := New(zap.NewNop(), db, "emails", Options{StaleTimeout: time.Minute})
+	other := New(zap.NewNop(), db, "other", Options{})
+
+	_, err := other.Enqueue(ctx, task{N: 0}, EnqueueOptions{})
+	assert.Nil(t, err)
+
+	low, err := q.Enqueue(ctx, task{N: 1}, EnqueueOptions{})
+	assert.Nil(t, err)
+	high, err := q.Enqueue(ctx, task{N: 2}, EnqueueOptions{Priority: 10})
+	assert.Nil(t, err)
+	_, err = q.Enqueue(ctx, task{N: 3}, EnqueueOptions{Priority: 100, RunAt: time.Now().Add(time.Hour)})
+	assert.Nil(t, err)
+
+	assert.NotNil(t, helper.WithTransaction(ctx, nil, db,
+		q.EnqueueFn(ctx, task{N: 4}, EnqueueOptions{}),
+		func(tx *sqlx.Tx) error { return errors.New("rollback") }))
+	assert.Equal(t, 4, len(db.Rows(TableDefault)))
+
+	job, err := q.Claim(ctx, "w1")
+	assert.Nil(t, err)
+	assert.Equal(t, high, job.ID, "priority first")
+	assert.Equal(t, StateRunning, job.State)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "w1", job.LockedBy)
+
+	var tk task
+	assert.Nil(t, job.Decode(&tk))
+	assert.Equal(t, 2, tk.N)
+
+	job, err = q.Claim(ctx, "w2")
+	assert.Nil(t, err)
+	assert.Equal(t, low, job.ID)
+
+	job, err = q.Claim(ctx, "w3")
+	assert.Nil(t, err)
+	assert.Nil(t, job, "future job is not ready")
+
+	// worker w1 died: heartbeat is stale
+	_, err = db.ExecContext(ctx, "UPDATE jobs SET heartbeat_at = $1 WHERE id = $2", time.Now().Add(-time.Hour), high)
+	assert.Nil(t, err)
+
+	job, err = q.Claim(ctx, "w3")
+	assert.Nil(t, err)
+	assert.Equal(t, high, job.ID)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, "w3", job.LockedBy)
+
+	// stale job without attempts left is dead
+	_, err = db.ExecContext(ctx, "UPDATE jobs SET heartbeat_at = $1, max_attempts = 2 WHERE id = $2",
+		time.Now().Add(-time.Hour), high)
+	assert.Nil(t, err)
+
+	job, err = q.Claim(ctx, "w4")
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+
+	dead, err := q.Dead(ctx, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(dead))
+	assert.Equal(t, errHeartbeatTimeout, dead[0].LastError)
+
+	ok, err := q.Requeue(ctx, high)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = q.Requeue(ctx, high)
+	assert.Nil(t, err)
+	assert.False(t, ok, "job is not dead")
+
+	job, err = q.Claim(ctx, "w5")
+	assert.Nil(t, err)
+	assert.Equal(t, high, job.ID)
+	assert.Equal(t, 1, job.Attempts)
+}
+
+func TestQueue_Work(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := newTestDB()
+	defer func() { _ = db.Close() }()
+
+	q := New(zap.NewNop(), db, "tasks", Options{
+		Workers:           3,
+		PollInterval:      time.Millisecond,
+		HeartbeatInterval: time.Millisecond,
+		RetryDelay:        time.Millisecond,
+		MaxRetryDelay:     time.Millisecond,
+		MaxAttempts:       3,
+	})
+
+	var (
+		mu      sync.Mutex
+		handled = map[int]int{}
+		all     = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+
+	for i := 1; i <= 5; i++ {
+		_, err := q.Enqueue(ctx, task{N: i}, EnqueueOptions{})
+		assert.Nil(t, err)
+	}
+
+	go func() {
+		q.Work(ctx, HandlerFunc(func(ctx context.Context, job Job) error {
+			var tk task
+			if err := job.Decode(&tk); err != nil {
+				return err
+			}
+
+			time.Sleep(3 * time.Millisecond) // several heartbeats
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			handled[tk.N]++
+
+			if len(handled) == 5 && handled[4] == 2 && handled[5] == 3 {
+				close(all)
+			}
+
+			switch {
+			case tk.N == 4 && handled[4] == 1:
+				return errors.New("temporary error")
+			case tk.N == 5:
+				panic("permanent error")
+			}
+
+			return nil
+		}))
+		close(stopped)
+	}()
+
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("jobs are not handled")
+	}
+
+	cancel()
+	<-stopped
+
+	states := map[int64]string{}
+	for _, row := range db.Rows(TableDefault) {
+		states[row["id"].(int64)] = row["state"].(string)
+	}
+	assert.Equal(t, map[int64]string{1: StateDone, 2: StateDone, 3: StateDone, 4: StateDone, 5: StateDead}, states)
+
+	dead, err := q.Dead(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(dead))
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "panic: permanent error", dead[0].LastError)
+}
+
+func TestQueue_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := newTestDB()
+	defer func() { _ = db.Close() }()
+
+	q := New(zap.NewNop(), db, "tasks", Options{PollInterval: time.Millisecond, ShutdownTimeout: 10 * time.Millisecond})
+
+	id, err := q.Enqueue(ctx, "long job", EnqueueOptions{})
+	assert.Nil(t, err)
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		q.Work(ctx, HandlerFunc(func(ctx context.Context, job Job) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+		close(stopped)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Work is not stopped")
+	}
+
+	row := db.Rows(TableDefault)[0]
+	assert.Equal(t, id, row["id"])
+	assert.Equal(t, StatePending, row["state"], "job is released")
+	assert.Equal(t, int64(0), row["attempts"])
+}
+
+func TestRetryDelay(t *testing.T) {
+	q := New(zap.NewNop(), nil, "q", Options{RetryDelay: time.Second, MaxRetryDelay: 5 * time.Second})
+
+	assert.Equal(t, time.Second, q.retryDelay(1))
+	assert.Equal(t, 2*time.Second, q.retryDelay(2))
+	assert.Equal(t, 5*time.Second, q.retryDelay(4))
+}
@@ -0,0 +1,388 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+const (
+	AuditCreate AuditAction = "create" // AuditCreate - row created by Create
+	AuditUpdate AuditAction = "update" // AuditUpdate - row updated by Update or UpdateCustom
+	AuditDelete AuditAction = "delete" // AuditDelete - row deleted by Delete
+
+	AuditTableDefault = "audit_log" // AuditTableDefault - default audit table
+)
+
+// ErrNotAudited - table is not audited (see Repositories.WithAudit).
+var ErrNotAudited = errors.New("repository: table is not audited")
+
+type (
+	// Actor - who made changes (user id, service name and etc).
+	Actor = string
+
+	// AuditAction - kind of change.
+	AuditAction = string
+
+	// AuditOptions - options of row-level change auditing for Repositories.
+	// Audit table must exist (in schema of tenant for TenantModeSchema, with discriminator column
+	// for TenantModeColumn), e.g. for Postgres:
+	//
+	//	CREATE TABLE audit_log (
+	//	    id         BIGSERIAL PRIMARY KEY,
+	//	    table_name TEXT        NOT NULL,
+	//	    row_id     TEXT        NOT NULL,
+	//	    action     TEXT        NOT NULL,
+	//	    actor      TEXT        NOT NULL DEFAULT '',
+	//	    before     JSONB,
+	//	    after      JSONB,
+	//	    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	//	);
+	//	CREATE INDEX audit_log_row_idx ON audit_log (table_name, row_id);
+	AuditOptions struct {
+		Table      Table   // audit table, default AuditTableDefault
+		Tables     []Table // audited tables, empty - all tables
+		SkipTables []Table // not audited tables
+	}
+
+	// AuditSnapshot - values of row by columns, stored as JSON.
+	AuditSnapshot map[Column]interface{}
+
+	// AuditRecord - row of audit table.
+	AuditRecord struct {
+		ID        int64         `db:"id"          orm_use_in:"select"`
+		TableName Table         `db:"table_name"  orm_use_in:"select,create"`
+		RowID     string        `db:"row_id"      orm_use_in:"select,create"`
+		Action    AuditAction   `db:"action"      orm_use_in:"select,create"`
+		Actor     Actor         `db:"actor"       orm_use_in:"select,create"`
+		Before    AuditSnapshot `db:"before"      orm_use_in:"select,create"` // nil for AuditCreate
+		After     AuditSnapshot `db:"after"       orm_use_in:"select,create"` // nil for AuditDelete
+		CreatedAt time.Time     `db:"created_at"  orm_use_in:"select,create"`
+	}
+
+	actorCtxKey struct{}
+)
+
+// WithActor return ctx with actor, which is written to audit records.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorCtxKey{}, actor)
+}
+
+// ActorFromContext return actor from ctx, empty if not set.
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorCtxKey{}).(Actor)
+	return actor
+}
+
+// Value - implementation of driver.Valuer, nil snapshot is NULL.
+func (s AuditSnapshot) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(map[Column]interface{}(s))
+	if err != nil {
+		return nil, errors.Wrap(err, "[AuditSnapshot.Value] json.Marshal")
+	}
+
+	return string(data), nil
+}
+
+// Scan - implementation of sql.Scanner.
+func (s *AuditSnapshot) Scan(src interface{}) error {
+	var data []byte
+
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.Errorf("[AuditSnapshot.Scan] unsupported type %T", src)
+	}
+
+	m := map[Column]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return errors.Wrap(err, "[AuditSnapshot.Scan] json.Unmarshal")
+	}
+
+	*s = m
+
+	return nil
+}
+
+// WithAudit return copy of Repositories where Create, Update, Delete and UpdateCustom of audited tables
+// write before/after snapshots of changed rows into audit table in the same transaction.
+// Snapshot columns are orm select columns of DTO (Create, Update) or all columns (Delete, UpdateCustom).
+// Insert is not audited (it does not return ids of rows).
+func (r Repositories) WithAudit(opts AuditOptions) Repositories {
+	if opts.Table == "" {
+		opts.Table = AuditTableDefault
+	}
+
+	only, skip := tableSet(opts.Tables), tableSet(opts.SkipTables)
+	skip[opts.Table] = true
+
+	mapRepo := make(Repositories, len(r))
+	for name, repo := range r {
+		cp := *repo
+		cp.audit = nil
+
+		if !skip[name] && (len(only) == 0 || only[name]) {
+			o := opts
+			cp.audit = &o
+		}
+
+		mapRepo[name] = &cp
+	}
+
+	return mapRepo
+}
+
+// AuditHistory return audit records of row id of table (of tenant from ctx), oldest first.
+// Inside transaction of ctx (e.g. in hooks) records of uncommitted changes are returned too.
+func (r Repositories) AuditHistory(ctx context.Context, table Table, id ID) ([]AuditRecord, error) {
+	repo, found := r[table]
+	if !found || repo.audit == nil {
+		return nil, ErrNotAudited
+	}
+
+	return repo.auditHistory(ctx, id)
+}
+
+func (r *repository) auditHistory(ctx context.Context, id ID) (_ []AuditRecord, err error) {
+	r.logger.Info("[repo.AuditHistory]", r.zapFieldRepo(), zapFieldID(id))
+
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "[repo.AuditHistory] scope")
+	}
+
+	columns, _ := orm.GetDataForSelect(&AuditRecord{})
+
+	query, args, err := squirrel.Select(columns...).
+		From(sc.qualify(r.audit.Table)).
+		Where(sc.where(squirrel.Eq{"table_name": r.name, "row_id": ConvertIDToString(id)})).
+		OrderBy("id").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "[repo.AuditHistory] squirrel")
+	}
+
+	records := []AuditRecord{}
+	if err = selectContext(ctx, r.conn(ctx), &records, query, args...); err != nil {
+		return nil, errors.Wrap(err, "[repo.AuditHistory] sqlx.SelectContext")
+	}
+
+	return records, nil
+}
+
+// auditCreate return TxFn which write audit record of created row, must be called after insert.
+func (r *repository) auditCreate(ctx context.Context, sc tenantScope, obj DTO, lastInsertID *ID) helper.TxFn {
+	return func(tx *sqlx.Tx) error {
+		ids, after, err := r.auditSnapshots(ctx, tx, sc, obj, squirrel.Eq{"id": *lastInsertID}, false)
+		if err != nil {
+			return errors.WithMessage(err, "after")
+		}
+
+		return r.writeAudit(ctx, tx, sc, AuditCreate, ids, nil, after)
+	}
+}
+
+// auditExec execute update or delete query and write audit records of rows matched by cond in one transaction.
+func (r *repository) auditExec(
+	ctx context.Context,
+	sc tenantScope,
+	action AuditAction,
+	obj DTO,
+	cond Condition,
+	query Query,
+	args ...interface{},
+) (int64, error) {
+	ra := RowsAffectedUnknown
+
+	err := r.withTransaction(ctx, func(tx *sqlx.Tx) error {
+		ids, before, err := r.auditSnapshots(ctx, tx, sc, obj, cond, true)
+		if err != nil {
+			return errors.WithMessage(err, "before")
+		}
+
+		res, err := r.txConn(tx).ExecContext(ctx, query, args...)
+		if err != nil {
+			return errors.Wrap(err, "tx.ExecContext")
+		}
+
+		if ra, err = res.RowsAffected(); err != nil {
+			return errors.Wrap(err, "res.RowsAffected")
+		}
+
+		var after map[string]AuditSnapshot
+		if action != AuditDelete && len(ids) > 0 {
+			if _, after, err = r.auditSnapshots(ctx, tx, sc, obj, squirrel.Eq{"id": ids}, false); err != nil {
+				return errors.WithMessage(err, "after")
+			}
+		}
+
+		return r.writeAudit(ctx, tx, sc, action, ids, before, after)
+	})
+	if err != nil {
+		return RowsAffectedUnknown, err
+	}
+
+	return ra, nil
+}
+
+// auditSnapshots select rows by cond, return their ids (in select order) and snapshots by id.
+func (r *repository) auditSnapshots(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	sc tenantScope,
+	obj DTO,
+	cond Condition,
+	forUpdate bool,
+) ([]ID, map[string]AuditSnapshot, error) {
+	qb := squirrel.Select(auditColumns(obj)...).
+		From(sc.table).
+		Where(cond).
+		PlaceholderFormat(squirrel.Dollar)
+	if forUpdate {
+		qb = qb.Suffix("FOR UPDATE")
+	}
+
+	query, args, err := qb.ToSql()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "squirrel")
+	}
+
+	rows, err := r.txConn(tx).QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "tx.QueryxContext")
+	}
+	defer func() { _ = rows.Close() }()
+
+	ids, snapshots := []ID{}, map[string]AuditSnapshot{}
+
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err = rows.MapScan(row); err != nil {
+			return nil, nil, errors.Wrap(err, "rows.MapScan")
+		}
+
+		snapshot := make(AuditSnapshot, len(row))
+		for col, val := range row {
+			if b, ok := val.([]byte); ok {
+				val = string(b)
+			}
+			snapshot[col] = val
+		}
+
+		ids = append(ids, snapshot["id"])
+		snapshots[ConvertIDToString(snapshot["id"])] = snapshot
+	}
+
+	return ids, snapshots, errors.Wrap(rows.Err(), "rows.Err")
+}
+
+// auditColumns return orm select columns of root table of obj (with id), or "*" if obj is not described by orm.
+func auditColumns(obj DTO) []Column {
+	if obj == nil {
+		return []Column{"*"}
+	}
+
+	selectCols, _ := orm.GetDataForSelect(obj)
+
+	cols, hasID := make([]Column, 0, len(selectCols)+1), false
+	for _, col := range selectCols {
+		if strings.ContainsAny(col, ". ") {
+			continue // column of joined table
+		}
+
+		hasID = hasID || col == "id"
+		cols = append(cols, col)
+	}
+
+	if len(cols) == 0 {
+		return []Column{"*"}
+	}
+
+	if !hasID {
+		cols = append(cols, "id")
+	}
+
+	return cols
+}
+
+// writeAudit insert audit records of rows ids into audit table, records are scoped by tenant like rows.
+func (r *repository) writeAudit(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	sc tenantScope,
+	action AuditAction,
+	ids []ID,
+	before, after map[string]AuditSnapshot,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	actor, now := ActorFromContext(ctx), time.Now().UTC()
+
+	var columns []Column
+
+	values := make([][]Argument, len(ids))
+	for i, id := range ids {
+		rowID := ConvertIDToString(id)
+
+		columns, values[i] = sc.insert(orm.GetDataForCreate(&AuditRecord{
+			TableName: r.name,
+			RowID:     rowID,
+			Action:    action,
+			Actor:     actor,
+			Before:    before[rowID],
+			After:     after[rowID],
+			CreatedAt: now,
+		}))
+	}
+
+	// records are inserted by batches, so count of placeholders of one INSERT is not greater than maxPlaceholders
+	batch := maxPlaceholders / len(columns)
+
+	for start := 0; start < len(values); start += batch {
+		end := start + batch
+		if end > len(values) {
+			end = len(values)
+		}
+
+		qb := squirrel.Insert(sc.qualify(r.audit.Table)).Columns(columns...).PlaceholderFormat(squirrel.Dollar)
+		for _, vals := range values[start:end] {
+			qb = qb.Values(vals...)
+		}
+
+		query, args, err := qb.ToSql()
+		if err != nil {
+			return errors.Wrap(err, "squirrel")
+		}
+
+		if _, err = r.txConn(tx).ExecContext(ctx, query, args...); err != nil {
+			return errors.Wrap(err, "insert audit records")
+		}
+	}
+
+	return nil
+}
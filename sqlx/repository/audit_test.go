@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+func TestAudit(t *testing.T) {
+	timestamps := repotest.Defaults{"created_at": repotest.Now, "updated_at": repotest.Now}
+
+	db := repotest.New(
+		repotest.Table{Name: "Paginators", Defaults: timestamps},
+		repotest.Table{Name: "Roles", Defaults: timestamps},
+		repotest.Table{Name: AuditTableDefault},
+	)
+	defer func() { _ = db.Close() }()
+
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators", "Roles", AuditTableDefault}, nil).
+		WithAudit(AuditOptions{SkipTables: []Table{"Roles"}})
+
+	ctx := WithActor(context.Background(), "admin")
+	repo := repos.Repo("Paginators")
+
+	id, err := repo.Create(ctx, &Paginator{Name: "first"})
+	assert.Nil(t, err)
+
+	cnt, err := repo.Update(ctx, id, &Paginator{Name: "second"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	_, err = repo.Create(ctx, &Paginator{Name: "other"})
+	assert.Nil(t, err)
+
+	cnt, err = repo.UpdateCustom(context.Background(), map[string]interface{}{"name": "third"}, squirrel.Eq{"id": id})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	cnt, err = repo.Delete(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	history, err := repos.AuditHistory(ctx, "Paginators", id)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(history))
+
+	actions := []AuditAction{}
+	for _, rec := range history {
+		actions = append(actions, rec.Action)
+		assert.Equal(t, "Paginators", rec.TableName)
+		assert.Equal(t, ConvertIDToString(id), rec.RowID)
+		assert.False(t, rec.CreatedAt.IsZero())
+	}
+	assert.Equal(t, []AuditAction{AuditCreate, AuditUpdate, AuditUpdate, AuditDelete}, actions)
+
+	assert.Nil(t, history[0].Before)
+	assert.Equal(t, "first", history[0].After["name"])
+	assert.Equal(t, "admin", history[0].Actor)
+
+	assert.Equal(t, "first", history[1].Before["name"])
+	assert.Equal(t, "second", history[1].After["name"])
+
+	assert.Equal(t, "", history[2].Actor)
+	assert.Equal(t, "third", history[2].After["name"])
+
+	assert.Equal(t, "third", history[3].Before["name"])
+	assert.Nil(t, history[3].After)
+
+	// skipped table
+	roleID, err := repos.Repo("Roles").Create(ctx, &Paginator{Name: "role"})
+	assert.Nil(t, err)
+	_, err = repos.AuditHistory(ctx, "Roles", roleID)
+	assert.Equal(t, ErrNotAudited, err)
+	assert.Equal(t, 5, len(db.Rows(AuditTableDefault)))
+
+	// audit record and change are written in one transaction
+	db.CreateTable(repotest.Table{Name: "strict_audit", Columns: []string{"id"}})
+	broken := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators"}, nil).
+		WithAudit(AuditOptions{Table: "strict_audit"}).Repo("Paginators")
+
+	_, err = broken.UpdateCustom(ctx, map[string]interface{}{"name": "lost"}, squirrel.NotEq{"id": 0})
+	assert.NotNil(t, err)
+	assert.Equal(t, "other", db.Rows("Paginators")[0]["name"])
+
+	_, err = broken.Create(ctx, &Paginator{Name: "lost"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(db.Rows("Paginators")))
+}
+
+func TestAudit_Tenancy(t *testing.T) {
+	db := repotest.New(
+		repotest.Table{Name: "Paginators", Defaults: tenantTimestamps},
+		repotest.Table{Name: AuditTableDefault},
+	)
+	defer func() { _ = db.Close() }()
+
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators", AuditTableDefault}, nil).
+		WithTenancy(TenantOptions{Mode: TenantModeColumn}).
+		WithAudit(AuditOptions{})
+
+	ctxA, ctxB := WithTenant(context.Background(), "a"), WithTenant(context.Background(), "b")
+
+	id, err := repos.Repo("Paginators").Create(ctxA, &TenantPaginator{Name: "first"})
+	assert.Nil(t, err)
+	assert.Equal(t, "a", db.Rows(AuditTableDefault)[0][TenantColumnDefault])
+
+	history, err := repos.AuditHistory(ctxA, "Paginators", id)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+
+	history, err = repos.AuditHistory(ctxB, "Paginators", id)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(history), "records of other tenant are not returned")
+
+	// history inside transaction of ctx sees uncommitted records
+	err = repos["Paginators"].inTransaction(ctxA, func(ctx context.Context, _ *sqlx.Tx) error {
+		_, err := repos.Repo("Paginators").Update(ctx, id, &TenantPaginator{Name: "second"})
+		assert.Nil(t, err)
+
+		history, err := repos.AuditHistory(ctx, "Paginators", id)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(history))
+
+		return errHook
+	})
+	assert.Equal(t, errHook, errors.Cause(err))
+}
+
+// auditInserts - TxConnector which records count of arguments of INSERTs into audit table.
+type auditInserts struct {
+	*repotest.DB
+	args []int
+}
+
+func (c *auditInserts) TxConn(tx *sqlx.Tx) sqlx.ExtContext {
+	return &auditInsertsTx{Tx: tx, c: c}
+}
+
+type auditInsertsTx struct {
+	*sqlx.Tx
+	c *auditInserts
+}
+
+func (t *auditInsertsTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if strings.HasPrefix(query, "INSERT INTO "+AuditTableDefault) {
+		t.c.args = append(t.c.args, len(args))
+	}
+
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func TestAudit_Batches(t *testing.T) {
+	db := repotest.New(
+		repotest.Table{Name: "Paginators", Defaults: tenantTimestamps},
+		repotest.Table{Name: AuditTableDefault},
+	)
+	defer func() { _ = db.Close() }()
+
+	const n = 10000
+
+	rows := make([]repotest.Row, n)
+	for i := range rows {
+		rows[i] = repotest.Row{"name": "row"}
+	}
+	_, err := db.Insert("Paginators", rows...)
+	assert.Nil(t, err)
+
+	conn := &auditInserts{DB: db}
+	repo := NewSqlxMapRepo(zap.NewNop(), conn, []Table{"Paginators", AuditTableDefault}, nil).
+		WithAudit(AuditOptions{}).Repo("Paginators")
+
+	cnt, err := repo.UpdateCustom(context.Background(), map[string]interface{}{"name": "updated"}, squirrel.NotEq{"id": 0})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(n), cnt)
+	assert.Equal(t, n, len(db.Rows(AuditTableDefault)))
+
+	assert.Equal(t, 2, len(conn.args))
+	for _, args := range conn.args {
+		assert.LessOrEqual(t, args, maxPlaceholders)
+	}
+}
+
+func TestAudit_Tables(t *testing.T) {
+	repos := NewSqlxMapRepo(zap.NewNop(), repotest.New(), []Table{"A", "B", "audit"}, nil).
+		WithAudit(AuditOptions{Table: "audit", Tables: []Table{"A", "audit"}})
+
+	assert.NotNil(t, repos["A"].audit)
+	assert.Nil(t, repos["B"].audit)
+	assert.Nil(t, repos["audit"].audit, "audit table is never audited")
+
+	_, err := repos.AuditHistory(context.Background(), "unknown", 1)
+	assert.Equal(t, ErrNotAudited, err)
+}
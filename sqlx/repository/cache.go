@@ -0,0 +1,340 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+
+	"github.com/imperiuse/golib/storage"
+)
+
+// CacheTTLDefault - default TTL of cached read results.
+const CacheTTLDefault = storage.TTLCacheDefault
+
+type (
+	// CacheBackend - storage for cached read results (e.g. storage.Store).
+	CacheBackend = storage.StoreI
+
+	// CacheOptions - options of read-through cache decorator.
+	CacheOptions struct {
+		TTL     time.Duration // 0 - CacheTTLDefault
+		Backend CacheBackend  // nil - in-memory map of decorator, expired results are removed by writes to it
+	}
+
+	// cachedRepository - read-through cache decorator around Repository.
+	// Results of Get, FindBy, FindOneBy, FindByExample, CountByQuery are cached by table+tenant+query+args.
+	// All cached results of the table are invalidated by Create, Insert, Update, Delete, UpdateCustom, CopyFrom, NamedExec.
+	// CountByQuery is cached too, so its query must select from the same table.
+	// Methods with joins, pagination, named queries and raw rows are not cached.
+	// Reads in transaction of hooks (see TxFromContext) are not cached.
+	cachedRepository struct {
+		Repository
+		ttl     time.Duration
+		backend CacheBackend
+	}
+
+	cacheEntry struct {
+		value    interface{}
+		expireAt time.Time
+	}
+
+	// memoryBackend - default CacheBackend, it has no background goroutine: expired entries are removed by Set
+	// when count of entries is doubled since last sweep.
+	memoryBackend struct {
+		mu    sync.Mutex
+		m     map[string]interface{}
+		sweep int // count of entries which triggers next sweep
+	}
+)
+
+const memoryBackendSweepMin = 1024
+
+// NewCachedRepository wrap repo by read-through cache.
+// Invalidation works only for writes made through returned Repository (or another one with the same Backend),
+// writes made by PureConnector() or other services are visible after TTL.
+func NewCachedRepository(repo Repository, opts CacheOptions) Repository {
+	if opts.TTL == 0 {
+		opts.TTL = CacheTTLDefault
+	}
+
+	if opts.Backend == nil {
+		opts.Backend = &memoryBackend{m: map[string]interface{}{}, sweep: memoryBackendSweepMin}
+	}
+
+	return &cachedRepository{
+		Repository: repo,
+		ttl:        opts.TTL,
+		backend:    opts.Backend,
+	}
+}
+
+func (b *memoryBackend) Get(key storage.Key) (interface{}, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	v, found := b.m[key]
+
+	return v, found
+}
+
+func (b *memoryBackend) Set(key storage.Key, value interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.m[key] = value
+	if len(b.m) < b.sweep {
+		return
+	}
+
+	now := time.Now()
+	for k, v := range b.m {
+		if entry, ok := v.(cacheEntry); ok && now.After(entry.expireAt) {
+			delete(b.m, k)
+		}
+	}
+
+	if b.sweep = 2 * len(b.m); b.sweep < memoryBackendSweepMin {
+		b.sweep = memoryBackendSweepMin
+	}
+}
+
+// generationKey - key of current generation of table cache. New generation makes all previous keys unreachable,
+// so backend does not need delete by prefix.
+func (c *cachedRepository) generationKey() string {
+	return "repo_cache_gen|" + c.Name()
+}
+
+func (c *cachedRepository) generation() string {
+	if gen, found := c.backend.Get(c.generationKey()); found {
+		if s, ok := gen.(string); ok {
+			return s
+		}
+	}
+
+	return c.invalidate()
+}
+
+var cacheGenerationSeq uint64
+
+func (c *cachedRepository) invalidate() string {
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36) + "." +
+		strconv.FormatUint(atomic.AddUint64(&cacheGenerationSeq, 1), 36)
+	c.backend.Set(c.generationKey(), gen)
+
+	return gen
+}
+
+// written invalidate cache after write. Write in transaction of ctx is invalidated again after commit,
+// so results cached by reads of other connections before commit are not used.
+func (c *cachedRepository) written(ctx context.Context) {
+	c.invalidate()
+
+	if _, ok := TxFromContext(ctx); ok {
+		afterCommit(ctx, func() { c.invalidate() })
+	}
+}
+
+func (c *cachedRepository) key(ctx context.Context, dest interface{}, method string, parts ...interface{}) string {
+	var sb strings.Builder
+
+	tenant, _ := TenantFromContext(ctx)
+
+	_, _ = fmt.Fprintf(&sb, "repo_cache|%s|%s|%s|%s|%T", c.Name(), c.generation(), tenant, method, dest)
+	for _, p := range parts {
+		_, _ = fmt.Fprintf(&sb, "|%#v", p)
+	}
+
+	return sb.String()
+}
+
+func sqlizerKey(cond Condition) []interface{} {
+	if cond == nil {
+		return []interface{}{nil}
+	}
+
+	query, args, err := cond.ToSql()
+	if err != nil {
+		return []interface{}{fmt.Sprintf("%#v", cond)}
+	}
+
+	return []interface{}{query, args}
+}
+
+func (c *cachedRepository) load(key string, dest interface{}) bool {
+	v, found := c.backend.Get(key)
+	if !found {
+		return false
+	}
+
+	entry, ok := v.(cacheEntry)
+	if !ok || time.Now().After(entry.expireAt) {
+		return false
+	}
+
+	return copyToDest(entry.value, dest)
+}
+
+func (c *cachedRepository) store(key string, dest interface{}) {
+	if value, ok := cloneDest(dest); ok {
+		c.backend.Set(key, cacheEntry{value: value, expireAt: time.Now().Add(c.ttl)})
+	}
+}
+
+// readThrough try load dest from cache, otherwise call fn and cache dest on success.
+// Reads in transaction of ctx (see TxFromContext) bypass cache: they can see uncommitted changes of transaction.
+func (c *cachedRepository) readThrough(ctx context.Context, key string, dest interface{}, fn func() error) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return fn()
+	}
+
+	if c.load(key, dest) {
+		return nil
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	c.store(key, dest)
+
+	return nil
+}
+
+// cloneDest return copy of value pointed by dest, slices are copied too (elements are copied shallow).
+func cloneDest(dest interface{}) (interface{}, bool) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, false
+	}
+
+	return cloneValue(v.Elem()).Interface(), true
+}
+
+func cloneValue(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Slice && !v.IsNil() {
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(cp, v)
+
+		return cp
+	}
+
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+
+	return cp
+}
+
+func copyToDest(value interface{}, dest interface{}) bool {
+	d := reflect.ValueOf(dest)
+	v := reflect.ValueOf(value)
+
+	if d.Kind() != reflect.Ptr || d.IsNil() || !v.IsValid() || v.Type() != d.Elem().Type() {
+		return false
+	}
+
+	d.Elem().Set(cloneValue(v))
+
+	return true
+}
+
+func (c *cachedRepository) Get(ctx context.Context, id ID, dest DTO) error {
+	return c.readThrough(ctx, c.key(ctx, dest, "Get", id), dest, func() error {
+		return c.Repository.Get(ctx, id, dest)
+	})
+}
+
+func (c *cachedRepository) FindBy(ctx context.Context, columns []Column, cond Condition, target DTO) error {
+	key := c.key(ctx, target, "FindBy", append([]interface{}{columns}, sqlizerKey(cond)...)...)
+
+	return c.readThrough(ctx, key, target, func() error {
+		return c.Repository.FindBy(ctx, columns, cond, target)
+	})
+}
+
+func (c *cachedRepository) FindOneBy(ctx context.Context, columns []Column, cond Condition, target DTO) error {
+	key := c.key(ctx, target, "FindOneBy", append([]interface{}{columns}, sqlizerKey(cond)...)...)
+
+	return c.readThrough(ctx, key, target, func() error {
+		return c.Repository.FindOneBy(ctx, columns, cond, target)
+	})
+}
+
+func (c *cachedRepository) FindByExample(ctx context.Context, example DTO, opts ExampleOptions, target DTO) error {
+	if v := reflect.ValueOf(example); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return c.Repository.FindByExample(ctx, example, opts, target) // nil example is not cached
+	}
+
+	key := c.key(ctx, target, "FindByExample", reflect.Indirect(reflect.ValueOf(example)).Interface(), opts)
+
+	return c.readThrough(ctx, key, target, func() error {
+		return c.Repository.FindByExample(ctx, example, opts, target)
+	})
+}
+
+func (c *cachedRepository) CountByQuery(ctx context.Context, qb squirrel.SelectBuilder) (uint64, error) {
+	var cnt uint64
+
+	err := c.readThrough(ctx, c.key(ctx, &cnt, "CountByQuery", sqlizerKey(qb)...), &cnt, func() (err error) {
+		cnt, err = c.Repository.CountByQuery(ctx, qb)
+		return err
+	})
+
+	return cnt, err
+}
+
+func (c *cachedRepository) Create(ctx context.Context, obj DTO) (ID, error) {
+	defer c.written(ctx)
+	return c.Repository.Create(ctx, obj)
+}
+
+func (c *cachedRepository) Insert(ctx context.Context, columns []Column, values []Argument) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.Insert(ctx, columns, values)
+}
+
+func (c *cachedRepository) Update(ctx context.Context, id ID, obj DTO) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.Update(ctx, id, obj)
+}
+
+func (c *cachedRepository) UpdateFields(ctx context.Context, id ID, obj DTO, fields ...string) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.UpdateFields(ctx, id, obj, fields...)
+}
+
+func (c *cachedRepository) Save(ctx context.Context, obj DtoWithIdentity) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.Save(ctx, obj)
+}
+
+func (c *cachedRepository) Delete(ctx context.Context, id ID) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.Delete(ctx, id)
+}
+
+func (c *cachedRepository) DeleteDTO(ctx context.Context, obj DtoWithIdentity) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.DeleteDTO(ctx, obj)
+}
+
+func (c *cachedRepository) UpdateCustom(ctx context.Context, set map[string]interface{}, cond Condition) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.UpdateCustom(ctx, set, cond)
+}
+
+func (c *cachedRepository) CopyFrom(ctx context.Context, src CopySource, opts CopyOptions) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.CopyFrom(ctx, src, opts)
+}
+
+func (c *cachedRepository) NamedExec(ctx context.Context, query Query, arg interface{}) (int64, error) {
+	defer c.written(ctx)
+	return c.Repository.NamedExec(ctx, query, arg)
+}
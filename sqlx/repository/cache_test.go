@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+	"github.com/imperiuse/golib/storage"
+)
+
+func TestCachedRepository(t *testing.T) {
+	ctx := context.Background()
+
+	db := repotest.New(repotest.Table{Name: "Roles", Defaults: repotest.Defaults{
+		"created_at": repotest.Now,
+		"updated_at": repotest.Now,
+	}})
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Roles", repotest.Row{"name": "admin", "rights": 100}, repotest.Row{"name": "user", "rights": 10})
+	assert.Nil(t, err)
+
+	backend := storage.New(time.Minute, 0)
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Roles"}, nil)
+	repo := NewCachedRepository(repos.Repo("Roles"), CacheOptions{Backend: backend})
+	assert.Equal(t, "Roles", repo.Name())
+
+	var role Role
+	assert.Nil(t, repo.Get(ctx, 1, &role))
+	assert.Equal(t, "admin", role.Name)
+
+	var roles []Role
+	assert.Nil(t, repo.FindBy(ctx, []Column{"*"}, squirrel.Gt{"rights": 0}, &roles))
+	assert.Equal(t, 2, len(roles))
+
+	cnt, err := repo.CountByQuery(ctx, squirrel.Select("count(1)").From("Roles"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), cnt)
+
+	// change data bypass repository, cached results must be returned
+	_, err = db.ExecContext(ctx, "UPDATE Roles SET name = 'changed'")
+	assert.Nil(t, err)
+	_, err = db.Insert("Roles", repotest.Row{"name": "guest", "rights": 1})
+	assert.Nil(t, err)
+
+	var cached Role
+	assert.Nil(t, repo.Get(ctx, 1, &cached))
+	assert.Equal(t, role, cached)
+
+	roles[0].Name = "mutate cached slice"
+	var cachedRoles []Role
+	assert.Nil(t, repo.FindBy(ctx, []Column{"*"}, squirrel.Gt{"rights": 0}, &cachedRoles))
+	assert.Equal(t, 2, len(cachedRoles))
+	assert.Equal(t, "admin", cachedRoles[0].Name)
+
+	cnt, err = repo.CountByQuery(ctx, squirrel.Select("count(1)").From("Roles"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), cnt)
+
+	// other args, other key
+	assert.Nil(t, repo.Get(ctx, 2, &cached))
+	assert.Equal(t, "changed", cached.Name)
+
+	// write through repository invalidate all cached results of table
+	_, err = repo.UpdateCustom(ctx, map[string]interface{}{"rights": 5}, squirrel.Eq{"id": 3})
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.Get(ctx, 1, &cached))
+	assert.Equal(t, "changed", cached.Name)
+
+	cnt, err = repo.CountByQuery(ctx, squirrel.Select("count(1)").From("Roles"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), cnt)
+
+	// other decorator with the same backend see invalidation too
+	repo2 := NewCachedRepository(repos.Repo("Roles"), CacheOptions{Backend: backend})
+	_, err = repo2.Delete(ctx, 3)
+	assert.Nil(t, err)
+
+	cnt, err = repo.CountByQuery(ctx, squirrel.Select("count(1)").From("Roles"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), cnt)
+
+	// errors are not cached
+	assert.NotNil(t, repo.Get(ctx, 100, &cached))
+	_, err = db.Insert("Roles", repotest.Row{"id": 100, "name": "new", "rights": 0})
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Get(ctx, 100, &cached))
+	assert.Equal(t, "new", cached.Name)
+}
+
+func TestCachedRepository_Transaction(t *testing.T) {
+	ctx := context.Background()
+
+	db := repotest.New(repotest.Table{Name: "Roles", Defaults: repotest.Defaults{
+		"created_at": repotest.Now,
+		"updated_at": repotest.Now,
+	}})
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Roles", repotest.Row{"name": "admin", "rights": 100})
+	assert.Nil(t, err)
+
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Roles"}, nil)
+	repo := NewCachedRepository(repos.Repo("Roles"), CacheOptions{})
+
+	var role Role
+	assert.Nil(t, repo.Get(ctx, 1, &role))
+
+	err = repos["Roles"].inTransaction(ctx, func(txCtx context.Context, _ *sqlx.Tx) error {
+		_, err := repo.UpdateCustom(txCtx, map[string]interface{}{"name": "changed"}, squirrel.Eq{"id": 1})
+		assert.Nil(t, err)
+
+		assert.Nil(t, repo.Get(txCtx, 1, &role))
+		assert.Equal(t, "changed", role.Name, "read in transaction bypass cache")
+
+		assert.Nil(t, repo.Get(ctx, 1, &role))
+		assert.Equal(t, "admin", role.Name, "change is not committed yet")
+
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.Get(ctx, 1, &role))
+	assert.Equal(t, "changed", role.Name, "cache is invalidated after commit")
+
+	err = repos["Roles"].inTransaction(ctx, func(txCtx context.Context, _ *sqlx.Tx) error {
+		return repo.FindOneBy(txCtx, nil, squirrel.Eq{"id": 1}, &role)
+	})
+	assert.Nil(t, err)
+
+	_, err = db.ExecContext(ctx, "UPDATE Roles SET name = 'bypass'")
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.FindOneBy(ctx, nil, squirrel.Eq{"id": 1}, &role))
+	assert.Equal(t, "bypass", role.Name, "read in transaction is not cached")
+}
+
+func TestCachedRepository_NilExample(t *testing.T) {
+	db := repotest.New(repotest.Table{Name: "Roles", Defaults: repotest.Defaults{
+		"created_at": repotest.Now,
+		"updated_at": repotest.Now,
+	}})
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Roles", repotest.Row{"name": "admin", "rights": 100})
+	assert.Nil(t, err)
+
+	repo := NewCachedRepository(newRepository(zap.NewNop(), db, "Roles"), CacheOptions{})
+
+	var roles []Role
+	assert.Nil(t, repo.FindByExample(context.Background(), nil, ExampleOptions{}, &roles))
+	assert.Equal(t, 1, len(roles))
+
+	var role *Role
+	roles = nil
+	assert.Nil(t, repo.FindByExample(context.Background(), role, ExampleOptions{}, &roles))
+	assert.Equal(t, 1, len(roles))
+}
+
+func TestMemoryBackend(t *testing.T) {
+	b := &memoryBackend{m: map[string]interface{}{}, sweep: memoryBackendSweepMin}
+
+	b.Set("gen", "1")
+	for i := 1; i < memoryBackendSweepMin; i++ { // the last Set makes memoryBackendSweepMin entries
+		b.Set(strconv.Itoa(i), cacheEntry{value: i, expireAt: time.Now().Add(-time.Second)})
+	}
+
+	assert.Equal(t, 1, len(b.m), "expired entries are removed")
+	assert.Equal(t, memoryBackendSweepMin, b.sweep)
+
+	v, found := b.Get("gen")
+	assert.True(t, found)
+	assert.Equal(t, "1", v)
+}
+
+func TestCachedRepository_TTL(t *testing.T) {
+	ctx := context.Background()
+
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Paginators", repotest.Row{"name": "first"})
+	assert.Nil(t, err)
+
+	repo := NewCachedRepository(newRepository(zap.NewNop(), db, "Paginators"), CacheOptions{TTL: 50 * time.Millisecond})
+
+	type P struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	var p P
+	assert.Nil(t, repo.Get(ctx, 1, &p))
+
+	_, err = db.ExecContext(ctx, "UPDATE Paginators SET name = 'second'")
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.Get(ctx, 1, &p))
+	assert.Equal(t, "first", p.Name)
+
+	time.Sleep(60 * time.Millisecond)
+
+	assert.Nil(t, repo.Get(ctx, 1, &p))
+	assert.Equal(t, "second", p.Name)
+}
@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+const (
+	CopyBatchSizeDefault = 1000  // CopyBatchSizeDefault - default rows per INSERT statement and progress step
+	maxPlaceholders      = 65535 // maxPlaceholders - max count of bind parameters in one Postgres statement
+)
+
+var (
+	// ErrCopyColumnsMismatch - DTOs of one CopyFrom call have different create columns.
+	ErrCopyColumnsMismatch = errors.New("repository: CopyFrom DTOs must have the same create columns")
+	// ErrCopyNoColumns - DTO of CopyFrom has no create columns.
+	ErrCopyNoColumns = errors.New("repository: CopyFrom DTO has no create columns")
+
+	errNotPgxConn = errors.New("not pgx connection")
+)
+
+type (
+	// CopySource - iterator of DTOs for CopyFrom.
+	CopySource interface {
+		Next() bool // move to next DTO, false if no more DTOs or error
+		DTO() DTO   // current DTO
+		Err() error // error of iteration
+	}
+
+	// CopyOptions - options of CopyFrom.
+	CopyOptions struct {
+		BatchSize int              // rows per INSERT statement of fallback and progress step, 0 - CopyBatchSizeDefault
+		Progress  func(rows int64) // called after every BatchSize rows and at the end with total count of rows
+	}
+
+	// dbConnector - db which opens dedicated connection (e.g. *sqlx.DB), it is used by COPY.
+	dbConnector interface {
+		Conn(ctx context.Context) (*sql.Conn, error)
+	}
+
+	sliceCopySource struct {
+		v reflect.Value
+		i int
+	}
+
+	// copyRows - adapter of CopySource to pgx.CopyFromSource, columns are create columns of first DTO.
+	copyRows struct {
+		src      CopySource
+		sc       tenantScope
+		opts     CopyOptions
+		columns  []Column
+		values   []Argument
+		peeked   bool
+		progress bool // report progress in Next (COPY)
+		err      error
+		rows     int64
+		reported int64
+	}
+)
+
+// CopyFromSlice return CopySource of slice of DTOs (structs or pointers to structs).
+func CopyFromSlice(slice interface{}) CopySource {
+	v := reflect.Indirect(reflect.ValueOf(slice))
+	if v.Kind() != reflect.Slice {
+		v = reflect.ValueOf([]DTO{})
+	}
+
+	return &sliceCopySource{v: v, i: -1}
+}
+
+func (s *sliceCopySource) Next() bool {
+	s.i++
+	return s.i < s.v.Len()
+}
+
+func (s *sliceCopySource) DTO() DTO {
+	return s.v.Index(s.i).Interface()
+}
+
+func (s *sliceCopySource) Err() error {
+	return nil
+}
+
+// CopyFrom bulk insert DTOs from src, columns are calculated by orm.GetDataForCreate.
+// For pgx driver (github.com/jackc/pgx/v4/stdlib) it uses COPY protocol,
+// for other drivers - multi-row INSERT by batches, all batches are inserted in one transaction.
+// CopyFrom is not audited.
+func (r *repository) CopyFrom(ctx context.Context, src CopySource, opts CopyOptions) (_ int64, err error) {
+	r.logger.Info("[repo.CopyFrom]", r.zapFieldRepo(), zap.Int("batch_size", opts.BatchSize))
+
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.CopyFrom] scope")
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = CopyBatchSizeDefault
+	}
+
+	rows := &copyRows{src: src, sc: sc, opts: opts}
+	if !rows.peek() {
+		return RowsAffectedUnknown, errors.WithMessage(rows.Err(), "[repo.CopyFrom] source")
+	}
+
+	if len(rows.columns) == 0 {
+		return RowsAffectedUnknown, errors.WithMessage(ErrCopyNoColumns, "[repo.CopyFrom]")
+	}
+
+	cnt, err := r.copyPgx(ctx, sc, rows)
+	if errors.Cause(err) == errNotPgxConn {
+		cnt, err = r.copyInsert(ctx, sc, rows)
+	}
+
+	if err != nil {
+		return RowsAffectedUnknown, errors.WithMessage(err, "[repo.CopyFrom]")
+	}
+
+	rows.report(cnt)
+
+	return cnt, nil
+}
+
+// dedicatedConnector return db (or db wrapped by StmtCache) if it opens dedicated connections.
+func dedicatedConnector(db SqlxDBConnectorI) (dbConnector, bool) {
+	if cache, ok := db.(*StmtCache); ok {
+		db = cache.SqlxDBConnectorI
+	}
+
+	connector, ok := db.(dbConnector)
+
+	return connector, ok
+}
+
+// copyPgx copy rows by pgx COPY protocol on dedicated connection, statement_timeout is set like in withTransaction.
+// Return errNotPgxConn if connection is not pgx or ctx has transaction (rows are not consumed).
+func (r *repository) copyPgx(ctx context.Context, sc tenantScope, rows *copyRows) (int64, error) {
+	if _, ok := TxFromContext(ctx); ok {
+		return 0, errNotPgxConn // COPY can't be executed in transaction of database/sql
+	}
+
+	connector, ok := dedicatedConnector(r.db)
+	if !ok {
+		return 0, errNotPgxConn
+	}
+
+	conn, err := connector.Conn(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "db.Conn")
+	}
+	defer func() { _ = conn.Close() }()
+
+	// pgx.Identifier quotes names: table and columns are unquoted in other queries, so they are folded
+	// to lower case like Postgres does, schema is quoted in other queries too (see tenantScope.qualify)
+	table := pgx.Identifier{strings.ToLower(r.name)}
+	if sc.schema != "" {
+		table = pgx.Identifier{sc.schema, strings.ToLower(r.name)}
+	}
+
+	columns := make([]string, len(rows.columns))
+	for i, col := range rows.columns {
+		columns[i] = strings.ToLower(col)
+	}
+
+	var cnt int64
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errNotPgxConn
+		}
+
+		rows.progress = true
+
+		timeout, ok := r.statementTimeout(ctx)
+		if !ok {
+			var errCopy error
+			cnt, errCopy = c.Conn().CopyFrom(ctx, table, columns, rows)
+
+			return errCopy
+		}
+
+		tx, err := c.Conn().Begin(ctx)
+		if err != nil {
+			return errors.Wrap(err, "begin")
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		if _, err = tx.Exec(ctx, helper.StatementTimeoutQuery(timeout)); err != nil {
+			return errors.Wrap(err, "statement_timeout")
+		}
+
+		if cnt, err = tx.CopyFrom(ctx, table, columns, rows); err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	})
+	if err != nil && err != errNotPgxConn {
+		return 0, errors.Wrap(err, "pgx.CopyFrom")
+	}
+
+	return cnt, err
+}
+
+// copyInsert insert rows by batches of multi-row INSERT in one transaction.
+func (r *repository) copyInsert(ctx context.Context, sc tenantScope, rows *copyRows) (int64, error) {
+	batch := rows.opts.BatchSize
+	if max := maxPlaceholders / len(rows.columns); batch > max {
+		batch = max
+	}
+
+	var total int64
+
+	err := r.withTransaction(ctx, func(tx *sqlx.Tx) error {
+		conn := r.txConn(tx)
+
+		for {
+			qb := squirrel.Insert(sc.table).Columns(rows.columns...).PlaceholderFormat(squirrel.Dollar)
+
+			cnt := 0
+			for ; cnt < batch && rows.Next(); cnt++ {
+				values, _ := rows.Values()
+				qb = qb.Values(values...)
+			}
+
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			if cnt == 0 {
+				return nil
+			}
+
+			query, args, err := qb.ToSql()
+			if err != nil {
+				return errors.Wrap(err, "squirrel")
+			}
+
+			if _, err = conn.ExecContext(ctx, query, args...); err != nil {
+				return errors.Wrap(err, "tx.ExecContext")
+			}
+
+			total += int64(cnt)
+			rows.report(total)
+
+			if cnt < batch {
+				return nil
+			}
+		}
+	})
+
+	return total, err
+}
+
+// peek read first DTO to calculate columns, return false if source is empty or failed.
+func (c *copyRows) peek() bool {
+	if !c.src.Next() {
+		return false
+	}
+
+	c.columns, c.values = c.sc.insert(orm.GetDataForCreate(c.src.DTO()))
+	c.peeked = true
+
+	return true
+}
+
+// Next - implementation of pgx.CopyFromSource.
+func (c *copyRows) Next() bool {
+	if c.err != nil {
+		return false
+	}
+
+	if c.peeked {
+		c.peeked = false
+	} else {
+		if !c.src.Next() {
+			return false
+		}
+
+		var columns []Column
+		columns, c.values = c.sc.insert(orm.GetDataForCreate(c.src.DTO()))
+
+		if !equalColumns(columns, c.columns) {
+			c.err = ErrCopyColumnsMismatch
+			return false
+		}
+	}
+
+	c.rows++
+	if c.progress && c.rows%int64(c.opts.BatchSize) == 0 {
+		c.report(c.rows)
+	}
+
+	return true
+}
+
+// Values - implementation of pgx.CopyFromSource.
+func (c *copyRows) Values() ([]interface{}, error) {
+	return c.values, nil
+}
+
+// Err - implementation of pgx.CopyFromSource.
+func (c *copyRows) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.src.Err()
+}
+
+func (c *copyRows) report(rows int64) {
+	if c.opts.Progress != nil && rows != c.reported {
+		c.reported = rows
+		c.opts.Progress(rows)
+	}
+}
+
+func equalColumns(a, b []Column) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type rolesSource struct {
+	n, i int
+	err  error
+}
+
+func (s *rolesSource) Next() bool {
+	if s.i == s.n {
+		return false
+	}
+	s.i++
+
+	return true
+}
+
+func (s *rolesSource) DTO() DTO {
+	return &Role{Name: "role", Rights: s.i}
+}
+
+func (s *rolesSource) Err() error {
+	return s.err
+}
+
+func TestCopyFrom_Insert(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Roles"}, nil).Repo("Roles")
+	ctx := context.Background()
+
+	progress := []int64{}
+	cnt, err := repo.CopyFrom(ctx, &rolesSource{n: 25}, CopyOptions{
+		BatchSize: 10,
+		Progress:  func(rows int64) { progress = append(progress, rows) },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(25), cnt)
+	assert.Equal(t, []int64{10, 20, 25}, progress)
+
+	rows := db.Rows("Roles")
+	assert.Equal(t, 25, len(rows))
+	assert.Equal(t, int64(25), rows[24]["rights"])
+
+	cnt, err = repo.CopyFrom(ctx, CopyFromSlice([]Role{{Name: "a"}, {Name: "b"}}), CopyOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	cnt, err = repo.CopyFrom(ctx, CopyFromSlice([]*Role{}), CopyOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+
+	// all batches in one transaction
+	errSource := errors.New("broken source")
+	_, err = repo.CopyFrom(ctx, &rolesSource{n: 25, err: errSource}, CopyOptions{BatchSize: 10})
+	assert.Equal(t, errSource, errors.Cause(err))
+	assert.Equal(t, 27, len(db.Rows("Roles")))
+
+	_, err = repo.CopyFrom(ctx, CopyFromSlice([]DTO{&Role{Name: "a"}, &Paginator{Name: "b"}}), CopyOptions{})
+	assert.Equal(t, ErrCopyColumnsMismatch, errors.Cause(err))
+	assert.Equal(t, 27, len(db.Rows("Roles")))
+
+	type noCreate struct {
+		ID int64 `db:"id" orm_use_in:"select"`
+	}
+	_, err = repo.CopyFrom(ctx, CopyFromSlice([]noCreate{{}}), CopyOptions{})
+	assert.Equal(t, ErrCopyNoColumns, errors.Cause(err))
+
+	// rows are inserted in transaction of ctx
+	r := repo.(*repository)
+	err = r.inTransaction(ctx, func(ctx context.Context, _ *sqlx.Tx) error {
+		cnt, err := repo.CopyFrom(ctx, CopyFromSlice([]Role{{Name: "tx"}}), CopyOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), cnt)
+
+		return errSource
+	})
+	assert.Equal(t, errSource, errors.Cause(err))
+	assert.Equal(t, 27, len(db.Rows("Roles")))
+}
+
+func TestDedicatedConnector(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	connector, ok := dedicatedConnector(db)
+	assert.True(t, ok)
+	assert.Equal(t, db, connector)
+
+	connector, ok = dedicatedConnector(NewStmtCache(db, StmtCacheOptions{}))
+	assert.True(t, ok, "StmtCache is unwrapped")
+	assert.Equal(t, db, connector)
+}
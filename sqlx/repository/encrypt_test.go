@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type Credential struct {
+	ID    int64   `db:"id"     orm_use_in:"select"`
+	Login string  `db:"login"  orm_use_in:"select,create,update"`
+	Token string  `db:"token"  orm_use_in:"select,create,update" orm_encrypt:"tokens"`
+	Phone *string `db:"phone"  orm_use_in:"select,create,update" orm_encrypt:"tokens"`
+}
+
+func TestEncryptedFields(t *testing.T) {
+	orm.SetKeyProvider(orm.KeyRing{
+		"tokens": {Current: "v1", Keys: map[string][]byte{"v1": []byte("0123456789abcdef0123456789abcdef")}},
+	})
+	defer orm.SetKeyProvider(nil)
+
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Credentials"}, nil).Repo("Credentials")
+
+	phone := "+100"
+	id, err := repo.Create(ctx, &Credential{Login: "bob", Token: "secret", Phone: &phone})
+	assert.Nil(t, err)
+	_, err = repo.Create(ctx, &Credential{Login: "alice", Token: "other"})
+	assert.Nil(t, err)
+
+	stored := db.Rows("Credentials")[0]
+	assert.Equal(t, "bob", stored["login"])
+	assert.NotContains(t, stored["token"], "secret", "token is encrypted at rest")
+	keyID, err := orm.CiphertextKeyID(stored["token"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", keyID)
+	assert.Nil(t, db.Rows("Credentials")[1]["phone"])
+
+	var credential Credential
+	assert.Nil(t, repo.Get(ctx, id, &credential))
+	assert.Equal(t, "secret", credential.Token)
+	assert.Equal(t, "+100", *credential.Phone)
+
+	var credentials []*Credential
+	assert.Nil(t, repo.FindBy(ctx, nil, squirrel.Gt{"id": 0}, &credentials))
+	if assert.Len(t, credentials, 2) {
+		assert.Equal(t, "other", credentials[1].Token)
+		assert.Nil(t, credentials[1].Phone)
+	}
+}
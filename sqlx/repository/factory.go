@@ -4,6 +4,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"fmt"
 
 	"github.com/imperiuse/golib/reflect/orm"
 	"github.com/imperiuse/golib/sqlx/helper"
@@ -11,6 +12,7 @@ import (
 	"github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 var ErrNotFoundAnyRepo = errors.New("not found any repo (connectors)")
@@ -49,24 +51,38 @@ type (
 	Repository interface {
 		// Pure Sqlx Db Connector which we pass to NewSqlxMapRepo
 		PureConnector() SqlxDBConnectorI
+		// Name of repo (table name)
+		Name() Repo
 
-		// usual "CRUD"
+		// usual "CRUD", hooks of DTO (BeforeCreateHook, AfterCreateHook, BeforeUpdateHook, BeforeDeleteHook,
+		// AfterLoadHook) are called inside transaction of operation, orm_validate rules of DTO are checked
+		// by Create, Update, UpdateFields and Save before SQL is built (error cause is orm.ValidationErrors)
 		Create(context.Context, DTO) (ID, error)
 		Get(context.Context, ID, DTO) error
 		Update(context.Context, ID, DTO) (int64, error)
+		UpdateFields(ctx context.Context, id ID, obj DTO, fields ...string) (int64, error)
+		Save(ctx context.Context, obj DtoWithIdentity) (int64, error)
 		Delete(context.Context, ID) (int64, error)
+		DeleteDTO(ctx context.Context, obj DtoWithIdentity) (int64, error)
 
 		Insert(context.Context, []Column, []Argument) (int64, error)
 		UpdateCustom(context.Context, map[string]interface{}, Condition) (int64, error)
+		CopyFrom(context.Context, CopySource, CopyOptions) (int64, error)
 
+		// empty columns - select columns of DTO (orm_use_in:"select"), composite DTO (orm_join) is selected from join
 		FindBy(context.Context, []Column, Condition, DTO) error
 		FindOneBy(context.Context, []Column, Condition, DTO) error
+		FindByExample(context.Context, DTO, ExampleOptions, DTO) error
 
 		FindByWithInnerJoin(context.Context, []Column, Alias, Join, Condition, DTO) error
 		FindOneByWithInnerJoin(context.Context, []Column, Alias, Join, Condition, DTO) error
 
 		SelectWithPagePagination(context.Context, squirrel.SelectBuilder, PagePaginationParams, DTO) (PagePaginationResults, error)
 
+		NamedQuery(ctx context.Context, query Query, arg interface{}, target DTO) error
+		NamedGet(ctx context.Context, query Query, arg interface{}, target DTO) error
+		NamedExec(ctx context.Context, query Query, arg interface{}) (int64, error)
+
 		GetRowsByQuery(ctx context.Context, qb squirrel.SelectBuilder) (*sql.Rows, error)
 		CountByQuery(ctx context.Context, qb squirrel.SelectBuilder) (uint64, error)
 	}
@@ -85,6 +101,13 @@ func NewSqlxMapRepo(logger ZapLogger, db SqlxDBConnectorI, tables []Table, objs
 	for _, obj := range objs {
 		tableName := orm.GetTableName(obj)
 		if tableName == orm.Undefined {
+			fields := []zap.Field{zap.String("dto", fmt.Sprintf("%T", obj))}
+			if diags := orm.Validate(obj); len(diags) > 0 {
+				fields = append(fields, zap.Error(diags))
+			}
+
+			logger.Warn("[repo.NewSqlxMapRepo] DTO without orm_table_name is skipped", fields...)
+
 			continue
 		}
 
@@ -135,5 +158,5 @@ func (r Repositories) AutoGet(ctx context.Context, obj DtoWithIdentity) error {
 }
 
 func (r Repositories) AutoDelete(ctx context.Context, obj DtoWithIdentity) (int64, error) {
-	return r.AutoRepo(obj).Delete(ctx, obj.Identity())
+	return r.AutoRepo(obj).DeleteDTO(ctx, obj)
 }
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/reflect/orm"
+)
+
+// Operators of filter parameters: `age__gt=18`, parameter without operator is eq: `status=active`.
+const (
+	FilterEq     = "eq"     // column = value
+	FilterNe     = "ne"     // column <> value
+	FilterGt     = "gt"     // column > value
+	FilterLt     = "lt"     // column < value
+	FilterIn     = "in"     // column IN (values separated by comma)
+	FilterLike   = "like"   // column LIKE '%value%' (string columns)
+	FilterIsNull = "isnull" // column IS NULL (true) or IS NOT NULL (false)
+
+	filterOpSeparator   = "__"
+	filterListSeparator = ","
+	filterDescPrefix    = "-"
+	defaultSortParam    = "sort"
+)
+
+// ErrBadFilter - parameter of query string is not whitelisted column, has unknown operator or bad value.
+var ErrBadFilter = errors.New("repository: bad filter")
+
+type (
+	// Filter - conditions and ordering of list query parsed from query string by ParseFilter.
+	Filter struct {
+		Where   squirrel.And // conditions of parameters, empty if there are no filter parameters
+		OrderBy []string     // ORDER BY parts, e.g. "created_at DESC"
+	}
+
+	// FilterOptions - options of ParseFilter.
+	FilterOptions struct {
+		SortParam string   // name of parameter of ordering, "sort" by default
+		Ignore    []string // parameters which are not filters, e.g. "page", "page_size"
+	}
+
+	// filterColumn - whitelisted column of filter and type of its field.
+	filterColumn struct {
+		name Column
+		typ  reflect.Type
+	}
+)
+
+// ParseFilter parse query string of list endpoint, e.g. `status=active&age__gt=18&sort=-created_at,name`,
+// into conditions and ordering. Only select columns of DTO (orm_use_in:"select", "alias.col" for aliased
+// nested structs and composite DTOs) are allowed, orm_json and orm_encrypt columns are not filtered.
+// Values are converted to types of fields (numbers, bool, time.Time as RFC3339 or date), errors of
+// unknown parameters, operators and bad values have cause ErrBadFilter.
+func ParseFilter(values url.Values, dto DTO, opts FilterOptions) (Filter, error) {
+	columns := filterColumns(dto)
+
+	sortParam := opts.SortParam
+	if sortParam == "" {
+		sortParam = defaultSortParam
+	}
+
+	ignore := make(map[string]bool, len(opts.Ignore))
+	for _, param := range opts.Ignore {
+		ignore[param] = true
+	}
+
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	sort.Strings(params) // stable SQL for the same query string
+
+	filter := Filter{Where: squirrel.And{}}
+
+	for _, param := range params {
+		switch {
+		case ignore[param]:
+		case param == sortParam:
+			orderBy, err := parseOrderBy(values[param], columns)
+			if err != nil {
+				return Filter{}, err
+			}
+			filter.OrderBy = append(filter.OrderBy, orderBy...)
+		default:
+			for _, value := range values[param] {
+				cond, err := parseCondition(param, value, columns)
+				if err != nil {
+					return Filter{}, err
+				}
+				filter.Where = append(filter.Where, cond)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// Apply add conditions and ordering of filter to qb.
+func (f Filter) Apply(qb squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if len(f.Where) > 0 {
+		qb = qb.Where(f.Where)
+	}
+
+	if len(f.OrderBy) > 0 {
+		qb = qb.OrderBy(f.OrderBy...)
+	}
+
+	return qb
+}
+
+// filterColumns return whitelist of columns of filter: select fields of DTO without orm_json and orm_encrypt.
+func filterColumns(dto DTO) map[string]filterColumn {
+	columns := map[string]filterColumn{}
+
+	t := reflect.TypeOf(dto)
+	if t == nil || reflectx.Deref(t).Kind() != reflect.Struct {
+		return columns
+	}
+	t = reflectx.Deref(t)
+
+	for _, f := range orm.GetSelectFields(dto) {
+		if f.JSON || f.Encrypt != "" {
+			continue
+		}
+
+		columns[f.Name] = filterColumn{name: f.Name, typ: t.FieldByIndex(f.Index).Type}
+	}
+
+	return columns
+}
+
+func parseCondition(param, value string, columns map[string]filterColumn) (Condition, error) {
+	name, op := param, FilterEq
+	if i := strings.LastIndex(param, filterOpSeparator); i > 0 {
+		name, op = param[:i], param[i+len(filterOpSeparator):]
+	}
+
+	col, found := columns[name]
+	if !found {
+		return nil, errors.Wrapf(ErrBadFilter, "unknown field %q", name)
+	}
+
+	if op == FilterIsNull {
+		isNull, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrBadFilter, "bad value %q of %s", value, param)
+		}
+
+		if isNull {
+			return squirrel.Eq{col.name: nil}, nil
+		}
+
+		return squirrel.NotEq{col.name: nil}, nil
+	}
+
+	if op == FilterIn {
+		list := strings.Split(value, filterListSeparator)
+
+		args := make([]interface{}, len(list))
+		for i, s := range list {
+			arg, err := filterValue(s, col.typ)
+			if err != nil {
+				return nil, errors.Wrapf(ErrBadFilter, "bad value %q of %s: %v", s, param, err)
+			}
+			args[i] = arg
+		}
+
+		return squirrel.Eq{col.name: args}, nil
+	}
+
+	if op == FilterLike {
+		if reflectx.Deref(col.typ).Kind() != reflect.String {
+			return nil, errors.Wrapf(ErrBadFilter, "%s is used only for string fields, got %s", FilterLike, param)
+		}
+
+		return squirrel.Like{col.name: "%" + escapeLike(value) + "%"}, nil
+	}
+
+	arg, err := filterValue(value, col.typ)
+	if err != nil {
+		return nil, errors.Wrapf(ErrBadFilter, "bad value %q of %s: %v", value, param, err)
+	}
+
+	switch op {
+	case FilterEq:
+		return squirrel.Eq{col.name: arg}, nil
+	case FilterNe:
+		return squirrel.NotEq{col.name: arg}, nil
+	case FilterGt:
+		return squirrel.Gt{col.name: arg}, nil
+	case FilterLt:
+		return squirrel.Lt{col.name: arg}, nil
+	}
+
+	return nil, errors.Wrapf(ErrBadFilter, "unknown operator %q of %s", op, param)
+}
+
+// parseOrderBy parse values of sort parameter: "-created_at,name" -> "created_at DESC", "name ASC".
+func parseOrderBy(values []string, columns map[string]filterColumn) ([]string, error) {
+	var orderBy []string
+
+	for _, value := range values {
+		for _, name := range strings.Split(value, filterListSeparator) {
+			name, direction := strings.TrimSpace(name), "ASC"
+			if strings.HasPrefix(name, filterDescPrefix) {
+				name, direction = name[len(filterDescPrefix):], "DESC"
+			}
+
+			col, found := columns[name]
+			if !found {
+				return nil, errors.Wrapf(ErrBadFilter, "unknown sort field %q", name)
+			}
+
+			orderBy = append(orderBy, col.name+" "+direction)
+		}
+	}
+
+	return orderBy, nil
+}
+
+// filterValue convert value of parameter to type of field, values of other types (e.g. driver.Valuer)
+// are passed as strings.
+func filterValue(value string, t reflect.Type) (interface{}, error) {
+	t = reflectx.Deref(t)
+
+	if t == reflect.TypeOf(time.Time{}) {
+		if tm, err := time.Parse(time.RFC3339, value); err == nil {
+			return tm, nil
+		}
+		return time.Parse("2006-01-02", value)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(value, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, t.Bits())
+	}
+
+	return value, nil
+}
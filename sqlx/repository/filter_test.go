@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type Ticket struct {
+	ID        int64             `db:"id"          orm_use_in:"select"`
+	Status    string            `db:"status"      orm_use_in:"select,create"`
+	Priority  int               `db:"priority"    orm_use_in:"select,create"`
+	Assignee  *string           `db:"assignee"    orm_use_in:"select,create"`
+	CreatedAt time.Time         `db:"created_at"  orm_use_in:"select,create"`
+	Labels    map[string]string `db:"labels"      orm_use_in:"select,create" orm_json:"jsonb"`
+	Internal  string            `db:"internal"`
+}
+
+func TestFilter(t *testing.T) {
+	parse := func(query string) (Filter, error) {
+		values, err := url.ParseQuery(query)
+		assert.Nil(t, err)
+		return ParseFilter(values, &Ticket{}, FilterOptions{Ignore: []string{"page"}})
+	}
+
+	filter, err := parse("status=open&priority__gt=2&assignee__isnull=false&status__in=new,open" +
+		"&created_at__lt=2026-01-02&status__like=op_n&id__ne=7&sort=-priority,id&page=3")
+	assert.Nil(t, err)
+
+	query, args, err := filter.Apply(squirrel.Select("*").From("Tickets")).PlaceholderFormat(squirrel.Dollar).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM Tickets WHERE (assignee IS NOT NULL AND created_at < $1 AND id <> $2 "+
+		"AND priority > $3 AND status = $4 AND status IN ($5,$6) AND status LIKE $7) ORDER BY priority DESC, id ASC",
+		query)
+	assert.Equal(t, []interface{}{time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), int64(7), int64(2),
+		"open", "new", "open", `%op\_n%`}, args, "values are converted to types of fields")
+
+	for _, query := range []string{
+		"internal=x",           // not select column
+		"labels=x",             // orm_json column
+		"status__between=1",    // unknown operator
+		"priority=high",        // bad value
+		"priority__like=1",     // like of not string column
+		"assignee__isnull=yes", // bad bool
+		"sort=-unknown",        // unknown sort field
+	} {
+		_, err = parse(query)
+		assert.Equal(t, ErrBadFilter, errors.Cause(err), query)
+	}
+
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Tickets"}, nil).Repo("Tickets")
+
+	for i, status := range []string{"open", "closed", "open", "open", "new"} {
+		_, err = repo.Create(ctx, &Ticket{Status: status, Priority: i, CreatedAt: time.Now()})
+		assert.Nil(t, err)
+	}
+
+	filter, err = parse("status__in=open,new&sort=-priority")
+	assert.Nil(t, err)
+
+	var tickets []Ticket
+	pr, err := repo.SelectWithPagePagination(ctx, squirrel.Select("id", "priority").From("Tickets"),
+		PagePaginationParams{PageNumber: 1, PageSize: 3, Filter: filter}, &tickets)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), pr.CntPages, "pages are counted by filter")
+	if assert.Len(t, tickets, 3) {
+		assert.Equal(t, []int{4, 3, 2}, []int{tickets[0].Priority, tickets[1].Priority, tickets[2].Priority})
+	}
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type (
+	// BeforeCreateHook - DTO hook, it is called by Create before INSERT (columns are calculated after hook),
+	// error aborts Create.
+	BeforeCreateHook interface {
+		BeforeCreate(ctx context.Context) error
+	}
+
+	// AfterCreateHook - DTO hook, it is called by Create after INSERT with id of new row, error rollbacks INSERT.
+	AfterCreateHook interface {
+		AfterCreate(ctx context.Context, id ID) error
+	}
+
+	// BeforeUpdateHook - DTO hook, it is called by Update, UpdateFields and Save before UPDATE, error aborts update.
+	BeforeUpdateHook interface {
+		BeforeUpdate(ctx context.Context) error
+	}
+
+	// BeforeDeleteHook - DTO hook, it is called by DeleteDTO before DELETE, error aborts delete.
+	BeforeDeleteHook interface {
+		BeforeDelete(ctx context.Context) error
+	}
+
+	// AfterLoadHook - DTO hook, it is called for every DTO scanned by Get, FindBy*, Named* and pagination,
+	// error is returned by the method. DTOs from cache (NewCachedRepository) are not loaded again.
+	AfterLoadHook interface {
+		AfterLoad(ctx context.Context) error
+	}
+
+	// TxConnector - optional interface of SqlxDBConnectorI (e.g. monitor.Monitor): queries of repositories
+	// in transaction are executed by connection returned by TxConn instead of tx.
+	TxConnector interface {
+		TxConn(tx *sqlx.Tx) sqlx.ExtContext
+	}
+
+	txCtxKey struct{}
+
+	// txState - transaction of ctx and callbacks called after its commit.
+	txState struct {
+		tx       *sqlx.Tx
+		onCommit []func()
+	}
+)
+
+var afterLoadHookType = reflect.TypeOf((*AfterLoadHook)(nil)).Elem()
+
+// TxFromContext return transaction of hooks: hooks of DTO are called inside transaction of operation,
+// ctx of hook contains it, calls of repositories (of the same db) with this ctx are executed in this transaction.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	st, ok := ctx.Value(txCtxKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+
+	return st.tx, true
+}
+
+// afterCommit add fn called after commit of transaction of ctx, fn is not called if transaction is rolled back.
+// ctx must have transaction (see TxFromContext).
+func afterCommit(ctx context.Context, fn func()) {
+	if st, ok := ctx.Value(txCtxKey{}).(*txState); ok {
+		st.onCommit = append(st.onCommit, fn)
+	}
+}
+
+// inTransaction call fn in transaction of ctx or in new transaction, ctx of fn contains transaction.
+// Callbacks of afterCommit are called after commit of new transaction.
+func (r *repository) inTransaction(ctx context.Context, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return r.withTransaction(ctx, func(tx *sqlx.Tx) error { return fn(ctx, tx) })
+	}
+
+	st := &txState{}
+
+	err := r.withTransaction(ctx, func(tx *sqlx.Tx) error {
+		st.tx = tx
+		return fn(context.WithValue(ctx, txCtxKey{}, st), tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range st.onCommit {
+		f()
+	}
+
+	return nil
+}
+
+// conn return transaction of ctx (see TxFromContext) or db of repository.
+func (r *repository) conn(ctx context.Context) sqlx.ExtContext {
+	if tx, ok := TxFromContext(ctx); ok {
+		return r.txConn(tx)
+	}
+
+	return r.db
+}
+
+// txConn return connection of queries in tx (see TxConnector).
+func (r *repository) txConn(tx *sqlx.Tx) sqlx.ExtContext {
+	if c, ok := r.db.(TxConnector); ok {
+		return c.TxConn(tx)
+	}
+
+	return tx
+}
+
+// withHooks call fn between before and after hooks (nil hooks are skipped) in one transaction,
+// fn and hooks get ctx with the transaction. Without hooks fn is called as is. op - prefix of errors of hooks.
+func (r *repository) withHooks(
+	ctx context.Context,
+	op string,
+	before func(ctx context.Context) error,
+	fn func(ctx context.Context) error,
+	after func(ctx context.Context) error,
+) error {
+	if before == nil && after == nil {
+		return fn(ctx)
+	}
+
+	return r.inTransaction(ctx, func(ctx context.Context, _ *sqlx.Tx) error {
+		if before != nil {
+			if err := before(ctx); err != nil {
+				return errors.WithMessage(err, op+" before hook")
+			}
+		}
+
+		if err := fn(ctx); err != nil {
+			return err
+		}
+
+		if after != nil {
+			return errors.WithMessage(after(ctx), op+" after hook")
+		}
+
+		return nil
+	})
+}
+
+func beforeCreate(obj DTO) func(context.Context) error {
+	if hook, ok := obj.(BeforeCreateHook); ok {
+		return hook.BeforeCreate
+	}
+
+	return nil
+}
+
+func afterCreate(obj DTO, id *ID) func(context.Context) error {
+	if hook, ok := obj.(AfterCreateHook); ok {
+		return func(ctx context.Context) error { return hook.AfterCreate(ctx, *id) }
+	}
+
+	return nil
+}
+
+func beforeUpdate(obj DTO) func(context.Context) error {
+	if hook, ok := obj.(BeforeUpdateHook); ok {
+		return hook.BeforeUpdate
+	}
+
+	return nil
+}
+
+func beforeDelete(obj DTO) func(context.Context) error {
+	if hook, ok := obj.(BeforeDeleteHook); ok {
+		return hook.BeforeDelete
+	}
+
+	return nil
+}
+
+// afterLoad call AfterLoad hooks of dest: pointer to DTO or to slice of DTOs (or pointers to DTOs).
+func afterLoad(ctx context.Context, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+
+	v = v.Elem()
+	if v.Kind() != reflect.Slice {
+		return callAfterLoad(ctx, v)
+	}
+
+	elem := v.Type().Elem()
+	if !elem.Implements(afterLoadHookType) && !reflect.PtrTo(elem).Implements(afterLoadHookType) {
+		return nil
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if err := callAfterLoad(ctx, v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// callAfterLoad call AfterLoad of addressable v (its pointer receiver is used too).
+func callAfterLoad(ctx context.Context, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+
+	if hook, ok := v.Interface().(AfterLoadHook); ok {
+		return errors.WithMessage(hook.AfterLoad(ctx), "after load hook")
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+var errHook = stderrors.New("hook failed")
+
+type Event struct {
+	ID   int64  `db:"id"   orm_use_in:"select"`
+	Name string `db:"name" orm_use_in:"select,create"`
+}
+
+type Account struct {
+	orm.Tracking
+
+	_     interface{} `orm_table_name:"Accounts"`
+	ID    int64       `db:"id"     orm_use_in:"select"`
+	Email string      `db:"email"  orm_use_in:"select,create,update"`
+
+	Loaded bool `db:"-"`
+
+	events Repository
+	fail   string
+	calls  []string
+}
+
+func (a *Account) Identity() ID {
+	return a.ID
+}
+
+func (a *Account) hook(ctx context.Context, name string) error {
+	a.calls = append(a.calls, name)
+
+	if _, ok := TxFromContext(ctx); !ok {
+		return errors.New("no transaction in hook " + name)
+	}
+
+	if a.events != nil {
+		if _, err := a.events.Create(ctx, &Event{Name: name}); err != nil {
+			return err
+		}
+	}
+
+	if a.fail == name {
+		return errHook
+	}
+
+	return nil
+}
+
+func (a *Account) BeforeCreate(ctx context.Context) error {
+	a.Email = strings.ToLower(a.Email)
+	return a.hook(ctx, "before create")
+}
+
+func (a *Account) AfterCreate(ctx context.Context, id ID) error {
+	a.ID = id.(int64)
+	return a.hook(ctx, "after create")
+}
+
+func (a *Account) BeforeUpdate(ctx context.Context) error {
+	a.Email = strings.ToLower(a.Email)
+	return a.hook(ctx, "before update")
+}
+
+func (a *Account) BeforeDelete(ctx context.Context) error {
+	return a.hook(ctx, "before delete")
+}
+
+func (a *Account) AfterLoad(_ context.Context) error {
+	if a.Email == "" {
+		return errHook
+	}
+
+	a.Loaded = true
+
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Accounts", "Events"}, nil)
+	repo, events := repos.Repo("Accounts"), repos.Repo("Events")
+
+	account := &Account{Email: "Bob@Example.com", events: events}
+	id, err := repo.Create(ctx, account)
+	assert.Nil(t, err)
+	assert.Equal(t, id, account.Identity(), "AfterCreate get id of new row")
+	assert.Equal(t, []string{"before create", "after create"}, account.calls)
+	assert.Equal(t, "bob@example.com", db.Rows("Accounts")[0]["email"], "columns are calculated after BeforeCreate")
+	assert.Len(t, db.Rows("Events"), 2, "hooks use transaction of Create")
+
+	_, err = repo.Create(ctx, &Account{Email: "a@example.com", events: events, fail: "before create"})
+	assert.Equal(t, errHook, errors.Cause(err))
+	_, err = repo.Create(ctx, &Account{Email: "b@example.com", events: events, fail: "after create"})
+	assert.Equal(t, errHook, errors.Cause(err))
+	assert.Len(t, db.Rows("Accounts"), 1, "INSERT is rolled back")
+	assert.Len(t, db.Rows("Events"), 2, "writes of hooks are rolled back")
+
+	var loaded Account
+	assert.Nil(t, repo.Get(ctx, id, &loaded))
+	assert.True(t, loaded.Loaded)
+
+	var accounts []Account
+	assert.Nil(t, repo.FindBy(ctx, nil, squirrel.Gt{"id": 0}, &accounts))
+	if assert.Len(t, accounts, 1) {
+		assert.True(t, accounts[0].Loaded)
+	}
+
+	loaded.Email = "NEW@example.com"
+	ra, err := repo.Update(ctx, id, &loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ra)
+	assert.Equal(t, "new@example.com", db.Rows("Accounts")[0]["email"])
+
+	loaded.Email, loaded.fail = "Fail@example.com", "before update"
+	_, err = repo.UpdateFields(ctx, id, &loaded, "Email")
+	assert.Equal(t, errHook, errors.Cause(err))
+	assert.Equal(t, "new@example.com", db.Rows("Accounts")[0]["email"], "UPDATE is aborted")
+
+	loaded.fail = ""
+	assert.Nil(t, orm.Track(&loaded))
+	loaded.Email = "SAVED@example.com"
+	ra, err = repo.Save(ctx, &loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ra)
+	assert.Equal(t, "saved@example.com", db.Rows("Accounts")[0]["email"], "changes are calculated after BeforeUpdate")
+
+	loaded.fail = "before delete"
+	_, err = repos.AutoDelete(ctx, &loaded)
+	assert.Equal(t, errHook, errors.Cause(err))
+	assert.Len(t, db.Rows("Accounts"), 1)
+
+	loaded.fail = ""
+	ra, err = repo.DeleteDTO(ctx, &loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ra)
+	assert.Len(t, db.Rows("Accounts"), 0)
+	assert.Equal(t,
+		[]string{"before update", "before update", "before update", "before delete", "before delete"}, loaded.calls)
+
+	// raw queries in transaction of ctx see uncommitted rows
+	err = repos["Accounts"].inTransaction(ctx, func(ctx context.Context, _ *sqlx.Tx) error {
+		_, err := repo.Create(ctx, &Account{Email: "tx@example.com"})
+		assert.Nil(t, err)
+
+		cnt, err := repo.CountByQuery(ctx, squirrel.Select("count(1)").From("Accounts"))
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), cnt)
+
+		rows, err := repo.GetRowsByQuery(ctx, squirrel.Select("email").From("Accounts"))
+		assert.Nil(t, err)
+		defer func() { _ = rows.Close() }()
+		assert.True(t, rows.Next())
+
+		return errHook
+	})
+	assert.Equal(t, errHook, errors.Cause(err))
+	assert.Len(t, db.Rows("Accounts"), 0)
+
+	_, err = db.ExecContext(ctx, "INSERT INTO Accounts (email) VALUES ($1)", "")
+	assert.Nil(t, err)
+	err = repo.FindOneBy(ctx, nil, squirrel.Eq{"email": ""}, &loaded)
+	assert.Equal(t, errHook, errors.Cause(err), "error of AfterLoad is returned")
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/reflect/orm"
+)
+
+type (
+	// JSONContains - JSONB containment condition: column @> value, value is marshaled to JSON.
+	//  JSONContains{"attrs": map[string]interface{}{"color": "red"}}
+	JSONContains map[Column]interface{}
+
+	// JSONContainedBy - JSONB containment condition: column <@ value, value is marshaled to JSON.
+	JSONContainedBy map[Column]interface{}
+
+	// JSONHasKey - JSONB condition: column has top-level key (column ? key).
+	JSONHasKey map[Column]string
+)
+
+func (c JSONContains) ToSql() (string, []interface{}, error) {
+	return jsonCondition(c, "@>")
+}
+
+func (c JSONContainedBy) ToSql() (string, []interface{}, error) {
+	return jsonCondition(c, "<@")
+}
+
+func (c JSONHasKey) ToSql() (string, []interface{}, error) {
+	values := make(map[Column]interface{}, len(c))
+	for col, key := range c {
+		values[col] = key
+	}
+
+	// "??" is escaped "?" operator for squirrel placeholders
+	return sqlParts(values, func(col Column, value interface{}) (string, interface{}, error) {
+		return col + " ?? ?", value, nil
+	})
+}
+
+func jsonCondition(values map[Column]interface{}, op string) (string, []interface{}, error) {
+	return sqlParts(values, func(col Column, value interface{}) (string, interface{}, error) {
+		arg, err := orm.JSON{V: value}.Value()
+		if err != nil {
+			return "", nil, err
+		}
+
+		return col + " " + op + " ?::jsonb", arg, nil
+	})
+}
+
+// sqlParts join conditions of columns (sorted for stable query) by AND.
+func sqlParts(
+	values map[Column]interface{},
+	part func(col Column, value interface{}) (string, interface{}, error),
+) (string, []interface{}, error) {
+	cols := make([]Column, 0, len(values))
+	for col := range values {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	parts, args := make([]string, 0, len(cols)), make([]interface{}, 0, len(cols))
+	for _, col := range cols {
+		sql, arg, err := part(col, values[col])
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "column %s", col)
+		}
+
+		parts, args = append(parts, sql), append(args, arg)
+	}
+
+	if len(parts) == 0 {
+		return "(1=1)", nil, nil
+	}
+
+	return "(" + strings.Join(parts, " AND ") + ")", args, nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type (
+	Attrs struct {
+		Color string   `json:"color"`
+		Sizes []int    `json:"sizes"`
+		Meta  *Details `json:"meta,omitempty"`
+	}
+
+	Details struct {
+		Note string `json:"note"`
+	}
+
+	Product struct {
+		ID    int64             `db:"id"     orm_use_in:"select"`
+		Name  string            `db:"name"   orm_use_in:"select,create,update"`
+		Attrs Attrs             `db:"attrs"  orm_use_in:"select,create,update" orm_json:"jsonb"`
+		Tags  map[string]string `db:"tags"   orm_use_in:"select,create,update" orm_json:"jsonb"`
+	}
+)
+
+func TestJSONFields(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Products"}, nil).Repo("Products")
+
+	id, err := repo.Create(ctx, &Product{
+		Name:  "shirt",
+		Attrs: Attrs{Color: "red", Sizes: []int{1, 2}, Meta: &Details{Note: "cotton"}},
+		Tags:  map[string]string{"season": "summer"},
+	})
+	assert.Nil(t, err)
+
+	_, err = repo.Create(ctx, &Product{Name: "hat"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, `{"color":"red","sizes":[1,2],"meta":{"note":"cotton"}}`, db.Rows("Products")[0]["attrs"])
+	assert.Nil(t, db.Rows("Products")[1]["tags"], "nil map is NULL")
+
+	var product Product
+	assert.Nil(t, repo.Get(ctx, id, &product))
+	assert.Equal(t, Attrs{Color: "red", Sizes: []int{1, 2}, Meta: &Details{Note: "cotton"}}, product.Attrs)
+	assert.Equal(t, map[string]string{"season": "summer"}, product.Tags)
+
+	product.Tags = map[string]string{"season": "winter"}
+	_, err = repo.Update(ctx, id, &product)
+	assert.Nil(t, err)
+
+	var products []*Product
+	assert.Nil(t, repo.FindBy(ctx, []Column{"id", "name", "attrs", "tags"}, squirrel.Gt{"id": 0}, &products))
+	assert.Equal(t, 2, len(products))
+	assert.Equal(t, map[string]string{"season": "winter"}, products[0].Tags)
+	assert.Nil(t, products[1].Tags)
+	assert.Equal(t, Attrs{}, products[1].Attrs)
+
+	var names []struct {
+		Name string `db:"name"`
+	}
+	assert.Nil(t, repo.FindBy(ctx, []Column{"name"}, squirrel.Gt{"id": 0}, &names), "DTO without json fields")
+	assert.Equal(t, 2, len(names))
+
+	assert.NotNil(t, repo.FindBy(ctx, []Column{"id", "name", "attrs", "tags"}, squirrel.Gt{"id": 0}, &names),
+		"missing destination")
+}
+
+func TestJSONConditions(t *testing.T) {
+	query, args, err := squirrel.Select("id").From("products").
+		Where(JSONContains{"tags": map[string]string{"season": "winter"}, "attrs": Attrs{Color: "red"}}).
+		Where(JSONContainedBy{"attrs": map[string]interface{}{"color": "red"}}).
+		Where(JSONHasKey{"tags": "season"}).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM products WHERE (attrs @> $1::jsonb AND tags @> $2::jsonb) "+
+		"AND (attrs <@ $3::jsonb) AND (tags ? $4)", query)
+	assert.Equal(t, []interface{}{
+		`{"color":"red","sizes":null}`, `{"season":"winter"}`, `{"color":"red"}`, "season",
+	}, args)
+
+	_, _, err = JSONContains{"attrs": make(chan int)}.ToSql()
+	assert.NotNil(t, err)
+}
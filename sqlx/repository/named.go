@@ -0,0 +1,344 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// queryNameHeader - header of query in .sql file: "-- name: get_user_by_email".
+	queryNameHeader = "name:"
+	// setSearchPath - search_path of current transaction (SET LOCAL).
+	setSearchPath = "SELECT set_config('search_path', $1, true)"
+)
+
+var (
+	// ErrQueryNotFound - query is not found in Queries.
+	ErrQueryNotFound = errors.New("repository: named query not found")
+	// ErrBadQueryFile - .sql file has query without name, duplicated name or empty query.
+	ErrBadQueryFile = errors.New("repository: bad named query file")
+	// ErrUnscopedQuery - named query of repository with TenantModeColumn doesn't use parameter of discriminator.
+	ErrUnscopedQuery = errors.New("repository: named query is not scoped by tenant column")
+)
+
+// Queries - registry of named queries by name.
+type Queries map[string]Query
+
+// LoadQueries load named queries from files of fsys matched by patterns (fs.Glob, e.g. "queries/*.sql").
+// Every query in file starts with header "-- name: <name>", other comment lines are skipped:
+//
+//	-- name: get_user
+//	SELECT * FROM users WHERE id = :id;
+//
+//	-- name: delete_user
+//	DELETE FROM users WHERE id = :id;
+func LoadQueries(fsys fs.FS, patterns ...string) (Queries, error) {
+	queries := Queries{}
+
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "[repo.LoadQueries] glob %s", pattern)
+		}
+
+		sort.Strings(files)
+
+		for _, file := range files {
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "[repo.LoadQueries] read %s", file)
+			}
+
+			parsed, err := ParseQueries(string(data))
+			if err != nil {
+				return nil, errors.WithMessagef(err, "[repo.LoadQueries] file %s", file)
+			}
+
+			for name, query := range parsed {
+				if _, found := queries[name]; found {
+					return nil, errors.WithMessagef(ErrBadQueryFile,
+						"[repo.LoadQueries] file %s: duplicated query %s", file, name)
+				}
+				queries[name] = query
+			}
+		}
+	}
+
+	return queries, nil
+}
+
+// ParseQueries parse content of .sql file with named queries (see LoadQueries).
+func ParseQueries(data string) (Queries, error) {
+	var (
+		queries = Queries{}
+		name    string
+		body    strings.Builder
+		line    int
+	)
+
+	flush := func() error {
+		if name == "" {
+			if strings.TrimSpace(body.String()) != "" {
+				return errors.WithMessagef(ErrBadQueryFile, "line %d: query without name", line)
+			}
+			return nil
+		}
+
+		query := strings.TrimSpace(body.String())
+		if query == "" {
+			return errors.WithMessagef(ErrBadQueryFile, "line %d: empty query %s", line, name)
+		}
+
+		if _, found := queries[name]; found {
+			return errors.WithMessagef(ErrBadQueryFile, "line %d: duplicated query %s", line, name)
+		}
+
+		queries[name] = query
+
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+
+		if header, ok := queryHeader(text); ok {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+
+			if name = header; name == "" {
+				return nil, errors.WithMessagef(ErrBadQueryFile, "line %d: empty name", line)
+			}
+
+			body.Reset()
+
+			continue
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(text), "--") {
+			continue // comment lines are not part of query (named parameters in comments break binding)
+		}
+
+		body.WriteString(text)
+		body.WriteByte('\n')
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scan")
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return queries, nil
+}
+
+// queryHeader return name of query if line is header "-- name: <name>".
+func queryHeader(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "--") {
+		return "", false
+	}
+
+	header := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+	if !strings.HasPrefix(header, queryNameHeader) {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(header, queryNameHeader)), true
+}
+
+// Get return query by name.
+func (q Queries) Get(name string) (Query, error) {
+	query, found := q[name]
+	if !found {
+		return "", errors.WithMessagef(ErrQueryNotFound, "name %s", name)
+	}
+
+	return query, nil
+}
+
+// MustGet return query by name, panic if query is not found (for init of package level vars).
+func (q Queries) MustGet(name string) Query {
+	query, err := q.Get(name)
+	if err != nil {
+		panic(err)
+	}
+
+	return query
+}
+
+// NamedQuery select rows by query with :name parameters into target (pointer to slice).
+// Arg is DTO (db tags) or map[string]interface{}, parameters are replaced by placeholders of driver.
+// Named queries are scoped by tenant (see bindNamed and inScope), they are not audited.
+func (r *repository) NamedQuery(ctx context.Context, query Query, arg interface{}, target DTO) (err error) {
+	r.logger.Info("[repo.NamedQuery]", r.zapFieldRepo(), zap.String("query", query))
+
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.NamedQuery] scope")
+	}
+
+	q, args, err := r.bindNamed(sc, query, arg)
+	if err != nil {
+		return errors.WithMessage(err, "[repo.NamedQuery] bind")
+	}
+
+	return r.inScope(ctx, sc, func(ctx context.Context, conn sqlx.ExtContext) error {
+		return selectContext(ctx, conn, target, q, args...)
+	})
+}
+
+// NamedGet get one row by query with :name parameters into target.
+func (r *repository) NamedGet(ctx context.Context, query Query, arg interface{}, target DTO) (err error) {
+	r.logger.Info("[repo.NamedGet]", r.zapFieldRepo(), zap.String("query", query))
+
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.NamedGet] scope")
+	}
+
+	q, args, err := r.bindNamed(sc, query, arg)
+	if err != nil {
+		return errors.WithMessage(err, "[repo.NamedGet] bind")
+	}
+
+	return r.inScope(ctx, sc, func(ctx context.Context, conn sqlx.ExtContext) error {
+		return getContext(ctx, conn, target, q, args...)
+	})
+}
+
+// NamedExec execute query with :name parameters, return count of affected rows.
+func (r *repository) NamedExec(ctx context.Context, query Query, arg interface{}) (_ int64, err error) {
+	r.logger.Info("[repo.NamedExec]", r.zapFieldRepo(), zap.String("query", query))
+
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.NamedExec] scope")
+	}
+
+	q, args, err := r.bindNamed(sc, query, arg)
+	if err != nil {
+		return RowsAffectedUnknown, errors.WithMessage(err, "[repo.NamedExec] bind")
+	}
+
+	ra := RowsAffectedUnknown
+
+	return ra, r.inScope(ctx, sc, func(ctx context.Context, conn sqlx.ExtContext) error {
+		res, err := conn.ExecContext(ctx, q, args...)
+		if err != nil {
+			return errors.Wrap(err, "[repo.NamedExec] db.ExecContext")
+		}
+
+		if ra, err = res.RowsAffected(); err != nil {
+			ra = RowsAffectedUnknown
+			return errors.Wrap(err, "[repo.NamedExec] res.RowsAffected")
+		}
+
+		return nil
+	})
+}
+
+// bindNamed replace :name parameters of query by placeholders of driver. In TenantModeColumn query must use
+// parameter of discriminator column (e.g. "WHERE tenant_id = :tenant_id"), its value is tenant of ctx
+// (value of arg is overwritten), otherwise ErrUnscopedQuery is returned.
+func (r *repository) bindNamed(sc tenantScope, query Query, arg interface{}) (Query, []interface{}, error) {
+	if sc.column != "" {
+		if !sc.patterns.param.MatchString(query) {
+			return "", nil, errors.WithMessagef(ErrUnscopedQuery, "parameter :%s is not used", sc.column)
+		}
+
+		named, err := namedArgs(arg)
+		if err != nil {
+			return "", nil, err
+		}
+
+		named[sc.column] = sc.tenant
+		arg = named
+	}
+
+	q, args, err := r.db.BindNamed(query, arg)
+
+	return q, args, errors.Wrap(err, "db.BindNamed")
+}
+
+// namedArgs return copy of arg (map or DTO with db tags) as map of parameters.
+func namedArgs(arg interface{}) (map[string]interface{}, error) {
+	named := map[string]interface{}{}
+
+	if m, ok := arg.(map[string]interface{}); ok {
+		for k, v := range m {
+			named[k] = v
+		}
+
+		return named, nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(arg))
+	if !v.IsValid() {
+		return named, nil
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, errors.Errorf("unsupported type of named arguments %T", arg)
+	}
+
+	for name, field := range scanMapper.FieldMap(v) {
+		named[name] = field.Interface()
+	}
+
+	return named, nil
+}
+
+// inScope call fn with connection of repository (transaction of ctx or db). In TenantModeSchema fn is called
+// in transaction with search_path of tenant schema, previous search_path is restored after fn.
+func (r *repository) inScope(
+	ctx context.Context,
+	sc tenantScope,
+	fn func(ctx context.Context, conn sqlx.ExtContext) error,
+) error {
+	if sc.schema == "" {
+		return fn(ctx, r.conn(ctx))
+	}
+
+	return r.inTransaction(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+		conn := r.txConn(tx)
+
+		var searchPath string
+		if err := conn.QueryRowxContext(ctx, "SELECT current_setting('search_path')").Scan(&searchPath); err != nil {
+			return errors.Wrap(err, "get search_path")
+		}
+
+		if _, err := conn.ExecContext(ctx, setSearchPath, `"`+sc.schema+`"`); err != nil {
+			return errors.Wrap(err, "set search_path")
+		}
+
+		if err := fn(ctx, conn); err != nil {
+			return err
+		}
+
+		_, err := conn.ExecContext(ctx, setSearchPath, searchPath)
+
+		return errors.Wrap(err, "restore search_path")
+	})
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+var queriesFS = fstest.MapFS{
+	"queries/roles.sql": {Data: []byte(`
+-- name: roles_by_rights
+-- roles with rights more than :rights
+SELECT id, name, rights FROM Roles WHERE rights > :rights ORDER BY id;
+
+-- name: role_by_name
+SELECT id, name, rights FROM Roles WHERE name = :name
+`)},
+	"queries/update.sql": {Data: []byte(`--name:add_rights
+UPDATE Roles SET rights = rights + :delta WHERE name = :name`)},
+	"other/readme.txt": {Data: []byte("not sql")},
+}
+
+func TestLoadQueries(t *testing.T) {
+	queries, err := LoadQueries(queriesFS, "queries/*.sql")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(queries))
+	assert.Equal(t, "SELECT id, name, rights FROM Roles WHERE rights > :rights ORDER BY id;",
+		queries.MustGet("roles_by_rights"))
+	assert.Equal(t, "UPDATE Roles SET rights = rights + :delta WHERE name = :name", queries.MustGet("add_rights"))
+
+	_, err = queries.Get("unknown")
+	assert.Equal(t, ErrQueryNotFound, errors.Cause(err))
+	assert.Panics(t, func() { queries.MustGet("unknown") })
+
+	_, err = LoadQueries(queriesFS, "queries/*.sql", "queries/roles.sql")
+	assert.Equal(t, ErrBadQueryFile, errors.Cause(err), "duplicated query in different files")
+
+	for _, data := range []string{
+		"SELECT 1",
+		"-- name:\nSELECT 1",
+		"-- name: a\n-- name: b\nSELECT 1",
+		"-- name: a\nSELECT 1\n-- name: a\nSELECT 2",
+	} {
+		_, err = ParseQueries(data)
+		assert.Equal(t, ErrBadQueryFile, errors.Cause(err), data)
+	}
+
+	queries, err = ParseQueries("-- header comment\n\n-- name: a\nSELECT 1")
+	assert.Nil(t, err)
+	assert.Equal(t, Queries{"a": "SELECT 1"}, queries)
+}
+
+func TestNamedQueries(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Roles", repotest.Row{"name": "admin", "rights": 100}, repotest.Row{"name": "user", "rights": 10})
+	assert.Nil(t, err)
+
+	queries, err := LoadQueries(queriesFS, "queries/*.sql")
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Roles"}, nil).Repo("Roles")
+
+	var roles []Role
+	assert.Nil(t, repo.NamedQuery(ctx, queries.MustGet("roles_by_rights"), map[string]interface{}{"rights": 5}, &roles))
+	assert.Equal(t, 2, len(roles))
+
+	cnt, err := repo.NamedExec(ctx, queries.MustGet("add_rights"), map[string]interface{}{"delta": 1, "name": "user"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	var role Role
+	assert.Nil(t, repo.NamedGet(ctx, queries.MustGet("role_by_name"), &Role{Name: "user"}, &role))
+	assert.Equal(t, 11, role.Rights)
+
+	assert.NotNil(t, repo.NamedGet(ctx, queries.MustGet("role_by_name"), map[string]interface{}{}, &role),
+		"missing parameter")
+}
+
+func TestNamedQueries_Tenancy(t *testing.T) {
+	db := repotest.New(repotest.Table{Name: "Paginators", Defaults: tenantTimestamps})
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Paginators",
+		repotest.Row{"name": "first", TenantColumnDefault: "a"}, repotest.Row{"name": "second", TenantColumnDefault: "b"})
+	assert.Nil(t, err)
+
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators"}, nil).
+		WithTenancy(TenantOptions{Mode: TenantModeColumn}).Repo("Paginators")
+	ctxA := WithTenant(context.Background(), "a")
+
+	const (
+		scoped   = "SELECT id, name, tenant_id FROM Paginators WHERE tenant_id = :tenant_id AND name <> :name"
+		unscoped = "SELECT id, name, tenant_id FROM Paginators WHERE name <> :name"
+	)
+
+	var rows []TenantPaginator
+	err = repo.NamedQuery(context.Background(), scoped, map[string]interface{}{"name": ""}, &rows)
+	assert.Equal(t, ErrTenantRequired, errors.Cause(err))
+
+	err = repo.NamedQuery(ctxA, unscoped, map[string]interface{}{"name": ""}, &rows)
+	assert.Equal(t, ErrUnscopedQuery, errors.Cause(err))
+
+	err = repo.NamedQuery(ctxA, scoped, map[string]interface{}{"name": "", TenantColumnDefault: "b"}, &rows)
+	assert.Nil(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "first", rows[0].Name, "tenant from ctx overwrite value of argument")
+	}
+
+	var row TenantPaginator
+	assert.Nil(t, repo.NamedGet(ctxA, scoped, &TenantPaginator{Name: "", TenantID: "b"}, &row))
+	assert.Equal(t, "first", row.Name)
+
+	cnt, err := repo.NamedExec(ctxA, "UPDATE Paginators SET name = :name WHERE tenant_id = :tenant_id",
+		map[string]interface{}{"name": "updated"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	assert.Equal(t, "second", db.Rows("Paginators")[1]["name"])
+
+	schemaRepo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators"}, nil).
+		WithTenancy(TenantOptions{Mode: TenantModeSchema}).Repo("Paginators")
+	_, err = schemaRepo.NamedExec(context.Background(), unscoped, map[string]interface{}{"name": ""})
+	assert.Equal(t, ErrTenantRequired, errors.Cause(err))
+}
@@ -0,0 +1,34 @@
+package repository
+
+import "context"
+
+const (
+	OpRead       Operation = "read"       // OpRead - Get, FindBy*, GetRowsByQuery, CountByQuery, NamedQuery, NamedGet
+	OpWrite      Operation = "write"      // OpWrite - Create, Insert, Update, UpdateCustom, Delete, CopyFrom, NamedExec
+	OpPagination Operation = "pagination" // OpPagination - SelectWithPagePagination (count and select)
+)
+
+type (
+	// Operation - type of repository operation (default timeouts, metrics).
+	Operation string
+
+	// OperationInfo - repository operation which executes query, it is passed by ctx to connector
+	// (e.g. for per-repository metrics of queries).
+	OperationInfo struct {
+		Repo Repo
+		Op   Operation
+	}
+
+	operationCtxKey struct{}
+)
+
+// WithOperation return ctx with info of repository operation.
+func WithOperation(ctx context.Context, info OperationInfo) context.Context {
+	return context.WithValue(ctx, operationCtxKey{}, info)
+}
+
+// OperationFromContext return info of repository operation from ctx.
+func OperationFromContext(ctx context.Context) (OperationInfo, bool) {
+	info, ok := ctx.Value(operationCtxKey{}).(OperationInfo)
+	return info, ok
+}
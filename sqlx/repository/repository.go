@@ -6,7 +6,9 @@ import (
 	"database/sql"
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 
 	"github.com/imperiuse/golib/sqlx/helper"
@@ -15,7 +17,6 @@ import (
 
 	"github.com/Masterminds/squirrel"
 	"github.com/imperiuse/golib/reflect/orm"
-	"github.com/jmoiron/sqlx"
 )
 
 const (
@@ -40,9 +41,13 @@ type (
 	Condition = squirrel.Sqlizer // squirrel.Eq or squirrel.Gt or squirrel.And and etc
 
 	repository struct {
-		logger ZapLogger
-		db     SqlxDBConnectorI
-		name   Repo
+		logger   ZapLogger
+		db       SqlxDBConnectorI
+		name     Repo
+		tenancy  *TenantOptions  // nil - tenancy disabled
+		tenantRe *tenantPatterns // nil - TenantModeColumn is not used
+		audit    *AuditOptions   // nil - audit disabled
+		timeouts *TimeoutOptions // nil - default timeouts disabled
 	}
 )
 
@@ -93,84 +98,248 @@ func (r *repository) PureConnector() SqlxDBConnectorI {
 	return r.db
 }
 
-func (r *repository) Create(ctx context.Context, obj DTO) (ID, error) {
+func (r *repository) Name() Repo {
+	return r.name
+}
+
+func (r *repository) Create(ctx context.Context, obj DTO) (_ ID, err error) {
 	r.logger.Info("[repo.Create]", r.zapFieldRepo(), zapFieldObj(obj))
 
-	cols, vals := orm.GetDataForCreate(obj)
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
 
-	query, args, err := squirrel.Insert(r.name).
-		Columns(cols...).
-		Values(vals...).
-		Suffix("RETURNING id").
-		PlaceholderFormat(squirrel.Dollar).
-		ToSql()
+	sc, err := r.scope(ctx)
 	if err != nil {
-		return SerialUnknown, errors.Wrap(err, "[repo.Create] squirrel")
+		return SerialUnknown, errors.Wrap(err, "[repo.Create] scope")
 	}
 
 	var lastInsertID ID = int64(0)
 
-	return lastInsertID, r.create(ctx, query, &lastInsertID, args...)
+	return lastInsertID, r.withHooks(ctx, "[repo.Create]", beforeCreate(obj), func(ctx context.Context) error {
+		if err := orm.ValidateForCreate(obj); err != nil {
+			return errors.Wrap(err, "[repo.Create] validate")
+		}
+
+		cols, vals := sc.insert(orm.GetDataForCreate(obj))
+
+		query, args, err := squirrel.Insert(sc.table).
+			Columns(cols...).
+			Values(vals...).
+			Suffix("RETURNING id").
+			PlaceholderFormat(squirrel.Dollar).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "[repo.Create] squirrel")
+		}
+
+		return r.create(ctx, sc, obj, query, &lastInsertID, args...)
+	}, afterCreate(obj, &lastInsertID))
 }
 
-func (r *repository) create(ctx context.Context, query Query, lastInsertID *ID, args ...interface{}) error {
-	return helper.WithTransaction(ctx, nil, r.db, helper.InsertAndGetLastID(ctx, lastInsertID, query, args...))
+func (r *repository) create(
+	ctx context.Context,
+	sc tenantScope,
+	obj DTO,
+	query Query,
+	lastInsertID *ID,
+	args ...interface{},
+) error {
+	fns := []helper.TxFn{func(tx *sqlx.Tx) error {
+		return r.txConn(tx).QueryRowxContext(ctx, query, args...).Scan(lastInsertID)
+	}}
+	if r.audit != nil {
+		fns = append(fns, r.auditCreate(ctx, sc, obj, lastInsertID))
+	}
+
+	return r.withTransaction(ctx, fns...)
 }
 
-func (r *repository) Get(ctx context.Context, id ID, dest DTO) error {
+func (r *repository) Get(ctx context.Context, id ID, dest DTO) (err error) {
 	r.logger.Info("[repo.Get]", r.zapFieldRepo(), zapFieldID(id))
 
-	query, args, err := squirrel.Select("*").
-		From(r.name).
-		Where(squirrel.Eq{"id": id}).
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.Get] scope")
+	}
+
+	query, args, err := sc.selectQuery(nil, squirrel.Eq{idColumn(dest): id}, dest).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return errors.Wrap(err, "[repo.Get] squirrel")
 	}
 
-	return sqlx.GetContext(ctx, r.db, dest, query, args...)
+	return getContext(ctx, r.conn(ctx), dest, query, args...)
 }
 
-func (r *repository) Update(ctx context.Context, id ID, obj DTO) (int64, error) {
+func (r *repository) Update(ctx context.Context, id ID, obj DTO) (_ int64, err error) {
 	r.logger.Info("[repo.Update]", r.zapFieldRepo(), zapFieldID(id), zapFieldObj(obj))
 
-	sm := orm.GetDataForUpdate(obj)
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Update] scope")
+	}
+
+	ra := RowsAffectedUnknown
+
+	return ra, r.withHooks(ctx, "[repo.Update]", beforeUpdate(obj), func(ctx context.Context) (err error) {
+		if err = orm.ValidateForUpdate(obj); err != nil {
+			return errors.Wrap(err, "[repo.Update] validate")
+		}
+
+		ra, err = r.update(ctx, sc, "[repo.Update]", id, obj, orm.GetDataForUpdate(obj))
+
+		return err
+	}, nil)
+}
+
+// UpdateFields - partial Update, only fields (Go names of fields or db columns) of obj are updated,
+// see orm.GetDataForUpdateMask.
+func (r *repository) UpdateFields(ctx context.Context, id ID, obj DTO, fields ...string) (_ int64, err error) {
+	r.logger.Info("[repo.UpdateFields]", r.zapFieldRepo(), zapFieldID(id), zapFieldObj(obj),
+		zap.Strings("fields", fields))
+
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.UpdateFields] scope")
+	}
+
+	ra := RowsAffectedUnknown
+
+	return ra, r.withHooks(ctx, "[repo.UpdateFields]", beforeUpdate(obj), func(ctx context.Context) error {
+		sm, err := orm.GetDataForUpdateMask(obj, fields)
+		if err != nil {
+			return errors.Wrap(err, "[repo.UpdateFields] mask")
+		}
+
+		if err = orm.ValidateForUpdateMask(obj, fields); err != nil {
+			return errors.Wrap(err, "[repo.UpdateFields] validate")
+		}
+
+		ra, err = r.update(ctx, sc, "[repo.UpdateFields]", id, obj, sm)
+
+		return err
+	}, nil)
+}
+
+// Save - update only columns of obj changed since orm.Track(obj) (obj must have orm.Tracking field),
+// nothing is executed if there are no changes. After successful update snapshot in orm.Tracking of obj
+// is refreshed, so next Save updates only new changes.
+func (r *repository) Save(ctx context.Context, obj DtoWithIdentity) (_ int64, err error) {
+	r.logger.Info("[repo.Save]", r.zapFieldRepo(), zapFieldObj(obj))
+
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Save] scope")
+	}
+
+	ra := RowsAffectedUnknown
 
-	query, args, err := squirrel.Update(r.name).
-		SetMap(sm).
-		Where(squirrel.Eq{"id": id}).
+	err = r.withHooks(ctx, "[repo.Save]", beforeUpdate(obj), func(ctx context.Context) error {
+		sm, err := orm.Changes(obj)
+		if err != nil {
+			return errors.Wrap(err, "[repo.Save] changes")
+		}
+
+		if len(sm) == 0 {
+			ra = 0
+			return nil
+		}
+
+		if err = orm.ValidateForUpdate(obj); err != nil {
+			return errors.Wrap(err, "[repo.Save] validate")
+		}
+
+		ra, err = r.update(ctx, sc, "[repo.Save]", obj.Identity(), obj, sm)
+
+		return err
+	}, nil)
+	if err != nil {
+		return RowsAffectedUnknown, err
+	}
+
+	if _, ok := TxFromContext(ctx); ok { // changes are not saved until commit of tx of ctx
+		afterCommit(ctx, func() { _ = orm.Track(obj) }) // obj is tracked, see Changes above
+
+		return ra, nil
+	}
+
+	return ra, errors.Wrap(orm.Track(obj), "[repo.Save] refresh snapshot")
+}
+
+// update execute UPDATE of row by id (audited if audit is enabled), op - prefix of errors.
+func (r *repository) update(
+	ctx context.Context,
+	sc tenantScope,
+	op string,
+	id ID,
+	obj DTO,
+	sm map[Column]Argument,
+) (int64, error) {
+	query, args, err := squirrel.Update(sc.table).
+		SetMap(sc.set(sm)).
+		Where(sc.where(squirrel.Eq{"id": id})).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
-		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Update] squirrel")
+		return RowsAffectedUnknown, errors.Wrap(err, op+" squirrel")
+	}
+
+	if r.audit != nil {
+		ra, err := r.auditExec(ctx, sc, AuditUpdate, obj, sc.where(squirrel.Eq{"id": id}), query, args...)
+		return ra, errors.WithMessage(err, op+" audit")
 	}
 
-	res, err := r.db.ExecContext(ctx, query, args...)
+	res, err := r.conn(ctx).ExecContext(ctx, query, args...)
 	if err != nil {
-		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Update] db.ExecContext")
+		return RowsAffectedUnknown, errors.Wrap(err, op+" db.ExecContext")
 	}
 
 	ra, err := res.RowsAffected()
 	if err != nil {
-		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Update] res.RowsAffected")
+		return RowsAffectedUnknown, errors.Wrap(err, op+" res.RowsAffected")
 	}
 
 	return ra, nil
 }
 
-func (r *repository) Delete(ctx context.Context, id ID) (int64, error) {
+func (r *repository) Delete(ctx context.Context, id ID) (_ int64, err error) {
 	r.logger.Info("[repo.Delete]", r.zapFieldRepo(), zapFieldID(id))
 
-	query, args, err := squirrel.Delete(r.name).
-		Where(squirrel.Eq{"id": id}).
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Delete] scope")
+	}
+
+	query, args, err := squirrel.Delete(sc.table).
+		Where(sc.where(squirrel.Eq{"id": id})).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Delete] squirrel")
 	}
 
-	res, err := r.db.ExecContext(ctx, query, args...)
+	if r.audit != nil {
+		ra, err := r.auditExec(ctx, sc, AuditDelete, nil, sc.where(squirrel.Eq{"id": id}), query, args...)
+		return ra, errors.WithMessage(err, "[repo.Delete] audit")
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, args...)
 	if err != nil {
 		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Delete] db.ExecContext")
 	}
@@ -183,10 +352,30 @@ func (r *repository) Delete(ctx context.Context, id ID) (int64, error) {
 	return ra, nil
 }
 
-func (r *repository) Insert(ctx context.Context, columns []string, values []interface{}) (int64, error) {
+// DeleteDTO - Delete row of obj by obj.Identity(), BeforeDelete hook of obj is called in transaction of delete.
+func (r *repository) DeleteDTO(ctx context.Context, obj DtoWithIdentity) (int64, error) {
+	ra := RowsAffectedUnknown
+
+	return ra, r.withHooks(ctx, "[repo.DeleteDTO]", beforeDelete(obj), func(ctx context.Context) (err error) {
+		ra, err = r.Delete(ctx, obj.Identity())
+		return err
+	}, nil)
+}
+
+func (r *repository) Insert(ctx context.Context, columns []string, values []interface{}) (_ int64, err error) {
 	r.logger.Info("[repo.Insert]", r.zapFieldRepo(), zap.Any("columns", columns), zap.Any("values", values))
 
-	query, args, err := squirrel.Insert(r.name).
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Insert] scope")
+	}
+
+	columns, values = sc.insert(columns, values)
+
+	query, args, err := squirrel.Insert(sc.table).
 		Columns(columns...).
 		Values(values...).
 		PlaceholderFormat(squirrel.Dollar).
@@ -195,7 +384,7 @@ func (r *repository) Insert(ctx context.Context, columns []string, values []inte
 		return 0, errors.Wrap(err, "[repo.Insert] squirrel")
 	}
 
-	res, err := r.db.ExecContext(ctx, query, args...)
+	res, err := r.conn(ctx).ExecContext(ctx, query, args...)
 	if err != nil {
 		return RowsAffectedUnknown, errors.Wrap(err, "[repo.Insert] db.ExecContext")
 	}
@@ -203,20 +392,33 @@ func (r *repository) Insert(ctx context.Context, columns []string, values []inte
 	return res.RowsAffected()
 }
 
-func (r *repository) UpdateCustom(ctx context.Context, set map[string]interface{}, cond Condition) (int64, error) {
+func (r *repository) UpdateCustom(ctx context.Context, set map[string]interface{}, cond Condition) (_ int64, err error) {
 	r.logger.Info("[repo.UpdateCustom]", r.zapFieldRepo(),
 		zap.Any("set_map", set), zap.Any("condition", cond))
 
-	query, args, err := squirrel.Update(r.name).
-		SetMap(set).
-		Where(cond).
+	ctx, done := r.operation(ctx, OpWrite)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return RowsAffectedUnknown, errors.Wrap(err, "[repo.UpdateCustom] scope")
+	}
+
+	query, args, err := squirrel.Update(sc.table).
+		SetMap(sc.set(set)).
+		Where(sc.where(cond)).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return RowsAffectedUnknown, errors.Wrap(err, "[repo.UpdateCustom] squirrel")
 	}
 
-	res, err := r.db.ExecContext(ctx, query, args...)
+	if r.audit != nil {
+		ra, err := r.auditExec(ctx, sc, AuditUpdate, nil, sc.where(cond), query, args...)
+		return ra, errors.WithMessage(err, "[repo.UpdateCustom] audit")
+	}
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, args...)
 	if err != nil {
 		return RowsAffectedUnknown, errors.Wrap(err, "[repo.ExecContext] squirrel")
 	}
@@ -229,36 +431,121 @@ func (r *repository) UpdateCustom(ctx context.Context, set map[string]interface{
 	return ra, nil
 }
 
-func (r *repository) FindBy(ctx context.Context, columns []string, condition Condition, target interface{}) error {
+func (r *repository) FindBy(ctx context.Context, columns []string, condition Condition, target interface{}) (err error) {
 	r.logger.Info("[repo.FindBy]", r.zapFieldRepo(),
 		zap.Any("columns", columns), zap.Any("condition", condition))
 
-	query, args, err := squirrel.Select(columns...).
-		From(r.name).
-		Where(condition).
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.FindBy] scope")
+	}
+
+	query, args, err := sc.selectQuery(columns, condition, target).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return errors.Wrap(err, "[repo.FindBy] squirrel")
 	}
 
-	return sqlx.SelectContext(ctx, r.db, target, query, args...)
+	return selectContext(ctx, r.conn(ctx), target, query, args...)
 }
 
-func (r *repository) FindOneBy(ctx context.Context, columns []string, condition Condition, target interface{}) error {
+func (r *repository) FindOneBy(ctx context.Context, columns []string, condition Condition, target interface{}) (err error) {
 	r.logger.Info("[repo.FindOneBy]", r.zapFieldRepo(),
 		zap.Any("columns", columns), zap.Any("condition", condition))
 
-	query, args, err := squirrel.Select(columns...).
-		From(r.name).
-		Where(condition).
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.FindOneBy] scope")
+	}
+
+	query, args, err := sc.selectQuery(columns, condition, target).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return errors.Wrap(err, "[repo.FindOneBy] squirrel")
 	}
 
-	return sqlx.GetContext(ctx, r.db, target, query, args...)
+	return getContext(ctx, r.conn(ctx), target, query, args...)
+}
+
+type (
+	// ExampleOptions - options for FindByExample (query-by-example).
+	ExampleOptions struct {
+		LikeStrings bool     // match non-zero string fields by LIKE '%value%' instead of equality
+		OrderBy     []string // ORDER BY parts, e.g. "id DESC"
+		Limit       uint64   // 0 - no limit
+	}
+)
+
+func (r *repository) FindByExample(ctx context.Context, example DTO, opts ExampleOptions, target interface{}) (err error) {
+	r.logger.Info("[repo.FindByExample]", r.zapFieldRepo(), zapFieldObj(example), zap.Any("opts", opts))
+
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.FindByExample] scope")
+	}
+
+	query, args, err := r.findByExampleQuery(sc, example, opts).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "[repo.FindByExample] squirrel")
+	}
+
+	return selectContext(ctx, r.conn(ctx), target, query, args...)
+}
+
+func (r *repository) findByExampleQuery(sc tenantScope, example DTO, opts ExampleOptions) squirrel.SelectBuilder {
+	columns, _ := orm.GetDataForSelect(example)
+	if len(columns) == 0 {
+		columns = []Column{"*"}
+	}
+
+	eq, like := squirrel.Eq{}, squirrel.Like{}
+	for col, val := range orm.GetDataForExample(example) {
+		if s, ok := val.(string); ok && opts.LikeStrings {
+			like[col] = "%" + escapeLike(s) + "%"
+			continue
+		}
+		eq[col] = val
+	}
+
+	cond := squirrel.And{}
+	if len(eq) > 0 {
+		cond = append(cond, eq)
+	}
+	if len(like) > 0 {
+		cond = append(cond, like)
+	}
+
+	qb := squirrel.Select(columns...).From(sc.table)
+	if len(cond) > 0 {
+		qb = qb.Where(cond)
+	}
+	qb = sc.selectBuilder(qb)
+	if len(opts.OrderBy) > 0 {
+		qb = qb.OrderBy(opts.OrderBy...)
+	}
+	if opts.Limit > 0 {
+		qb = qb.Limit(opts.Limit)
+	}
+
+	return qb
+}
+
+// escapeLike escape special symbols of LIKE pattern ('\' is default escape symbol in Postgres).
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 func (r *repository) FindByWithInnerJoin(
@@ -268,23 +555,37 @@ func (r *repository) FindByWithInnerJoin(
 	join string,
 	condition Condition,
 	target interface{},
-) error {
+) (err error) {
 	r.logger.Info("[repo.FindByWithInnerJoin]", r.zapFieldRepo(),
 		zap.Any("columns", columns),
 		zap.Any("join", join),
 		zap.Any("condition", condition))
 
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.FindByWithInnerJoin] scope")
+	}
+
+	if len(columns) == 0 {
+		columns = selectColumns(targetDTO(target))
+	}
+
 	query, args, err := squirrel.Select(columns...).
 		From(fromWithAlias).
 		InnerJoin(join).
-		Where(condition).
+		Where(sc.whereAlias(condition, fromWithAlias)).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return errors.Wrap(err, "[repo.FindByWithInnerJoin] squirrel")
 	}
 
-	return sqlx.SelectContext(ctx, r.db, target, query, args...)
+	return r.inScope(ctx, sc, func(ctx context.Context, conn sqlx.ExtContext) error {
+		return selectContext(ctx, conn, target, query, args...)
+	})
 }
 
 func (r *repository) FindOneByWithInnerJoin(
@@ -294,53 +595,100 @@ func (r *repository) FindOneByWithInnerJoin(
 	join string,
 	condition Condition,
 	target interface{},
-) error {
+) (err error) {
 	r.logger.Info("[repo.FindOneByWithInnerJoin]", r.zapFieldRepo(),
 		zap.Any("columns", columns),
 		zap.Any("join", join),
 		zap.Any("condition", condition))
 
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[repo.FindOneByWithInnerJoin] scope")
+	}
+
+	if len(columns) == 0 {
+		columns = selectColumns(targetDTO(target))
+	}
+
 	query, args, err := squirrel.Select(columns...).
 		From(fromWithAlias).
 		InnerJoin(join).
-		Where(condition).
+		Where(sc.whereAlias(condition, fromWithAlias)).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return errors.Wrap(err, "[repo.FindOneByWithInnerJoin] squirrel")
 	}
 
-	return sqlx.GetContext(ctx, r.db, target, query, args...)
+	return r.inScope(ctx, sc, func(ctx context.Context, conn sqlx.ExtContext) error {
+		return getContext(ctx, conn, target, query, args...)
+	})
 }
 
+// GetRowsByQuery - rows are read by caller after return, so default timeouts (WithTimeouts) are not applied
+// and query can't be scoped by search_path in TenantModeSchema (ErrSchemaScopeUnsupported is returned).
 func (r *repository) GetRowsByQuery(ctx context.Context, qb squirrel.SelectBuilder) (*sql.Rows, error) {
 	r.logger.Info("[repo.GetRowsByQuery]", r.zapFieldRepo(), zap.Any("qb", qb))
 
-	query, args, err := qb.
+	ctx = WithOperation(ctx, OperationInfo{Repo: r.name, Op: OpRead})
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "[repo.GetRowsByQuery] scope")
+	}
+
+	if sc.schema != "" {
+		return nil, errors.WithMessage(ErrSchemaScopeUnsupported, "[repo.GetRowsByQuery]")
+	}
+
+	query, args, err := sc.selectBuilder(qb).
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
 		return nil, errors.Wrap(err, "[repo.GetRowsByQuery] squirrel")
 	}
 
-	return r.db.QueryContext(ctx, query, args...)
+	return r.conn(ctx).QueryContext(ctx, query, args...)
 }
 
-func (r *repository) CountByQuery(ctx context.Context, qb squirrel.SelectBuilder) (uint64, error) {
+func (r *repository) CountByQuery(ctx context.Context, qb squirrel.SelectBuilder) (_ uint64, err error) {
 	r.logger.Info("[repo.CountByQuery]", r.zapFieldRepo(), zap.Any("qb", qb))
 
+	ctx, done := r.operation(ctx, OpRead)
+	defer func() { err = done(err) }()
+
+	sc, err := r.scope(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "[repo.CountByQuery] scope")
+	}
+
+	var counter uint64
+
+	err = r.inScope(ctx, sc, func(ctx context.Context, conn sqlx.ExtContext) (err error) {
+		counter, err = countContext(ctx, conn, sc.selectBuilder(qb))
+		return err
+	})
+
+	return counter, errors.WithMessage(err, "[repo.CountByQuery]")
+}
+
+// countContext execute count query qb.
+func countContext(ctx context.Context, q sqlx.QueryerContext, qb squirrel.SelectBuilder) (uint64, error) {
 	query, args, err := qb.
 		PlaceholderFormat(squirrel.Dollar).
 		ToSql()
 	if err != nil {
-		return 0, errors.Wrap(err, "[repo.CountByQuery] squirrel")
+		return 0, errors.Wrap(err, "squirrel")
 	}
 
 	counter := uint64(0)
 
-	err = r.db.QueryRowxContext(ctx, query, args...).Scan(&counter)
+	err = q.QueryRowxContext(ctx, query, args...).Scan(&counter)
 	if err != nil {
-		return counter, errors.Wrap(err, "[repo.CountByQuery] db.QueryRowxContext")
+		return counter, errors.Wrap(err, "db.QueryRowxContext")
 	}
 
 	return counter, nil
@@ -350,6 +698,7 @@ type (
 	PagePaginationParams struct {
 		PageNumber uint64
 		PageSize   uint64
+		Filter     Filter // conditions (also used for count of pages) and ordering, see ParseFilter
 	}
 
 	PagePaginationResults struct {
@@ -359,17 +708,31 @@ type (
 	}
 )
 
+// paginationCount return count query of rows of table (or joined tables of composite DTO) of target by filter,
+// so conditions of filter can use aliases of parts like select of target.
+func (sc tenantScope) paginationCount(filter Filter, target interface{}) squirrel.SelectBuilder {
+	var cond Condition
+	if len(filter.Where) > 0 {
+		cond = filter.Where
+	}
+
+	return sc.selectQuery([]Column{"count(1)"}, cond, target)
+}
+
 func (r *repository) SelectWithPagePagination(
 	ctx context.Context,
 	selectBuilder squirrel.SelectBuilder,
 	params PagePaginationParams,
 	target interface{},
 ) (
-	PagePaginationResults,
-	error,
+	_ PagePaginationResults,
+	err error,
 ) {
 	r.logger.Info("[repo.SelectWithPagePagination]", r.zapFieldRepo(), zap.Any("params", params))
 
+	ctx, done := r.operation(ctx, OpPagination)
+	defer func() { err = done(err) }()
+
 	const pageNumberPresent = 1
 
 	paginationResult := PagePaginationResults{
@@ -382,16 +745,14 @@ func (r *repository) SelectWithPagePagination(
 		return paginationResult, errors.New("zero value of params.PageSize")
 	}
 
-	totalCount, err := r.CountByQuery(ctx, squirrel.Select("count(1)").From(r.name))
+	sc, err := r.scope(ctx)
 	if err != nil {
-		return paginationResult, errors.Wrap(err, "SelectWithPagePagination: r.CountByQuery")
+		return paginationResult, errors.Wrap(err, "SelectWithPagePagination: scope")
 	}
 
-	if paginationResult.CntPages = totalCount / params.PageSize; totalCount%params.PageSize != 0 {
-		paginationResult.CntPages++
-	}
+	countBuilder := sc.paginationCount(params.Filter, target)
 
-	selectBuilder = selectBuilder.Limit(params.PageSize)
+	selectBuilder = sc.selectBuilder(params.Filter.Apply(selectBuilder)).Limit(params.PageSize)
 	if params.PageNumber > pageNumberPresent {
 		selectBuilder = selectBuilder.Offset((params.PageNumber - 1) * params.PageSize)
 	}
@@ -401,8 +762,20 @@ func (r *repository) SelectWithPagePagination(
 		return paginationResult, errors.Wrap(err, "SelectWithPagePagination: selectBuilder.ToSql()")
 	}
 
-	if err = sqlx.SelectContext(ctx, r.db, target, query, args...); err != nil {
-		return paginationResult, errors.Wrap(err, "SelectWithPagePagination: sqlx.SelectContext()")
+	err = r.inScope(ctx, sc, func(ctx context.Context, conn sqlx.ExtContext) error {
+		totalCount, err := countContext(ctx, conn, countBuilder)
+		if err != nil {
+			return errors.WithMessage(err, "SelectWithPagePagination: count")
+		}
+
+		if paginationResult.CntPages = totalCount / params.PageSize; totalCount%params.PageSize != 0 {
+			paginationResult.CntPages++
+		}
+
+		return errors.Wrap(selectContext(ctx, conn, target, query, args...), "SelectWithPagePagination: sqlx.SelectContext()")
+	})
+	if err != nil {
+		return paginationResult, err
 	}
 
 	// todo think here
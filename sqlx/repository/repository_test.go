@@ -245,12 +245,12 @@ func appendTestDataToTables(s *RepositoryTestSuit) error {
 	return nil
 }
 
-func (suite *RepositoryTestSuit) Test_Repo_AutoRepo_SqlxDBConnectorI() {
+func (suite *RepositoryTestSuit) Test_Repo_AutoRepo_PureConnector() {
 	t := suite.T()
 
 	for _, obj := range DTOs {
-		assert.NotNil(t, suite.repos.AutoRepo(obj).SqlxDBConnectorI())
-		assert.Equal(t, suite.db, suite.repos.AutoRepo(obj).SqlxDBConnectorI())
+		assert.NotNil(t, suite.repos.AutoRepo(obj).PureConnector())
+		assert.Equal(t, suite.db, suite.repos.AutoRepo(obj).PureConnector())
 		assert.NotEqual(t, suite.repos.AutoRepo(obj), suite.repos.Repo("_UNKNOWN_"))
 		assert.Equal(t, emptyRepo, suite.repos.Repo("_UNKNOWN_"))
 		assert.Equal(t, emptyRepo, suite.repos.Repo("_UNKNOWN_2"))
@@ -271,10 +271,10 @@ func (suite *RepositoryTestSuit) Test_EmptyRepo_NotPanic() {
 	assert.NotNil(t, r)
 	assert.Equal(t, r, emptyRepo)
 
-	assert.NotNil(t, r.SqlxDBConnectorI())
-	assert.NotEqual(t, suite.db, r.SqlxDBConnectorI())
+	assert.NotNil(t, r.PureConnector())
+	assert.NotEqual(t, suite.db, r.PureConnector())
 
-	emptyCon := r.SqlxDBConnectorI()
+	emptyCon := r.PureConnector()
 
 	assert.Equal(t, FakeStringAns, emptyCon.DriverName())
 
@@ -522,6 +522,77 @@ func (suite *RepositoryTestSuit) Test_Advance_RepoFunc() {
 	assert.NotNil(t, rows)
 }
 
+func (suite *RepositoryTestSuit) Test_FindByExample() {
+	t := suite.T()
+	ctx := suite.ctx
+
+	repo := suite.repos.AutoRepo(&Role{}).(*repository)
+	sc, err := repo.scope(ctx)
+	assert.Nil(t, err)
+
+	query, args, err := repo.findByExampleQuery(sc, &Role{Name: "adm_n%", Rights: 7}, ExampleOptions{
+		LikeStrings: true,
+		OrderBy:     []string{"id DESC"},
+		Limit:       10,
+	}).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id, created_at, updated_at, name, rights FROM Roles "+
+		"WHERE (rights = ? AND name LIKE ?) ORDER BY id DESC LIMIT 10", query)
+	assert.Equal(t, []interface{}{7, `%adm\_n\%%`}, args)
+
+	query, args, err = repo.findByExampleQuery(sc, &Role{}, ExampleOptions{}).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id, created_at, updated_at, name, rights FROM Roles", query)
+	assert.Empty(t, args)
+
+	var role = Role{
+		Name:   "example_role",
+		Rights: 77,
+	}
+	roleID, err := suite.repos.AutoCreate(ctx, &role)
+	defer func() { _, _ = suite.repos.AutoRepo(&role).Delete(ctx, roleID) }()
+	assert.Nil(t, err)
+
+	var roles []Role
+	assert.Nil(t, repo.FindByExample(ctx, &Role{Rights: 77}, ExampleOptions{}, &roles))
+	assert.Equal(t, 1, len(roles))
+	assert.Equal(t, role.Name, roles[0].Name)
+
+	roles = roles[:0]
+	assert.Nil(t, repo.FindByExample(ctx, &Role{Name: "ample_ro"}, ExampleOptions{LikeStrings: true, Limit: 1}, &roles))
+	assert.Equal(t, 1, len(roles))
+	assert.Equal(t, roleID, roles[0].ID)
+
+	roles = roles[:0]
+	assert.Nil(t, repo.FindByExample(ctx, &Role{Name: "ample_ro"}, ExampleOptions{}, &roles))
+	assert.Equal(t, 0, len(roles))
+}
+
+func (suite *RepositoryTestSuit) Test_CopyFrom() {
+	t := suite.T()
+	ctx := suite.ctx
+
+	const rights = 4242
+	defer func() {
+		_, _ = suite.db.ExecContext(ctx, "DELETE FROM Roles WHERE rights = $1", rights)
+	}()
+
+	roles := []Role{{Name: "copy_1", Rights: rights}, {Name: "copy_2", Rights: rights}, {Name: "copy_3", Rights: rights}}
+
+	progress := []int64{}
+	cnt, err := suite.repos.AutoRepo(&Role{}).CopyFrom(ctx, CopyFromSlice(roles), CopyOptions{
+		BatchSize: 2,
+		Progress:  func(rows int64) { progress = append(progress, rows) },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), cnt)
+	assert.Equal(t, []int64{2, 3}, progress)
+
+	var copied []Role
+	assert.Nil(t, suite.repos.AutoRepo(&Role{}).FindByExample(ctx, &Role{Rights: rights}, ExampleOptions{}, &copied))
+	assert.Equal(t, 3, len(copied))
+}
+
 func (suite *RepositoryTestSuit) Test_GetAllPossibleErrors() {
 	t := suite.T()
 	ctx := suite.ctx
@@ -0,0 +1,187 @@
+package repotest
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// database/sql driver on top of in-memory engine.
+
+type (
+	connector struct {
+		engine *engine
+	}
+
+	conn struct {
+		engine *engine
+		tx     *txCatalog
+	}
+
+	stmt struct {
+		conn  *conn
+		query string
+		st    *statement
+	}
+
+	tx struct {
+		conn *conn
+	}
+
+	rows struct {
+		res *result
+		pos int
+	}
+
+	execResult struct {
+		affected int64
+		lastID   int64
+	}
+)
+
+// ErrTxInProgress - nested transactions are not supported.
+var ErrTxInProgress = errors.New("repotest: transaction already in progress")
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{engine: c.engine}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// fakeDriver can't open connection by dsn, use New() instead.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("repotest: use repotest.New() for create fake db")
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	st, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stmt{conn: c, query: query, st: st}, nil
+}
+
+func (c *conn) Close() error {
+	c.tx = nil
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(_ context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, ErrTxInProgress
+	}
+
+	c.tx = newTxCatalog(c.engine)
+
+	return &tx{conn: c}, nil
+}
+
+func (c *conn) execute(st *statement, args []driver.Value) (*result, error) {
+	if c.tx != nil {
+		return execute(c.tx, st, args)
+	}
+
+	// statement out of transaction is atomic too: works as implicit transaction
+	c.engine.stmtMu.Lock()
+	defer c.engine.stmtMu.Unlock()
+
+	tc := newTxCatalog(c.engine)
+
+	res, err := execute(tc, st, args)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.commit()
+
+	return res, nil
+}
+
+func (t *tx) Commit() error {
+	if t.conn.tx == nil {
+		return errors.New("repotest: transaction already finished")
+	}
+
+	t.conn.engine.stmtMu.Lock()
+	t.conn.tx.commit()
+	t.conn.engine.stmtMu.Unlock()
+
+	t.conn.tx = nil
+
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	if t.conn.tx == nil {
+		return errors.New("repotest: transaction already finished")
+	}
+
+	t.conn.tx = nil
+
+	return nil
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput return -1, database/sql will not check count of args.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.conn.execute(s.st, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return execResult{affected: res.affected, lastID: res.lastID}, nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	res, err := s.conn.execute(s.st, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rows{res: res}, nil
+}
+
+func (r execResult) LastInsertId() (int64, error) {
+	return r.lastID, nil
+}
+
+func (r execResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+func (r *rows) Columns() []string {
+	return r.res.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.res.rows) {
+		return io.EOF
+	}
+
+	copy(dest, r.res.rows[r.pos])
+	r.pos++
+
+	return nil
+}
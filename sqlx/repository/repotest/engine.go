@@ -0,0 +1,549 @@
+package repotest
+
+import (
+	"database/sql/driver"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const serialColumn = "id" // column filled by auto increment when value not passed (like IDENTITY in DSL of tests)
+
+type (
+	// DefaultFn - func which calc default value of column for INSERT.
+	DefaultFn = func() interface{}
+
+	table struct {
+		name     string
+		columns  []string
+		defaults map[string]DefaultFn
+		strict   bool // created by CreateTable, unknown columns are not allowed
+		rows     []row
+		serial   int64
+	}
+
+	engine struct {
+		mu     sync.Mutex // guard tables map
+		stmtMu sync.Mutex // serialize write back of changes (commits)
+		tables map[string]*table
+	}
+
+	// txCatalog - lazy snapshot of engine tables, modified tables are written back on commit.
+	txCatalog struct {
+		e      *engine
+		tables map[string]*table
+		dirty  map[string]bool
+	}
+
+	result struct {
+		columns  []string
+		rows     [][]driver.Value
+		affected int64
+		lastID   int64
+	}
+)
+
+func newEngine() *engine {
+	return &engine{tables: map[string]*table{}}
+}
+
+func newTable(name string) *table {
+	return &table{name: name, defaults: map[string]DefaultFn{}}
+}
+
+// lookup return table by name, not existed tables are created implicitly (schemaless mode).
+// engine.mu must be held.
+func (e *engine) lookup(name string) *table {
+	t, found := e.tables[name]
+	if !found {
+		t = newTable(name)
+		e.tables[name] = t
+	}
+
+	return t
+}
+
+func newTxCatalog(e *engine) *txCatalog {
+	return &txCatalog{e: e, tables: map[string]*table{}, dirty: map[string]bool{}}
+}
+
+func (c *txCatalog) table(name string) *table {
+	if t, found := c.tables[name]; found {
+		return t
+	}
+
+	c.e.mu.Lock()
+	t := c.e.lookup(name).clone()
+	c.e.mu.Unlock()
+
+	c.tables[name] = t
+
+	return t
+}
+
+// commit write back modified tables. Transactions are not isolated from each other: last commit wins.
+func (c *txCatalog) commit() {
+	c.e.mu.Lock()
+	defer c.e.mu.Unlock()
+
+	for name := range c.dirty {
+		c.e.tables[name] = c.tables[name]
+	}
+}
+
+func (t *table) clone() *table {
+	cp := &table{
+		name:     t.name,
+		columns:  append([]string(nil), t.columns...),
+		defaults: make(map[string]DefaultFn, len(t.defaults)),
+		strict:   t.strict,
+		rows:     make([]row, len(t.rows)),
+		serial:   t.serial,
+	}
+
+	for k, v := range t.defaults {
+		cp.defaults[k] = v
+	}
+
+	for i, r := range t.rows {
+		cp.rows[i] = cloneRow(r)
+	}
+
+	return cp
+}
+
+func cloneRow(r row) row {
+	cp := make(row, len(r))
+	for k, v := range r {
+		cp[k] = v
+	}
+
+	return cp
+}
+
+func (t *table) hasColumn(col string) bool {
+	for _, c := range t.columns {
+		if c == col {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ensureColumn add column to schemaless table (existed rows get NULL), for strict table return error.
+func (t *table) ensureColumn(col string) error {
+	if t.hasColumn(col) {
+		return nil
+	}
+
+	if t.strict {
+		return errors.Errorf("repotest: column %q of relation %q does not exist", col, t.name)
+	}
+
+	t.columns = append(t.columns, col)
+	for _, r := range t.rows {
+		r[col] = nil
+	}
+
+	return nil
+}
+
+// insert add new row, apply defaults and auto increment for serial column.
+func (t *table) insert(values row) (row, error) {
+	r := make(row, len(t.columns)+len(values))
+
+	for col, v := range values {
+		if err := t.ensureColumn(col); err != nil {
+			return nil, err
+		}
+		r[col] = normalize(v)
+	}
+
+	if !t.strict {
+		_ = t.ensureColumn(serialColumn)
+	}
+
+	for _, col := range t.columns {
+		if _, found := r[col]; found {
+			continue
+		}
+
+		r[col] = nil
+		if fn, found := t.defaults[col]; found {
+			r[col] = normalize(fn())
+		}
+	}
+
+	if t.hasColumn(serialColumn) {
+		switch id := r[serialColumn].(type) {
+		case nil:
+			t.serial++
+			r[serialColumn] = t.serial
+		case int64:
+			if id > t.serial {
+				t.serial = id
+			}
+		}
+	}
+
+	t.rows = append(t.rows, r)
+
+	return r, nil
+}
+
+func (t *table) filter(where expr, args []driver.Value) ([]int, error) {
+	idx := make([]int, 0, len(t.rows))
+
+	for i, r := range t.rows {
+		if where != nil {
+			ok, err := where.eval(r, args)
+			if err != nil {
+				return nil, err
+			}
+			if ok != true {
+				continue
+			}
+		}
+
+		idx = append(idx, i)
+	}
+
+	return idx, nil
+}
+
+func execute(c *txCatalog, st *statement, args []driver.Value) (*result, error) {
+	t := c.table(st.table)
+	if st.kind != stmtSelect {
+		c.dirty[st.table] = true
+	}
+
+	switch st.kind {
+	case stmtInsert:
+		return execInsert(t, st, args)
+	case stmtUpdate:
+		return execUpdate(t, st, args)
+	case stmtDelete:
+		return execDelete(t, st, args)
+	default:
+		return execSelect(t, st, args)
+	}
+}
+
+func execInsert(t *table, st *statement, args []driver.Value) (*result, error) {
+	res := &result{}
+
+	for _, values := range st.values {
+		r := make(row, len(st.columns))
+
+		for i, col := range st.columns {
+			v, err := values[i].eval(nil, args)
+			if err != nil {
+				return nil, err
+			}
+			r[col] = v
+		}
+
+		inserted, err := t.insert(r)
+		if err != nil {
+			return nil, err
+		}
+
+		res.affected++
+		if id, ok := inserted[serialColumn].(int64); ok {
+			res.lastID = id
+		}
+
+		if err = res.appendReturning(t, st.returning, inserted, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func execUpdate(t *table, st *statement, args []driver.Value) (*result, error) {
+	idx, err := t.filter(st.where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range st.set {
+		if err = t.ensureColumn(item.column); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &result{affected: int64(len(idx))}
+
+	for _, i := range idx {
+		updated := cloneRow(t.rows[i])
+
+		for _, item := range st.set {
+			v, err := item.expr.eval(t.rows[i], args) // all SET expressions see old row values
+			if err != nil {
+				return nil, err
+			}
+			updated[item.column] = normalize(v)
+		}
+
+		t.rows[i] = updated
+
+		if err = res.appendReturning(t, st.returning, updated, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func execDelete(t *table, st *statement, args []driver.Value) (*result, error) {
+	idx, err := t.filter(st.where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &result{affected: int64(len(idx))}
+
+	deleted := make(map[int]bool, len(idx))
+	for _, i := range idx {
+		deleted[i] = true
+
+		if err = res.appendReturning(t, st.returning, t.rows[i], args); err != nil {
+			return nil, err
+		}
+	}
+
+	rows := t.rows[:0]
+	for i, r := range t.rows {
+		if !deleted[i] {
+			rows = append(rows, r)
+		}
+	}
+	t.rows = rows
+
+	return res, nil
+}
+
+func execSelect(t *table, st *statement, args []driver.Value) (*result, error) {
+	idx, err := t.filter(st.where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]row, len(idx))
+	for i, j := range idx {
+		rows[i] = t.rows[j]
+	}
+
+	res := &result{columns: projectColumns(t, st.items)}
+
+	if hasAggregate(st.items) {
+		values := make([]driver.Value, 0, len(st.items))
+		for _, item := range st.items {
+			f, ok := item.expr.(*funcExpr)
+			if !ok || f.name != "count" {
+				return nil, errors.New("repotest: only count() columns allowed in aggregate select")
+			}
+
+			v, err := f.aggregate(rows, args)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+
+		res.rows = append(res.rows, values)
+
+		return res, nil
+	}
+
+	if err = sortRows(rows, st.order, args); err != nil {
+		return nil, err
+	}
+
+	if rows, err = limitRows(rows, st.limit, st.offset, args); err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		values, err := projectRow(t, st.items, r, args)
+		if err != nil {
+			return nil, err
+		}
+		res.rows = append(res.rows, values)
+	}
+
+	return res, nil
+}
+
+func hasAggregate(items []selectItem) bool {
+	for _, item := range items {
+		if !item.star && isAggregate(item.expr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func projectColumns(t *table, items []selectItem) []string {
+	cols := make([]string, 0, len(items))
+
+	for _, item := range items {
+		switch {
+		case item.star:
+			cols = append(cols, t.columns...)
+		case item.alias != "":
+			cols = append(cols, item.alias)
+		default:
+			cols = append(cols, exprName(item.expr))
+		}
+	}
+
+	return cols
+}
+
+func exprName(e expr) string {
+	switch v := e.(type) {
+	case *columnExpr:
+		return v.name
+	case *funcExpr:
+		return v.name
+	}
+
+	return "?column?"
+}
+
+func projectRow(t *table, items []selectItem, r row, args []driver.Value) ([]driver.Value, error) {
+	values := make([]driver.Value, 0, len(items))
+
+	for _, item := range items {
+		if item.star {
+			for _, col := range t.columns {
+				values = append(values, r[col])
+			}
+			continue
+		}
+
+		v, err := item.expr.eval(r, args)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+func (res *result) appendReturning(t *table, items []selectItem, r row, args []driver.Value) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	if res.columns == nil {
+		res.columns = projectColumns(t, items)
+	}
+
+	values, err := projectRow(t, items, r, args)
+	if err != nil {
+		return err
+	}
+
+	res.rows = append(res.rows, values)
+
+	return nil
+}
+
+// sortRows sort like Postgres: NULLs are last for ASC and first for DESC.
+func sortRows(rows []row, order []orderItem, args []driver.Value) error {
+	if len(order) == 0 {
+		return nil
+	}
+
+	var sortErr error
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range order {
+			a, err := o.expr.eval(rows[i], args)
+			if err != nil {
+				sortErr = err
+				return false
+			}
+
+			b, err := o.expr.eval(rows[j], args)
+			if err != nil {
+				sortErr = err
+				return false
+			}
+
+			c := 0
+			switch {
+			case a == nil && b == nil:
+			case a == nil:
+				c = 1
+			case b == nil:
+				c = -1
+			default:
+				if c, err = compare(a, b); err != nil {
+					sortErr = err
+					return false
+				}
+			}
+
+			if o.desc {
+				c = -c
+			}
+
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return false
+	})
+
+	return sortErr
+}
+
+func limitRows(rows []row, limit, offset expr, args []driver.Value) ([]row, error) {
+	if offset != nil {
+		n, err := evalCount(offset, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if n >= int64(len(rows)) {
+			return rows[:0], nil
+		}
+		rows = rows[n:]
+	}
+
+	if limit != nil {
+		n, err := evalCount(limit, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if n < int64(len(rows)) {
+			rows = rows[:n]
+		}
+	}
+
+	return rows, nil
+}
+
+func evalCount(e expr, args []driver.Value) (int64, error) {
+	v, err := e.eval(nil, args)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, errors.Errorf("repotest: LIMIT/OFFSET must be not negative integer, got %v", v)
+	}
+
+	return n, nil
+}
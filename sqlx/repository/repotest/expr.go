@@ -0,0 +1,501 @@
+package repotest
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	row = map[string]interface{}
+
+	expr interface {
+		eval(r row, args []driver.Value) (interface{}, error)
+	}
+
+	literalExpr struct{ v interface{} }
+	paramExpr   struct{ n int }
+	columnExpr  struct{ name string }
+
+	logicExpr struct {
+		op          string
+		left, right expr
+	}
+
+	notExpr struct{ e expr }
+
+	cmpExpr struct {
+		op          string
+		left, right expr
+	}
+
+	arithExpr struct {
+		op          string
+		left, right expr
+	}
+
+	isNullExpr struct {
+		e   expr
+		not bool
+	}
+
+	inExpr struct {
+		e    expr
+		list []expr
+		not  bool
+	}
+
+	likeExpr struct {
+		e, pattern expr
+		not, ci    bool
+	}
+
+	funcExpr struct {
+		name string
+		args []expr
+		star bool
+	}
+)
+
+// ErrUnknownColumn - column is not present in table.
+var ErrUnknownColumn = errors.New("repotest: unknown column")
+
+func (e *literalExpr) eval(row, []driver.Value) (interface{}, error) {
+	return e.v, nil
+}
+
+func (e *paramExpr) eval(_ row, args []driver.Value) (interface{}, error) {
+	if e.n < 1 || e.n > len(args) {
+		return nil, errors.Errorf("repotest: placeholder $%d out of range, args count %d", e.n, len(args))
+	}
+
+	return normalize(args[e.n-1]), nil
+}
+
+func (e *columnExpr) eval(r row, _ []driver.Value) (interface{}, error) {
+	v, found := r[e.name]
+	if !found {
+		return nil, errors.Wrap(ErrUnknownColumn, e.name)
+	}
+
+	return v, nil
+}
+
+func (e *logicExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	l, err := e.left.eval(r, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// short circuit
+	if e.op == "and" && l == false {
+		return false, nil
+	}
+	if e.op == "or" && l == true {
+		return true, nil
+	}
+
+	rv, err := e.right.eval(r, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "and" {
+		if rv == false {
+			return false, nil
+		}
+		if l == nil || rv == nil {
+			return nil, nil
+		}
+		return true, nil
+	}
+
+	if rv == true {
+		return true, nil
+	}
+	if l == nil || rv == nil {
+		return nil, nil
+	}
+	return false, nil
+}
+
+func (e *notExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	v, err := e.e.eval(r, args)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return nil, errors.Errorf("repotest: NOT argument must be boolean, got %T", v)
+	}
+
+	return !b, nil
+}
+
+func (e *cmpExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	l, err := e.left.eval(r, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := e.right.eval(r, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil || rv == nil {
+		return nil, nil
+	}
+
+	c, err := compare(l, rv)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "=":
+		return c == 0, nil
+	case "<>", "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func (e *arithExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	l, err := e.left.eval(r, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := e.right.eval(r, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil || rv == nil {
+		return nil, nil
+	}
+
+	if t, ok := l.(time.Time); ok { // timestamp +/- interval in nanoseconds
+		if d, ok := rv.(int64); ok {
+			if e.op == "-" {
+				d = -d
+			}
+			return t.Add(time.Duration(d)), nil
+		}
+	}
+
+	li, lok := l.(int64)
+	ri, rok := rv.(int64)
+	if lok && rok {
+		if e.op == "-" {
+			return li - ri, nil
+		}
+		return li + ri, nil
+	}
+
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(rv)
+	if !lok || !rok {
+		return nil, errors.Errorf("repotest: can't apply %s to %T and %T", e.op, l, rv)
+	}
+
+	if e.op == "-" {
+		return lf - rf, nil
+	}
+	return lf + rf, nil
+}
+
+func (e *isNullExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	v, err := e.e.eval(r, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return (v == nil) != e.not, nil
+}
+
+func (e *inExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	v, err := e.e.eval(r, args)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	for _, item := range e.list {
+		iv, err := item.eval(r, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if iv == nil {
+			continue
+		}
+
+		c, err := compare(v, iv)
+		if err != nil {
+			return nil, err
+		}
+
+		if c == 0 {
+			return !e.not, nil
+		}
+	}
+
+	return e.not, nil
+}
+
+func (e *likeExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	v, err := e.e.eval(r, args)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	p, err := e.pattern.eval(r, args)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	re, err := likeToRegexp(fmt.Sprint(p), e.ci)
+	if err != nil {
+		return nil, err
+	}
+
+	return re.MatchString(fmt.Sprint(v)) != e.not, nil
+}
+
+// likeToRegexp convert LIKE pattern to regexp, '\' is escape symbol.
+func likeToRegexp(pattern string, ci bool) (*regexp.Regexp, error) {
+	var sb strings.Builder
+
+	if ci {
+		sb.WriteString("(?is)^")
+	} else {
+		sb.WriteString("(?s)^")
+	}
+
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '%':
+			sb.WriteString(".*")
+		case c == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
+}
+
+func isKnownFunc(name string) bool {
+	switch name {
+	case "count", "now", "lower", "upper", "coalesce":
+		return true
+	}
+
+	return false
+}
+
+func isAggregate(e expr) bool {
+	f, ok := e.(*funcExpr)
+	return ok && f.name == "count"
+}
+
+func (e *funcExpr) eval(r row, args []driver.Value) (interface{}, error) {
+	switch e.name {
+	case "now":
+		return time.Now(), nil
+
+	case "lower", "upper":
+		if len(e.args) != 1 {
+			return nil, errors.Errorf("repotest: %s() expects one argument", e.name)
+		}
+
+		v, err := e.args[0].eval(r, args)
+		if err != nil || v == nil {
+			return nil, err
+		}
+
+		if e.name == "lower" {
+			return strings.ToLower(fmt.Sprint(v)), nil
+		}
+		return strings.ToUpper(fmt.Sprint(v)), nil
+
+	case "coalesce":
+		for _, a := range e.args {
+			v, err := a.eval(r, args)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	}
+
+	return nil, errors.Errorf("repotest: function %s() can't be used here", e.name)
+}
+
+// aggregate calc aggregate function (only count supported) over rows.
+func (e *funcExpr) aggregate(rows []row, args []driver.Value) (interface{}, error) {
+	if e.star || len(e.args) == 0 {
+		return int64(len(rows)), nil
+	}
+
+	cnt := int64(0)
+	for _, r := range rows {
+		v, err := e.args[0].eval(r, args)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			cnt++
+		}
+	}
+
+	return cnt, nil
+}
+
+// normalize convert driver values to small set of types used inside engine:
+// int64, float64, bool, string, time.Time and nil.
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case int:
+		return int64(val)
+	case int8:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case uint:
+		return int64(val)
+	case uint8:
+		return int64(val)
+	case uint16:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	case float32:
+		return float64(val)
+	}
+
+	return v
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	}
+
+	return 0, false
+}
+
+// compare return -1, 0, 1 like strings.Compare, values must be not nil.
+//
+//nolint:gocyclo
+func compare(a, b interface{}) (int, error) {
+	a, b = normalize(a), normalize(b)
+
+	switch av := a.(type) {
+	case int64:
+		if bv, ok := b.(int64); ok {
+			return cmpOrdered(av < bv, av > bv), nil
+		}
+
+	case string:
+		switch bv := b.(type) {
+		case string:
+			return strings.Compare(av, bv), nil
+		case time.Time:
+			if at, err := parseTime(av); err == nil {
+				return cmpTime(at, bv), nil
+			}
+		}
+
+	case bool:
+		if bv, ok := b.(bool); ok {
+			return cmpOrdered(!av && bv, av && !bv), nil
+		}
+
+	case time.Time:
+		switch bv := b.(type) {
+		case time.Time:
+			return cmpTime(av, bv), nil
+		case string:
+			if bt, err := parseTime(bv); err == nil {
+				return cmpTime(av, bt), nil
+			}
+		}
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		return cmpOrdered(af < bf, af > bf), nil
+	}
+
+	// last chance, for example int64 vs numeric string
+	as, bs := fmt.Sprint(a), fmt.Sprint(b)
+	if _, isStr := a.(string); isStr {
+		return strings.Compare(as, bs), nil
+	}
+	if _, isStr := b.(string); isStr {
+		return strings.Compare(as, bs), nil
+	}
+
+	return 0, errors.Errorf("repotest: can't compare %T and %T", a, b)
+}
+
+func cmpOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+
+	return 0
+}
+
+func cmpTime(a, b time.Time) int {
+	return cmpOrdered(a.Before(b), a.After(b))
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("repotest: bad time %q", s)
+}
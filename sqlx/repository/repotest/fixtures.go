@@ -0,0 +1,156 @@
+package repotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Fixtures - rows by table name. File format (YAML or JSON):
+//
+//	Users:
+//	  - name: admin
+//	    email: admin@test.ru
+//	Roles:
+//	  - {id: 1, name: admin, rights: 10}
+type Fixtures = map[string][]Row
+
+// ErrUnknownFixtureFormat - fixture file extension is not one of .json, .yml, .yaml.
+var ErrUnknownFixtureFormat = errors.New("repotest: unknown fixture format, expected .json, .yml or .yaml")
+
+// LoadFixtures load fixture files from OS file system into db.
+func (db *DB) LoadFixtures(paths ...string) error {
+	return db.loadFixtures(ioutil.ReadFile, paths...)
+}
+
+// LoadFixturesFS load fixture files from fsys into db (e.g. embed.FS).
+func (db *DB) LoadFixturesFS(fsys fs.FS, paths ...string) error {
+	return db.loadFixtures(func(path string) ([]byte, error) { return fs.ReadFile(fsys, path) }, paths...)
+}
+
+// loadFixtures load files one by one, tables of one file are filled in alphabetical order.
+func (db *DB) loadFixtures(readFile func(string) ([]byte, error), paths ...string) error {
+	for _, path := range paths {
+		data, err := readFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "[repotest.LoadFixtures] read %s", path)
+		}
+
+		fixtures, err := ParseFixtures(filepath.Ext(path), data)
+		if err != nil {
+			return errors.WithMessagef(err, "[repotest.LoadFixtures] parse %s", path)
+		}
+
+		if err = db.ApplyFixtures(fixtures); err != nil {
+			return errors.WithMessagef(err, "[repotest.LoadFixtures] apply %s", path)
+		}
+	}
+
+	return nil
+}
+
+// ApplyFixtures insert fixtures rows into db.
+func (db *DB) ApplyFixtures(fixtures Fixtures) error {
+	tables := make([]string, 0, len(fixtures))
+	for name := range fixtures {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+
+	for _, name := range tables {
+		if _, err := db.Insert(name, fixtures[name]...); err != nil {
+			return errors.WithMessagef(err, "table %s", name)
+		}
+	}
+
+	return nil
+}
+
+// ParseFixtures parse fixtures by format (file extension: .json, .yml, .yaml).
+func ParseFixtures(ext string, data []byte) (Fixtures, error) {
+	switch strings.ToLower(ext) {
+	case ".json":
+		return parseJSONFixtures(data)
+	case ".yml", ".yaml":
+		return parseYAMLFixtures(data)
+	}
+
+	return nil, ErrUnknownFixtureFormat
+}
+
+func parseJSONFixtures(data []byte) (Fixtures, error) {
+	raw := map[string][]map[string]interface{}{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "json")
+	}
+
+	return toFixtures(raw)
+}
+
+func parseYAMLFixtures(data []byte) (Fixtures, error) {
+	raw := map[string][]map[string]interface{}{}
+
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "yaml")
+	}
+
+	return toFixtures(raw)
+}
+
+func toFixtures(raw map[string][]map[string]interface{}) (Fixtures, error) {
+	fixtures := make(Fixtures, len(raw))
+
+	for name, rows := range raw {
+		fixtures[name] = make([]Row, 0, len(rows))
+
+		for _, r := range rows {
+			values := make(Row, len(r))
+
+			for col, v := range r {
+				value, err := fixtureValue(v)
+				if err != nil {
+					return nil, errors.WithMessagef(err, "table %s column %s", name, col)
+				}
+				values[col] = value
+			}
+
+			fixtures[name] = append(fixtures[name], values)
+		}
+	}
+
+	return fixtures, nil
+}
+
+// fixtureValue convert decoded value to engine value, strings which look like timestamp become time.Time.
+func fixtureValue(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		return val.Float64()
+
+	case string:
+		if t, err := parseTime(val); err == nil {
+			return t, nil
+		}
+		return val, nil
+
+	case nil, bool, int, int64, float64, time.Time:
+		return normalize(val), nil
+	}
+
+	return nil, errors.Errorf("repotest: unsupported fixture value %v (%T)", v, v)
+}
@@ -0,0 +1,834 @@
+package repotest
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Small SQL dialect parser. It understands only the subset of Postgres SQL
+// which is produced by squirrel builders inside repository package:
+//
+//	INSERT INTO t (c1, c2) VALUES ($1, $2), ($3, $4) RETURNING id
+//	SELECT c1, c2 as "alias", count(1) FROM t [AS a] WHERE ... ORDER BY c1 DESC LIMIT 10 OFFSET 20
+//	UPDATE t SET c1 = $1, c2 = c2 + 1 WHERE ... RETURNING *
+//	DELETE FROM t WHERE ... RETURNING id
+//
+// JOINs, sub queries, GROUP BY and etc. are not supported.
+
+type (
+	tokenKind int
+
+	token struct {
+		kind tokenKind
+		val  string
+	}
+
+	lexer struct {
+		src     string
+		pos     int
+		nextArg int // counter for `?` placeholders
+	}
+)
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokParam
+	tokPunct
+)
+
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: src}
+
+	var tokens []token
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, t)
+		if t.kind == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+		l.pos++
+	}
+
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF}, nil
+	}
+
+	c := l.src[l.pos]
+	start := l.pos
+
+	switch {
+	case isIdentStart(c):
+		for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, val: strings.ToLower(l.src[start:l.pos])}, nil
+
+	case isDigit(c):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNumber, val: l.src[start:l.pos]}, nil
+
+	case c == '"':
+		s, err := l.quoted('"')
+		return token{kind: tokQuotedIdent, val: s}, err
+
+	case c == '\'':
+		s, err := l.quoted('\'')
+		return token{kind: tokString, val: s}, err
+
+	case c == '$':
+		l.pos++
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		if l.pos == start+1 {
+			return token{}, errors.Errorf("repotest: bad placeholder at %d", start)
+		}
+		return token{kind: tokParam, val: l.src[start+1 : l.pos]}, nil
+
+	case c == '?':
+		l.pos++
+		l.nextArg++
+		return token{kind: tokParam, val: strconv.Itoa(l.nextArg)}, nil
+	}
+
+	for _, op := range []string{"<>", "!=", "<=", ">=", "::"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokPunct, val: op}, nil
+		}
+	}
+
+	if strings.ContainsRune("(),*=<>.;+-/", rune(c)) {
+		l.pos++
+		return token{kind: tokPunct, val: string(c)}, nil
+	}
+
+	return token{}, errors.Errorf("repotest: unexpected symbol %q at %d", c, start)
+}
+
+func (l *lexer) quoted(q byte) (string, error) {
+	var sb strings.Builder
+
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		if l.src[l.pos] != q {
+			sb.WriteByte(l.src[l.pos])
+			continue
+		}
+
+		if l.pos+1 < len(l.src) && l.src[l.pos+1] == q { // escaped quote: '' or ""
+			sb.WriteByte(q)
+			l.pos++
+			continue
+		}
+
+		l.pos++
+		return sb.String(), nil
+	}
+
+	return "", errors.New("repotest: unterminated quoted string")
+}
+
+func isSpace(c byte) bool      { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+func isDigit(c byte) bool      { return c >= '0' && c <= '9' }
+func isIdentStart(c byte) bool { return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isIdentPart(c byte) bool  { return isIdentStart(c) || isDigit(c) }
+
+type (
+	stmtKind int
+
+	selectItem struct {
+		expr  expr
+		star  bool
+		alias string
+	}
+
+	orderItem struct {
+		expr expr
+		desc bool
+	}
+
+	statement struct {
+		kind  stmtKind
+		table string
+
+		// INSERT
+		columns []string
+		values  [][]expr
+
+		// UPDATE
+		set []setItem
+
+		// SELECT
+		items  []selectItem
+		order  []orderItem
+		limit  expr
+		offset expr
+
+		where     expr
+		returning []selectItem
+	}
+
+	setItem struct {
+		column string
+		expr   expr
+	}
+
+	parser struct {
+		tokens []token
+		pos    int
+	}
+)
+
+const (
+	stmtSelect stmtKind = iota
+	stmtInsert
+	stmtUpdate
+	stmtDelete
+)
+
+func parse(query string) (*statement, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	var st *statement
+
+	switch {
+	case p.acceptKeyword("select"):
+		st, err = p.parseSelect()
+	case p.acceptKeyword("insert"):
+		st, err = p.parseInsert()
+	case p.acceptKeyword("update"):
+		st, err = p.parseUpdate()
+	case p.acceptKeyword("delete"):
+		st, err = p.parseDelete()
+	default:
+		return nil, errors.Errorf("repotest: unsupported statement: %s", query)
+	}
+
+	if err != nil {
+		return nil, errors.WithMessagef(err, "repotest: query `%s`", query)
+	}
+
+	p.accept(tokPunct, ";")
+
+	if !p.at(tokEOF, "") {
+		return nil, errors.Errorf("repotest: query `%s`: unexpected token %q", query, p.peek().val)
+	}
+
+	return st, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) at(kind tokenKind, val string) bool {
+	t := p.peek()
+	return t.kind == kind && (val == "" || t.val == val)
+}
+
+func (p *parser) accept(kind tokenKind, val string) bool {
+	if p.at(kind, val) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	return p.accept(tokIdent, kw)
+}
+
+func (p *parser) expect(kind tokenKind, val string) error {
+	if !p.accept(kind, val) {
+		return errors.Errorf("expected %q, got %q", val, p.peek().val)
+	}
+
+	return nil
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	return p.expect(tokIdent, kw)
+}
+
+func (p *parser) parseName() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent && t.kind != tokQuotedIdent {
+		return "", errors.Errorf("expected identifier, got %q", t.val)
+	}
+	p.pos++
+
+	return t.val, nil
+}
+
+// parseTableName parse table name with optional schema and alias, alias is ignored.
+// Schema qualified table is separate table with name "schema.table".
+func (p *parser) parseTableName() (string, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return "", err
+	}
+
+	if p.accept(tokPunct, ".") {
+		table, err := p.parseName()
+		if err != nil {
+			return "", err
+		}
+		name += "." + table
+	}
+
+	if p.acceptKeyword("as") {
+		if _, err = p.parseName(); err != nil {
+			return "", err
+		}
+	} else if t := p.peek(); t.kind == tokQuotedIdent || (t.kind == tokIdent && !isReserved(t.val)) {
+		p.pos++
+	}
+
+	return name, nil
+}
+
+func isReserved(word string) bool {
+	switch word {
+	case "where", "order", "limit", "offset", "set", "returning", "values", "for",
+		"join", "inner", "left", "right", "on", "group", "having":
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) parseSelect() (*statement, error) {
+	st := &statement{kind: stmtSelect}
+
+	items, err := p.parseSelectItems()
+	if err != nil {
+		return nil, err
+	}
+	st.items = items
+
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+
+	if st.table, err = p.parseTableName(); err != nil {
+		return nil, err
+	}
+
+	if p.at(tokIdent, "join") || p.at(tokIdent, "inner") || p.at(tokIdent, "left") || p.at(tokIdent, "right") {
+		return nil, errors.New("JOIN is not supported")
+	}
+
+	if st.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("order") {
+		if err = p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+
+		for {
+			var item orderItem
+			if item.expr, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+
+			if p.acceptKeyword("desc") {
+				item.desc = true
+			} else {
+				p.acceptKeyword("asc")
+			}
+
+			st.order = append(st.order, item)
+
+			if !p.accept(tokPunct, ",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("limit") {
+		if st.limit, err = p.parsePrimary(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("offset") {
+		if st.offset, err = p.parsePrimary(); err != nil {
+			return nil, err
+		}
+	}
+
+	// row locks have no sense for in-memory engine, all statements are serialized
+	if p.acceptKeyword("for") {
+		if err = p.expectKeyword("update"); err != nil {
+			return nil, err
+		}
+
+		if p.acceptKeyword("skip") {
+			if err = p.expectKeyword("locked"); err != nil {
+				return nil, err
+			}
+		} else {
+			p.acceptKeyword("nowait")
+		}
+	}
+
+	return st, nil
+}
+
+func (p *parser) parseSelectItems() ([]selectItem, error) {
+	var items []selectItem
+
+	for {
+		var item selectItem
+
+		if p.accept(tokPunct, "*") {
+			item.star = true
+		} else {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item.expr = e
+
+			if p.acceptKeyword("as") {
+				if item.alias, err = p.parseName(); err != nil {
+					return nil, err
+				}
+			} else if p.at(tokQuotedIdent, "") {
+				item.alias = p.peek().val
+				p.pos++
+			}
+		}
+
+		items = append(items, item)
+
+		if !p.accept(tokPunct, ",") {
+			return items, nil
+		}
+	}
+}
+
+func (p *parser) parseWhere() (expr, error) {
+	if !p.acceptKeyword("where") {
+		return nil, nil
+	}
+
+	return p.parseExpr()
+}
+
+func (p *parser) parseReturning() ([]selectItem, error) {
+	if !p.acceptKeyword("returning") {
+		return nil, nil
+	}
+
+	return p.parseSelectItems()
+}
+
+func (p *parser) parseInsert() (st *statement, err error) {
+	st = &statement{kind: stmtInsert}
+
+	if err = p.expectKeyword("into"); err != nil {
+		return nil, err
+	}
+
+	if st.table, err = p.parseTableName(); err != nil {
+		return nil, err
+	}
+
+	if err = p.expect(tokPunct, "("); err != nil {
+		return nil, err
+	}
+
+	for !p.accept(tokPunct, ")") {
+		var col string
+		if col, err = p.parseName(); err != nil {
+			return nil, err
+		}
+
+		st.columns = append(st.columns, col)
+		p.accept(tokPunct, ",")
+	}
+
+	if err = p.expectKeyword("values"); err != nil {
+		return nil, err
+	}
+
+	for {
+		if err = p.expect(tokPunct, "("); err != nil {
+			return nil, err
+		}
+
+		var row []expr
+		for !p.accept(tokPunct, ")") {
+			var e expr
+			if e, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+
+			row = append(row, e)
+			p.accept(tokPunct, ",")
+		}
+
+		if len(row) != len(st.columns) {
+			return nil, errors.New("INSERT has different count of columns and values")
+		}
+
+		st.values = append(st.values, row)
+
+		if !p.accept(tokPunct, ",") {
+			break
+		}
+	}
+
+	if st.returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (p *parser) parseUpdate() (st *statement, err error) {
+	st = &statement{kind: stmtUpdate}
+
+	if st.table, err = p.parseTableName(); err != nil {
+		return nil, err
+	}
+
+	if err = p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+
+	for {
+		var item setItem
+		if item.column, err = p.parseName(); err != nil {
+			return nil, err
+		}
+
+		if err = p.expect(tokPunct, "="); err != nil {
+			return nil, err
+		}
+
+		if item.expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+
+		st.set = append(st.set, item)
+
+		if !p.accept(tokPunct, ",") {
+			break
+		}
+	}
+
+	if st.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+
+	if st.returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (p *parser) parseDelete() (st *statement, err error) {
+	st = &statement{kind: stmtDelete}
+
+	if err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+
+	if st.table, err = p.parseTableName(); err != nil {
+		return nil, err
+	}
+
+	if st.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+
+	if st.returning, err = p.parseReturning(); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// Expressions, from lower to higher precedence: OR, AND, NOT, predicates (=, IN, LIKE, IS NULL), +/-, primary.
+
+func (p *parser) parseExpr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicExpr{op: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.acceptKeyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicExpr{op: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{e: e}, nil
+	}
+
+	return p.parsePredicate()
+}
+
+//nolint:gocyclo
+func (p *parser) parsePredicate() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokPunct {
+		switch t.val {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.pos++
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &cmpExpr{op: t.val, left: left, right: right}, nil
+		}
+	}
+
+	if p.acceptKeyword("is") {
+		not := p.acceptKeyword("not")
+		if err = p.expectKeyword("null"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{e: left, not: not}, nil
+	}
+
+	not := p.acceptKeyword("not")
+
+	switch {
+	case p.acceptKeyword("in"):
+		if err = p.expect(tokPunct, "("); err != nil {
+			return nil, err
+		}
+
+		in := &inExpr{e: left, not: not}
+		for !p.accept(tokPunct, ")") {
+			e, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, e)
+			p.accept(tokPunct, ",")
+		}
+		return in, nil
+
+	case p.at(tokIdent, "like") || p.at(tokIdent, "ilike"):
+		ci := p.peek().val == "ilike"
+		p.pos++
+
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{e: left, pattern: pattern, not: not, ci: ci}, nil
+	}
+
+	if not {
+		return nil, errors.Errorf("unexpected NOT before %q", p.peek().val)
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.at(tokPunct, "+") || p.at(tokPunct, "-") {
+		op := p.peek().val
+		p.pos++
+
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+//nolint:gocyclo
+func (p *parser) parsePrimary() (e expr, err error) {
+	t := p.peek()
+
+	switch t.kind {
+	case tokParam:
+		p.pos++
+		n, _ := strconv.Atoi(t.val)
+		e = &paramExpr{n: n}
+
+	case tokNumber:
+		p.pos++
+		if strings.Contains(t.val, ".") {
+			f, err := strconv.ParseFloat(t.val, 64)
+			if err != nil {
+				return nil, err
+			}
+			e = &literalExpr{v: f}
+		} else {
+			i, err := strconv.ParseInt(t.val, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			e = &literalExpr{v: i}
+		}
+
+	case tokString:
+		p.pos++
+		e = &literalExpr{v: t.val}
+
+	case tokQuotedIdent:
+		p.pos++
+		e = &columnExpr{name: t.val}
+
+	case tokIdent:
+		e, err = p.parseIdentExpr()
+		if err != nil {
+			return nil, err
+		}
+
+	case tokPunct:
+		switch t.val {
+		case "(":
+			p.pos++
+			if e, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			if err = p.expect(tokPunct, ")"); err != nil {
+				return nil, err
+			}
+		case "-":
+			p.pos++
+			inner, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			e = &arithExpr{op: "-", left: &literalExpr{v: int64(0)}, right: inner}
+		default:
+			return nil, errors.Errorf("unexpected %q", t.val)
+		}
+
+	default:
+		return nil, errors.New("unexpected end of query")
+	}
+
+	// postgres type cast, e.g. $1::jsonb, value passed as is
+	for p.accept(tokPunct, "::") {
+		if _, err = p.parseName(); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+func (p *parser) parseIdentExpr() (expr, error) {
+	t := p.peek()
+	p.pos++
+
+	switch t.val {
+	case "null":
+		return &literalExpr{v: nil}, nil
+	case "true":
+		return &literalExpr{v: true}, nil
+	case "false":
+		return &literalExpr{v: false}, nil
+	}
+
+	if p.accept(tokPunct, "(") {
+		call := &funcExpr{name: t.val}
+
+		for !p.accept(tokPunct, ")") {
+			if p.accept(tokPunct, "*") {
+				call.star = true
+				continue
+			}
+
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			p.accept(tokPunct, ",")
+		}
+
+		if !isKnownFunc(call.name) {
+			return nil, errors.Errorf("function %s() is not supported", call.name)
+		}
+
+		return call, nil
+	}
+
+	name := t.val
+	if p.accept(tokPunct, ".") { // qualified column: alias.column, qualifier is ignored
+		col, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		name = col
+	}
+
+	return &columnExpr{name: name}, nil
+}
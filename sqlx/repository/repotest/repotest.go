@@ -0,0 +1,162 @@
+// Package repotest - in-process fake of Postgres for tests of code which use repository package.
+//
+// DB implements repository.SqlxDBConnectorI (it is *sqlx.DB on top of in-memory database/sql driver),
+// so it can be passed to repository.NewSqlxMapRepo instead of real connection:
+//
+//	db := repotest.New(repotest.Table{Name: "Users", Defaults: repotest.Defaults{"created_at": repotest.Now}})
+//	_ = db.LoadFixtures("testdata/users.yml")
+//	repos := repository.NewSqlxMapRepo(zap.NewNop(), db, []string{"Users"}, nil)
+//
+// Engine is bounded: it understands only SQL generated by repository (squirrel builders):
+// single table SELECT/INSERT/UPDATE/DELETE with WHERE, ORDER BY, LIMIT, OFFSET, RETURNING, count().
+// Column "id" is auto increment. Tables which are not declared by Table are schemaless:
+// they are created on first usage and get new columns on INSERT. Schema qualified table is separate table "schema.table".
+package repotest
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DriverName - name of fake driver, bind type is the same as in Postgres ($1, $2 ...).
+const DriverName = "repotest"
+
+type (
+	// Defaults - default values of columns used by INSERT, like DEFAULT NOW() in DSL.
+	Defaults = map[string]DefaultFn
+
+	// Table - schema of table. Table with not empty Columns is strict: unknown columns are not allowed.
+	Table struct {
+		Name     string
+		Columns  []string
+		Defaults Defaults
+	}
+
+	// DB - fake database.
+	DB struct {
+		*sqlx.DB
+		engine *engine
+	}
+
+	// Row - values of row by columns.
+	Row = map[string]interface{}
+)
+
+func init() {
+	sqlx.BindDriver(DriverName, sqlx.DOLLAR)
+}
+
+// Now - DefaultFn which return current time.
+func Now() interface{} {
+	return time.Now()
+}
+
+// New create new empty fake db with tables. Each fake db has own storage.
+func New(tables ...Table) *DB {
+	e := newEngine()
+
+	db := &DB{
+		DB:     sqlx.NewDb(sql.OpenDB(&connector{engine: e}), DriverName),
+		engine: e,
+	}
+
+	for _, t := range tables {
+		db.CreateTable(t)
+	}
+
+	return db
+}
+
+// CreateTable create (or replace) table.
+func (db *DB) CreateTable(t Table) {
+	tbl := newTable(foldName(t.Name))
+	tbl.strict = len(t.Columns) > 0
+
+	for _, col := range t.Columns {
+		if !tbl.hasColumn(col) {
+			tbl.columns = append(tbl.columns, col)
+		}
+	}
+
+	declared := len(tbl.columns)
+
+	for col, fn := range t.Defaults {
+		tbl.defaults[col] = fn
+		if !tbl.strict && !tbl.hasColumn(col) {
+			tbl.columns = append(tbl.columns, col)
+		}
+	}
+
+	sort.Strings(tbl.columns[declared:]) // declared columns keep order, columns of defaults are sorted
+
+	db.engine.mu.Lock()
+	defer db.engine.mu.Unlock()
+
+	db.engine.tables[tbl.name] = tbl
+}
+
+// Rows return copy of all table rows in insertion order. Useful for asserts in tests.
+func (db *DB) Rows(table string) []Row {
+	db.engine.mu.Lock()
+	defer db.engine.mu.Unlock()
+
+	t, found := db.engine.tables[foldName(table)]
+	if !found {
+		return []Row{}
+	}
+
+	rows := make([]Row, 0, len(t.rows))
+	for _, r := range t.rows {
+		rows = append(rows, cloneRow(r))
+	}
+
+	return rows
+}
+
+// Truncate remove all rows of tables and restart identity.
+func (db *DB) Truncate(tables ...string) {
+	db.engine.mu.Lock()
+	defer db.engine.mu.Unlock()
+
+	for _, name := range tables {
+		if t, found := db.engine.tables[foldName(name)]; found {
+			t.rows, t.serial = nil, 0
+		}
+	}
+}
+
+// Insert insert rows into table directly (without SQL), return ids of rows.
+func (db *DB) Insert(table string, rows ...Row) ([]int64, error) {
+	db.engine.stmtMu.Lock()
+	defer db.engine.stmtMu.Unlock()
+
+	tc := newTxCatalog(db.engine)
+
+	name := foldName(table)
+	t := tc.table(name)
+	tc.dirty[name] = true
+
+	ids := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		inserted, err := t.insert(r)
+		if err != nil {
+			return nil, err
+		}
+
+		id, _ := inserted[serialColumn].(int64)
+		ids = append(ids, id)
+	}
+
+	tc.commit()
+
+	return ids, nil
+}
+
+// foldName fold table name like Postgres does it for not quoted identifiers.
+func foldName(name string) string {
+	return strings.ToLower(name)
+}
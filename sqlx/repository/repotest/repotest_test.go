@@ -0,0 +1,268 @@
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/helper"
+	"github.com/imperiuse/golib/sqlx/repository"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type (
+	BaseDTO struct {
+		ID        int64     `db:"id"          orm_use_in:"select"`
+		CreatedAt time.Time `db:"created_at"  orm_use_in:"select"`
+		UpdatedAt time.Time `db:"updated_at"  orm_use_in:"select,update"`
+	}
+
+	User struct {
+		BaseDTO
+		Name     string      `db:"name"     orm_use_in:"select,create,update"`
+		Email    string      `db:"email"    orm_use_in:"select,create,update"`
+		Password string      `db:"password" orm_use_in:"select,create,update"`
+		RoleID   int64       `db:"role_id"  orm_use_in:"select,create,update"`
+		_        interface{} `orm_table_name:"Users"`
+	}
+
+	Role struct {
+		BaseDTO
+		Name   string      `db:"name"    orm_use_in:"select,create,update"`
+		Rights int         `db:"rights"  orm_use_in:"select,create,update"`
+		_      interface{} `orm_table_name:"Roles"`
+	}
+)
+
+func (b *BaseDTO) Identity() repository.ID {
+	return b.ID
+}
+
+var timestamps = Defaults{"created_at": Now, "updated_at": Now}
+
+type RepotestTestSuit struct {
+	suite.Suite
+	ctx   context.Context
+	db    *DB
+	repos repository.Repositories
+}
+
+func (suite *RepotestTestSuit) SetupTest() {
+	suite.ctx = context.Background()
+	suite.db = New(
+		Table{Name: "Roles", Columns: []string{"id", "created_at", "updated_at", "name", "rights"}, Defaults: timestamps},
+		Table{Name: "Users", Defaults: timestamps},
+	)
+	suite.repos = repository.NewSqlxMapRepo(zap.NewNop(), suite.db, nil, []repository.DTO{&User{}, &Role{}})
+
+	assert.Nil(suite.T(), suite.db.LoadFixtures("testdata/roles.yml", "testdata/users.json"))
+}
+
+func (suite *RepotestTestSuit) TearDownTest() {
+	assert.Nil(suite.T(), suite.db.Close())
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestSuite(t *testing.T) {
+	suite.Run(t, new(RepotestTestSuit))
+}
+
+func (suite *RepotestTestSuit) Test_ImplementsConnector() {
+	var conn repository.SqlxDBConnectorI = suite.db
+	assert.Equal(suite.T(), DriverName, conn.DriverName())
+	assert.Equal(suite.T(), "SELECT * FROM t WHERE a = $1", conn.Rebind("SELECT * FROM t WHERE a = ?"))
+}
+
+func (suite *RepotestTestSuit) Test_Fixtures() {
+	t := suite.T()
+
+	roles := suite.db.Rows("Roles")
+	assert.Equal(t, 2, len(roles))
+	assert.Equal(t, "admin", roles[0]["name"])
+	assert.Equal(t, int64(100), roles[0]["rights"])
+
+	users := suite.db.Rows("users")
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, int64(1), users[0]["id"])
+	assert.Equal(t, time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC), users[0]["created_at"])
+	assert.Equal(t, int64(2), users[1]["id"])
+
+	_, err := ParseFixtures(".txt", []byte("Roles: []"))
+	assert.Equal(t, ErrUnknownFixtureFormat, err)
+	assert.NotNil(t, suite.db.LoadFixtures("testdata/not_exist.yml"))
+
+	_, err = ParseFixtures(".json", []byte(`{"Roles": [{"unknown_column": 1}]}`))
+	assert.Nil(t, err)
+	err = suite.db.ApplyFixtures(Fixtures{"Roles": {{"unknown_column": 1}}})
+	assert.NotNil(t, err, "Roles is strict table")
+}
+
+func (suite *RepotestTestSuit) Test_CRUD() {
+	t := suite.T()
+	ctx := suite.ctx
+
+	role := Role{Name: "manager", Rights: 50}
+
+	id, err := suite.repos.AutoCreate(ctx, &role)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), id)
+
+	var temp = Role{BaseDTO: BaseDTO{ID: id.(int64)}}
+	assert.Nil(t, suite.repos.AutoGet(ctx, &temp))
+	assert.Equal(t, role.Name, temp.Name)
+	assert.Equal(t, role.Rights, temp.Rights)
+	assert.False(t, temp.CreatedAt.IsZero())
+
+	temp.Name = "manager_updated"
+	cnt, err := suite.repos.AutoUpdate(ctx, &temp)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	var temp2 Role
+	assert.Nil(t, suite.repos.AutoRepo(&temp2).Get(ctx, id, &temp2))
+	assert.Equal(t, "manager_updated", temp2.Name)
+
+	cnt, err = suite.repos.AutoDelete(ctx, &temp)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	assert.Equal(t, sql.ErrNoRows, errors.Cause(suite.repos.AutoRepo(&temp2).Get(ctx, id, &temp2)))
+
+	_, err = suite.repos.AutoRepo(&role).Insert(ctx, []string{"unknown"}, []interface{}{1})
+	assert.NotNil(t, err)
+}
+
+func (suite *RepotestTestSuit) Test_Finders() {
+	t := suite.T()
+	ctx := suite.ctx
+	repo := suite.repos.AutoRepo(&User{})
+
+	var users []User
+	assert.Nil(t, repo.FindBy(ctx, []string{"*"}, squirrel.Eq{"role_id": []int{1, 2}}, &users))
+	assert.Equal(t, 2, len(users))
+
+	var user User
+	assert.Nil(t, repo.FindOneBy(ctx, []string{"id", "name"}, squirrel.And{
+		squirrel.Like{"email": "%@test.ru"},
+		squirrel.Gt{"role_id": 1},
+	}, &user))
+	assert.Equal(t, "User", user.Name)
+	assert.Equal(t, "", user.Email)
+
+	users = users[:0]
+	assert.Nil(t, repo.FindByExample(ctx, &User{Name: "dmi"}, repository.ExampleOptions{
+		LikeStrings: true,
+		OrderBy:     []string{"id DESC"},
+	}, &users))
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, "admin@test.ru", users[0].Email)
+
+	cnt, err := repo.CountByQuery(ctx, squirrel.Select("count(1)").From("Users").Where(squirrel.NotEq{"role_id": 1}))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), cnt)
+
+	ra, err := repo.UpdateCustom(ctx, map[string]interface{}{"role_id": squirrel.Expr("role_id + 10")}, squirrel.Eq{"id": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ra)
+	assert.Equal(t, int64(11), suite.db.Rows("Users")[0]["role_id"])
+
+	assert.NotNil(t, repo.FindByWithInnerJoin(ctx, []string{"*"}, "Users as u", "Roles as r ON u.role_id = r.id",
+		squirrel.Eq{"u.id": 1}, &users), "joins are not supported")
+}
+
+func (suite *RepotestTestSuit) Test_Pagination() {
+	t := suite.T()
+
+	for i := 0; i < 10; i++ {
+		_, err := suite.db.Insert("Paginators", Row{"name": string(rune('a' + i))})
+		assert.Nil(t, err)
+	}
+
+	type Paginator struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	var res []Paginator
+	pr, err := suite.repos.Repo("Roles").SelectWithPagePagination(suite.ctx,
+		squirrel.Select("id", "name").From("Paginators").OrderBy("name DESC"),
+		repository.PagePaginationParams{PageNumber: 2, PageSize: 4},
+		&res)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), pr.CntPages, "count calculated by Roles table")
+	assert.Equal(t, []Paginator{{6, "f"}, {5, "e"}, {4, "d"}, {3, "c"}}, res)
+}
+
+func (suite *RepotestTestSuit) Test_Transaction() {
+	t := suite.T()
+	ctx := suite.ctx
+
+	insert := func(name string) helper.TxFn {
+		return func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO Roles (name, rights) VALUES ($1, $2)", name, 1)
+			return err
+		}
+	}
+	fail := func(tx *sqlx.Tx) error { return errors.New("fail") }
+
+	assert.NotNil(t, helper.WithTransaction(ctx, nil, suite.db, insert("r1"), fail))
+	assert.Equal(t, 2, len(suite.db.Rows("Roles")), "rollback")
+
+	assert.Nil(t, helper.WithTransaction(ctx, nil, suite.db, insert("r1"), insert("r2")))
+	assert.Equal(t, 4, len(suite.db.Rows("Roles")), "commit")
+
+	suite.db.Truncate("Roles")
+	assert.Equal(t, 0, len(suite.db.Rows("Roles")))
+}
+
+func (suite *RepotestTestSuit) Test_Engine() {
+	t := suite.T()
+	ctx := suite.ctx
+
+	var names []string
+	assert.Nil(t, suite.db.SelectContext(ctx, &names,
+		`SELECT name FROM Roles WHERE (rights >= 10 OR name IS NULL) AND NOT name IN ('x', 'y') ORDER BY rights LIMIT 5 OFFSET 0`))
+	assert.Equal(t, []string{"user", "admin"}, names)
+
+	var ids []int64
+	assert.Nil(t, suite.db.SelectContext(ctx, &ids, `UPDATE Roles SET rights = rights - 1 WHERE name ILIKE 'ADM%' RETURNING id`))
+	assert.Equal(t, []int64{1}, ids)
+	assert.Equal(t, int64(99), suite.db.Rows("Roles")[0]["rights"])
+
+	ids = ids[:0]
+	assert.Nil(t, suite.db.SelectContext(ctx, &ids, `DELETE FROM Roles WHERE id = ? RETURNING id`, 2))
+	assert.Equal(t, []int64{2}, ids)
+
+	_, err := suite.db.ExecContext(ctx, "CREATE TABLE t (id INT)")
+	assert.NotNil(t, err)
+
+	_, err = suite.db.ExecContext(ctx, "SELECT unknown FROM Roles")
+	assert.Equal(t, ErrUnknownColumn, errors.Cause(err))
+
+	_, err = suite.db.ExecContext(ctx, "SELECT * FROM Roles WHERE id = $2", 1)
+	assert.NotNil(t, err)
+
+	_, err = suite.db.ExecContext(ctx, "SELECT * FROM Roles WHERE name = 'unterminated")
+	assert.NotNil(t, err)
+}
+
+func (suite *RepotestTestSuit) Test_OrmColumns() {
+	t := suite.T()
+
+	cols, _ := orm.GetDataForSelect(&Role{})
+
+	var roles []Role
+	assert.Nil(t, suite.db.SelectContext(suite.ctx, &roles,
+		"SELECT "+strings.Join(cols, ", ")+" FROM Roles ORDER BY id DESC"))
+	assert.Equal(t, 2, len(roles))
+	assert.Equal(t, "user", roles[0].Name)
+}
@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/reflect/orm"
+)
+
+// scanMapper - the same mapper as default mapper of sqlx, used for scan of DTO which can't be scanned by sqlx.
+var scanMapper = reflectx.NewMapperFunc("db", sqlx.NameMapper)
+
+// scanField - destination field of result column.
+type scanField struct {
+	index   []int
+	json    bool
+	encrypt string // key name of orm_encrypt
+}
+
+// selectQuery return SELECT of columns (select columns of DTO of target by default) from table of repository.
+// Composite DTO (orm_join) is selected from INNER JOIN of tables of its parts, columns of condition must be
+// qualified by aliases of parts, discriminator of tenant (TenantModeColumn) is checked for first part.
+func (sc tenantScope) selectQuery(columns []Column, condition Condition, target interface{}) squirrel.SelectBuilder {
+	dto := targetDTO(target)
+	if len(columns) == 0 {
+		columns = selectColumns(dto)
+	}
+
+	parts := orm.GetJoinParts(dto)
+	if len(parts) < 2 {
+		return squirrel.Select(columns...).From(sc.table).Where(sc.where(condition))
+	}
+
+	from := sc.joinTable(parts[0])
+
+	qb := squirrel.Select(columns...).From(from)
+	for _, part := range parts[1:] {
+		qb = qb.InnerJoin(sc.joinTable(part) + " " + part.On)
+	}
+
+	return qb.Where(sc.whereAlias(condition, from))
+}
+
+// joinTable return table of part of composite DTO with its alias.
+func (sc tenantScope) joinTable(part orm.JoinPart) string {
+	return sc.qualify(part.Table) + " AS " + part.Alias
+}
+
+// idColumn return column of id of DTO, qualified by alias of first part for composite DTO.
+func idColumn(dto DTO) Column {
+	if parts := orm.GetJoinParts(dto); len(parts) > 1 {
+		return parts[0].Alias + ".id"
+	}
+
+	return "id"
+}
+
+// selectColumns return select columns of DTO, "*" if DTO has no select columns.
+func selectColumns(dto DTO) []Column {
+	if columns, _ := orm.GetDataForSelect(dto); len(columns) > 0 {
+		return columns
+	}
+
+	return []Column{"*"}
+}
+
+// targetDTO return pointer to zero DTO of target (pointer to struct or to slice of structs), nil for other targets.
+func targetDTO(target interface{}) DTO {
+	t := reflect.TypeOf(target)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil
+	}
+
+	t = t.Elem()
+	if t.Kind() == reflect.Slice {
+		t = reflectx.Deref(t.Elem())
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return reflect.New(t).Interface()
+}
+
+// selectContext - sqlx.SelectContext which unmarshal orm_json fields of DTO, decrypt orm_encrypt fields
+// and scan "alias.col" columns into fields of aliased nested structs (orm_alias), AfterLoad hooks are called.
+func selectContext(
+	ctx context.Context,
+	q sqlx.QueryerContext,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	if err := scanAll(ctx, q, dest, query, args...); err != nil {
+		return err
+	}
+
+	return afterLoad(ctx, dest)
+}
+
+func scanAll(
+	ctx context.Context,
+	q sqlx.QueryerContext,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return sqlx.SelectContext(ctx, q, dest, query, args...)
+	}
+
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	base := reflectx.Deref(elemType)
+
+	if !needsOrmScan(base) {
+		return sqlx.SelectContext(ctx, q, dest, query, args...)
+	}
+
+	rows, err := q.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	fields, err := scanFields(rows, base)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		vp := reflect.New(base)
+		if err = scanRow(rows, fields, vp.Elem()); err != nil {
+			return err
+		}
+
+		if isPtr {
+			slice.Set(reflect.Append(slice, vp))
+		} else {
+			slice.Set(reflect.Append(slice, vp.Elem()))
+		}
+	}
+
+	return rows.Err()
+}
+
+// getContext - sqlx.GetContext which unmarshal orm_json fields of DTO, decrypt orm_encrypt fields
+// and scan "alias.col" columns into fields of aliased nested structs (orm_alias), AfterLoad hook is called.
+func getContext(
+	ctx context.Context,
+	q sqlx.QueryerContext,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	if err := scanOne(ctx, q, dest, query, args...); err != nil {
+		return err
+	}
+
+	return afterLoad(ctx, dest)
+}
+
+func scanOne(
+	ctx context.Context,
+	q sqlx.QueryerContext,
+	dest interface{},
+	query string,
+	args ...interface{},
+) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct || !needsOrmScan(v.Elem().Type()) {
+		return sqlx.GetContext(ctx, q, dest, query, args...)
+	}
+
+	rows, err := q.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	fields, err := scanFields(rows, v.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	if err = scanRow(rows, fields, v.Elem()); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+// needsOrmScan - struct t has orm_json, orm_encrypt fields or aliased select fields, sqlx can't scan it.
+func needsOrmScan(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	for _, fi := range scanMapper.TypeMap(t).Index {
+		if fi.Field.Tag != "" && (orm.IsJSONField(fi.Field) || orm.EncryptKeyName(fi.Field) != "") {
+			return true
+		}
+	}
+
+	for _, f := range orm.GetSelectFields(reflect.New(t).Interface()) {
+		if strings.Contains(f.Name, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanFields return destination fields of result columns in struct t, columns are searched by names of sqlx
+// (db tags), then by names of orm select fields ("alias.col").
+func scanFields(rows *sqlx.Rows, t reflect.Type) ([]scanField, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	tm := scanMapper.TypeMap(t)
+
+	selectFields := orm.GetSelectFields(reflect.New(t).Interface())
+	ormFields := make(map[Column]orm.SelectField, len(selectFields))
+	for _, f := range selectFields {
+		ormFields[f.Name] = f
+	}
+
+	fields := make([]scanField, len(columns))
+	for i, col := range columns {
+		if fi, found := tm.Names[col]; found {
+			fields[i] = scanField{
+				index:   fi.Index,
+				json:    orm.IsJSONField(fi.Field),
+				encrypt: orm.EncryptKeyName(fi.Field),
+			}
+			continue
+		}
+
+		f, found := ormFields[col]
+		if !found {
+			return nil, errors.Errorf("missing destination name %s in %s", col, t)
+		}
+
+		fields[i] = scanField{index: f.Index, json: f.JSON, encrypt: f.Encrypt}
+	}
+
+	return fields, nil
+}
+
+// scanRow scan row into struct v, orm_json fields are scanned by orm.JSONScanner,
+// orm_encrypt fields - by orm.EncryptedScanner.
+func scanRow(rows *sqlx.Rows, fields []scanField, v reflect.Value) error {
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		field := reflectx.FieldByIndexes(v, f.index).Addr().Interface()
+		if f.json {
+			field = &orm.JSONScanner{Dest: field}
+		}
+		if f.encrypt != "" {
+			field = &orm.EncryptedScanner{Dest: field, Key: f.encrypt}
+		}
+
+		values[i] = field
+	}
+
+	return rows.Scan(values...)
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type (
+	Customer struct {
+		ID   int64       `db:"id"    orm_use_in:"select"`
+		Name string      `db:"name"  orm_use_in:"select,create"`
+		_    interface{} `orm_table_name:"Customers" orm_alias:"c"`
+	}
+
+	Order struct {
+		ID         int64       `db:"id"           orm_use_in:"select"`
+		CustomerID int64       `db:"customer_id"  orm_use_in:"select,create"`
+		Total      float64     `db:"total"        orm_use_in:"select,create"`
+		Note       string      `db:"note"`
+		_          interface{} `orm_table_name:"Orders" orm_alias:"o"`
+	}
+
+	OrderView struct {
+		Order    `orm_alias:"o"`
+		Customer `orm_alias:"c"`
+		_        bool `orm_join:"ON c.id = o.customer_id"`
+	}
+
+	CustomerView struct {
+		Customer `orm_alias:"c"`
+	}
+)
+
+func TestSelectQuery(t *testing.T) {
+	sql := func(qb squirrel.SelectBuilder) string {
+		query, _, err := qb.PlaceholderFormat(squirrel.Dollar).ToSql()
+		assert.Nil(t, err)
+		return query
+	}
+
+	sc := tenantScope{table: "Orders"}
+
+	assert.Equal(t, "SELECT id, customer_id, total FROM Orders WHERE id = $1",
+		sql(sc.selectQuery(nil, squirrel.Eq{idColumn(&Order{}): 1}, &Order{})))
+	assert.Equal(t, "SELECT id, note FROM Orders", sql(sc.selectQuery([]Column{"id", "note"}, nil, &[]Order{})))
+	assert.Equal(t, "SELECT * FROM Orders", sql(sc.selectQuery(nil, nil, &[]int64{})), "not DTO")
+	assert.Equal(t, "SELECT * FROM Orders", sql(sc.selectQuery(nil, nil, &struct{ ID int64 }{})), "no select columns")
+
+	assert.Equal(t, `SELECT c.id as "c.id", c.name as "c.name" FROM Orders`,
+		sql(sc.selectQuery(nil, nil, &[]*CustomerView{})), "aliased DTO is not composite")
+
+	join := `SELECT o.id as "o.id", o.customer_id as "o.customer_id", o.total as "o.total", ` +
+		`c.id as "c.id", c.name as "c.name" ` +
+		`FROM Orders AS o INNER JOIN Customers AS c ON c.id = o.customer_id`
+	assert.Equal(t, join+" WHERE o.id = $1",
+		sql(sc.selectQuery(nil, squirrel.Eq{idColumn(&OrderView{}): 1}, &OrderView{})))
+
+	sc = tenantScope{table: `"tenant_a".Orders`, schema: "tenant_a"}
+	assert.Equal(t, `SELECT c.name FROM "tenant_a".Orders AS o `+
+		`INNER JOIN "tenant_a".Customers AS c ON c.id = o.customer_id`,
+		sql(sc.selectQuery([]Column{"c.name"}, nil, &[]OrderView{})), "tables of parts are qualified by schema")
+
+	sc = tenantScope{table: "Orders", tenant: "a", column: "tenant_id", cond: squirrel.Eq{"tenant_id": "a"}}
+	assert.Equal(t, join+" WHERE (c.name = $1 AND o.tenant_id = $2)",
+		sql(sc.selectQuery(nil, squirrel.Eq{"c.name": "bob"}, &[]OrderView{})), "discriminator of first part")
+}
+
+func TestPaginationCount(t *testing.T) {
+	filter, err := ParseFilter(url.Values{"c.name": {"bob"}, "sort": {"o.total"}}, &OrderView{}, FilterOptions{})
+	assert.Nil(t, err)
+
+	query, args, err := tenantScope{table: "Orders"}.paginationCount(filter, &[]OrderView{}).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT count(1) FROM Orders AS o INNER JOIN Customers AS c ON c.id = o.customer_id "+
+		"WHERE (c.name = ?)", query, "count has the same joins as select")
+	assert.Equal(t, []interface{}{"bob"}, args)
+
+	query, _, err = tenantScope{table: "Orders"}.paginationCount(Filter{}, &[]Order{}).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT count(1) FROM Orders", query)
+}
+
+func TestSelectAliasedColumns(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Customers", "Orders"}, nil)
+
+	cid, err := repos.Repo("Customers").Create(ctx, &Customer{Name: "bob"})
+	assert.Nil(t, err)
+	id := cid.(int64)
+
+	var customer CustomerView
+	assert.Nil(t, repos.Repo("Customers").Get(ctx, id, &customer))
+	assert.Equal(t, Customer{ID: id, Name: "bob"}, customer.Customer)
+
+	var customers []*CustomerView
+	assert.Nil(t, repos.Repo("Customers").FindBy(ctx, nil, squirrel.Gt{"id": 0}, &customers))
+	if assert.Len(t, customers, 1) {
+		assert.Equal(t, "bob", customers[0].Name)
+	}
+
+	_, err = repos.Repo("Orders").Create(ctx, &Order{CustomerID: id, Total: 9.5})
+	assert.Nil(t, err)
+	_, err = repos.Repo("Orders").Insert(ctx, []Column{"customer_id", "total", "note"}, []Argument{id, 1.5, "gift"})
+	assert.Nil(t, err)
+
+	var orders []Order
+	assert.Nil(t, repos.Repo("Orders").FindBy(ctx, nil, nil, &orders))
+	if assert.Len(t, orders, 2) {
+		assert.Equal(t, 1.5, orders[1].Total)
+		assert.Empty(t, orders[1].Note, "only select columns by default")
+	}
+
+	// repotest has no joins, result of join is emulated by aliased columns of one table
+	var views []OrderView
+	assert.Nil(t, selectContext(ctx, db,
+		&views, `SELECT id as "o.id", customer_id as "o.customer_id", total as "o.total", note, `+
+			`customer_id as "c.id", note as "c.name" FROM Orders WHERE note = $1`, "gift"))
+	if assert.Len(t, views, 1) {
+		assert.Equal(t, Order{ID: orders[1].ID, CustomerID: id, Total: 1.5, Note: "gift"}, views[0].Order)
+		assert.Equal(t, Customer{ID: id, Name: "gift"}, views[0].Customer)
+	}
+
+	var view OrderView
+	assert.Nil(t, getContext(ctx, db, &view, `SELECT customer_id as "c.id", total as "o.total" FROM Orders`))
+	assert.Equal(t, id, view.Customer.ID)
+	assert.Equal(t, 9.5, view.Order.Total)
+
+	assert.NotNil(t, getContext(ctx, db, &view, `SELECT customer_id as "x.id" FROM Orders`), "missing destination")
+}
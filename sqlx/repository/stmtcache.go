@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	stderrors "errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// StmtCacheCapacityDefault - default count of prepared statements in StmtCache.
+const StmtCacheCapacityDefault = 256
+
+type (
+	// StmtCacheOptions - options of StmtCache.
+	StmtCacheOptions struct {
+		Capacity int // max count of prepared statements (LRU), 0 - StmtCacheCapacityDefault
+	}
+
+	// StmtCacheStats - statistics of StmtCache.
+	StmtCacheStats struct {
+		Hits          uint64 // query executed by cached statement
+		Misses        uint64 // statement prepared
+		Evictions     uint64 // statement closed by LRU
+		Invalidations uint64 // statement closed by connection or statement error
+		Size          int    // current count of statements
+	}
+
+	// QueryObserver - optional interface of connector wrapped by StmtCache (e.g. monitor.Monitor):
+	// queries executed by cached statements bypass query methods of connector, so they are reported by ObserveQuery.
+	QueryObserver interface {
+		ObserveQuery(ctx context.Context, start time.Time, err error)
+	}
+
+	// StmtCache - SqlxDBConnectorI which executes queries (outside of transactions) by prepared statements,
+	// cached by SQL text. Statements are prepared by PrepareContext of wrapped connector.
+	// Queries of statements are reported to wrapped connector if it implements QueryObserver,
+	// TxConn is delegated to wrapped connector if it implements TxConnector.
+	StmtCache struct {
+		SqlxDBConnectorI
+		mapper   *reflectx.Mapper
+		capacity int
+
+		mu    sync.Mutex
+		lru   *list.List // front - most recently used *stmtCacheItem
+		items map[Query]*list.Element
+
+		hits, misses, evictions, invalidations uint64
+	}
+
+	stmtCacheItem struct {
+		query Query
+		stmt  *sqlx.Stmt
+	}
+)
+
+// NewStmtCache wrap db by prepared statements cache.
+func NewStmtCache(db SqlxDBConnectorI, opts StmtCacheOptions) *StmtCache {
+	if opts.Capacity <= 0 {
+		opts.Capacity = StmtCacheCapacityDefault
+	}
+
+	mapper := reflectx.NewMapperFunc("db", sqlx.NameMapper)
+	if sqlxDB, ok := db.(*sqlx.DB); ok {
+		mapper = sqlxDB.Mapper
+	}
+
+	return &StmtCache{
+		SqlxDBConnectorI: db,
+		mapper:           mapper,
+		capacity:         opts.Capacity,
+		lru:              list.New(),
+		items:            map[Query]*list.Element{},
+	}
+}
+
+// WithStmtCache return copy of Repositories which use cache for queries.
+func (r Repositories) WithStmtCache(cache *StmtCache) Repositories {
+	mapRepo := make(Repositories, len(r))
+	for name, repo := range r {
+		cp := *repo
+		cp.db = cache
+		mapRepo[name] = &cp
+	}
+
+	return mapRepo
+}
+
+// Stats return statistics of cache.
+func (c *StmtCache) Stats() StmtCacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return StmtCacheStats{
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		Evictions:     atomic.LoadUint64(&c.evictions),
+		Invalidations: atomic.LoadUint64(&c.invalidations),
+		Size:          size,
+	}
+}
+
+// Close close all cached statements (wrapped connector is not closed).
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for _, el := range c.items {
+		if errC := el.Value.(*stmtCacheItem).stmt.Close(); errC != nil && err == nil {
+			err = errC
+		}
+	}
+
+	c.lru.Init()
+	c.items = map[Query]*list.Element{}
+
+	return err
+}
+
+// stmt return cached or new prepared statement of query.
+func (c *StmtCache) stmt(ctx context.Context, query Query) (*sqlx.Stmt, error) {
+	c.mu.Lock()
+	if el, found := c.items[query]; found {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+
+		return el.Value.(*stmtCacheItem).stmt, nil
+	}
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+
+	prepared, err := c.SqlxDBConnectorI.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &sqlx.Stmt{Stmt: prepared, Mapper: c.mapper}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, found := c.items[query]; found { // prepared concurrently
+		_ = prepared.Close()
+		return el.Value.(*stmtCacheItem).stmt, nil
+	}
+
+	c.items[query] = c.lru.PushFront(&stmtCacheItem{query: query, stmt: stmt})
+
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+
+	return stmt, nil
+}
+
+// TxConn return connection of tx of wrapped connector (see TxConnector).
+func (c *StmtCache) TxConn(tx *sqlx.Tx) sqlx.ExtContext {
+	if conn, ok := c.SqlxDBConnectorI.(TxConnector); ok {
+		return conn.TxConn(tx)
+	}
+
+	return tx
+}
+
+// observe report query executed by statement to wrapped connector (see QueryObserver).
+func (c *StmtCache) observe(ctx context.Context, start time.Time, err error) {
+	if o, ok := c.SqlxDBConnectorI.(QueryObserver); ok {
+		o.ObserveQuery(ctx, start, err)
+	}
+}
+
+// remove close statement and remove it from cache, must be called under mu.
+func (c *StmtCache) remove(el *list.Element) {
+	item := el.Value.(*stmtCacheItem)
+	_ = item.stmt.Close()
+
+	c.lru.Remove(el)
+	delete(c.items, item.query)
+}
+
+// invalidate remove statement of query if err is connection or statement error,
+// return true if query was not executed and can be retried without statement.
+func (c *StmtCache) invalidate(query Query, err error) (retry bool) {
+	retry = isStmtError(err)
+	if !retry && !isConnError(err) {
+		return false
+	}
+
+	c.mu.Lock()
+	if el, found := c.items[query]; found {
+		c.remove(el)
+		atomic.AddUint64(&c.invalidations, 1)
+	}
+	c.mu.Unlock()
+
+	return retry
+}
+
+// isStmtError - statement can't be used, query was not executed.
+func isStmtError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+
+	return strings.Contains(msg, "statement is closed") ||
+		strings.Contains(msg, "prepared statement") && strings.Contains(msg, "does not exist") ||
+		strings.Contains(msg, "cached plan must not change result type")
+}
+
+// isConnError - connection is broken, query could be executed.
+func isConnError(err error) bool {
+	var netErr net.Error
+
+	return stderrors.Is(err, driver.ErrBadConn) || stderrors.Is(err, sql.ErrConnDone) || stderrors.As(err, &netErr)
+}
+
+func (c *StmtCache) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := c.stmt(ctx, query)
+	if err != nil {
+		return c.SqlxDBConnectorI.ExecContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil && c.invalidate(query, err) {
+		return c.SqlxDBConnectorI.ExecContext(ctx, query, args...)
+	}
+
+	c.observe(ctx, start, err)
+
+	return res, err
+}
+
+func (c *StmtCache) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := c.stmt(ctx, query)
+	if err != nil {
+		return c.SqlxDBConnectorI.QueryContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil && c.invalidate(query, err) {
+		return c.SqlxDBConnectorI.QueryContext(ctx, query, args...)
+	}
+
+	c.observe(ctx, start, err)
+
+	return rows, err
+}
+
+func (c *StmtCache) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	stmt, err := c.stmt(ctx, query)
+	if err != nil {
+		return c.SqlxDBConnectorI.QueryxContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	rows, err := stmt.QueryxContext(ctx, args...)
+	if err != nil && c.invalidate(query, err) {
+		return c.SqlxDBConnectorI.QueryxContext(ctx, query, args...)
+	}
+
+	c.observe(ctx, start, err)
+
+	return rows, err
+}
+
+func (c *StmtCache) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	stmt, err := c.stmt(ctx, query)
+	if err != nil {
+		return c.SqlxDBConnectorI.QueryRowxContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	row := stmt.QueryRowxContext(ctx, args...)
+	if err = row.Err(); err != nil && c.invalidate(query, err) {
+		return c.SqlxDBConnectorI.QueryRowxContext(ctx, query, args...)
+	}
+
+	c.observe(ctx, start, row.Err())
+
+	return row
+}
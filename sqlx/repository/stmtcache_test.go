@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+func TestStmtCache(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Roles", repotest.Row{"name": "admin", "rights": 100}, repotest.Row{"name": "user", "rights": 10})
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	cache := NewStmtCache(db, StmtCacheOptions{Capacity: 2})
+	defer func() { _ = cache.Close() }()
+
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Roles"}, nil).WithStmtCache(cache).Repo("Roles")
+
+	var role Role
+	assert.Nil(t, repo.FindOneBy(ctx, []Column{"id", "name", "rights"}, squirrel.Eq{"name": "user"}, &role))
+	assert.Equal(t, 10, role.Rights)
+	assert.Nil(t, repo.FindOneBy(ctx, []Column{"id", "name", "rights"}, squirrel.Eq{"name": "admin"}, &role))
+	assert.Equal(t, 100, role.Rights)
+	assert.Equal(t, StmtCacheStats{Hits: 1, Misses: 1, Size: 1}, cache.Stats())
+
+	var roles []Role
+	assert.Nil(t, repo.FindBy(ctx, []Column{"id", "name", "rights"}, squirrel.Gt{"rights": 0}, &roles))
+	assert.Equal(t, 2, len(roles))
+
+	cnt, err := repo.Delete(ctx, role.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Evictions, "LRU capacity is 2")
+	assert.Equal(t, 2, stats.Size)
+
+	// closed statement is invalidated and query is retried without it
+	cache.mu.Lock()
+	for _, el := range cache.items {
+		_ = el.Value.(*stmtCacheItem).stmt.Close()
+	}
+	cache.mu.Unlock()
+
+	roles = nil
+	assert.Nil(t, repo.FindBy(ctx, []Column{"id", "name", "rights"}, squirrel.Gt{"rights": 0}, &roles))
+	assert.Equal(t, 1, len(roles))
+	assert.Equal(t, uint64(1), cache.Stats().Invalidations)
+	assert.Equal(t, 1, cache.Stats().Size)
+
+	assert.Nil(t, cache.Close())
+	assert.Equal(t, 0, cache.Stats().Size)
+}
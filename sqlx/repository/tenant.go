@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+)
+
+const (
+	TenantModeNone   TenantMode = iota // TenantModeNone - no tenant scoping (default)
+	TenantModeSchema                   // TenantModeSchema - schema per tenant, table names are qualified: "schema".table
+	TenantModeColumn                   // TenantModeColumn - discriminator column added to every WHERE and INSERT
+
+	TenantColumnDefault = "tenant_id" // TenantColumnDefault - default discriminator column
+)
+
+var (
+	// ErrTenantRequired - tenancy is enabled, but ctx has no tenant.
+	ErrTenantRequired = errors.New("repository: tenant is required, please use repository.WithTenant(ctx, tenant)")
+	// ErrBadTenant - tenant can't be used as schema name.
+	ErrBadTenant = errors.New("repository: bad tenant, allowed only latin letters, digits and '_'")
+	// ErrSchemaScopeUnsupported - method can't be scoped by search_path of tenant schema (TenantModeSchema).
+	ErrSchemaScopeUnsupported = errors.New("repository: method is not supported in TenantModeSchema")
+
+	tenantSchemaRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// sqlKeywords - keywords which can follow table name in FROM or JOIN instead of alias.
+	sqlKeywords = map[string]bool{
+		"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+		"NATURAL": true, "ON": true, "USING": true, "GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true,
+		"OFFSET": true, "UNION": true, "FOR": true, "WINDOW": true,
+	}
+)
+
+type (
+	// Tenant - id of tenant.
+	Tenant = string
+
+	// TenantMode - the way to separate data of tenants.
+	TenantMode int
+
+	// TenantOptions - options of multi-tenancy for Repositories.
+	TenantOptions struct {
+		Mode         TenantMode
+		Column       Column  // TenantModeColumn: discriminator column, default TenantColumnDefault
+		SchemaPrefix string  // TenantModeSchema: schema name is SchemaPrefix + tenant
+		SharedTables []Table // tables which are not scoped by tenant (e.g. reference tables)
+	}
+
+	tenantCtxKey struct{}
+
+	// tenantScope - tenant scoping of one repository call.
+	tenantScope struct {
+		table    Table           // table name for query (schema qualified for TenantModeSchema)
+		schema   string          // schema of tenant, empty if not used
+		column   Column          // discriminator column, empty if not used
+		tenant   Tenant          // current tenant
+		cond     Condition       // discriminator condition, nil if not used
+		patterns *tenantPatterns // patterns of discriminator column, nil if not used
+	}
+
+	// tenantPatterns - regexps of TenantModeColumn, they are compiled once per repository.
+	tenantPatterns struct {
+		tableRef *regexp.Regexp // table of repository in FROM or JOIN with optional alias
+		param    *regexp.Regexp // named parameter of discriminator column, e.g. ":tenant_id"
+	}
+)
+
+// WithTenant return ctx with tenant.
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext return tenant from ctx.
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	tenant, ok := ctx.Value(tenantCtxKey{}).(Tenant)
+	return tenant, ok && tenant != ""
+}
+
+// WithTenancy return copy of Repositories where each repository is scoped by tenant from ctx.
+// In TenantModeSchema queries built by caller (squirrel.SelectBuilder, joins) are executed in transaction
+// with search_path of tenant schema (GetRowsByQuery is not supported, rows are read after transaction),
+// in TenantModeColumn discriminator condition is added to them automatically.
+func (r Repositories) WithTenancy(opts TenantOptions) Repositories {
+	if opts.Mode == TenantModeColumn && opts.Column == "" {
+		opts.Column = TenantColumnDefault
+	}
+
+	shared := tableSet(opts.SharedTables)
+
+	mapRepo := make(Repositories, len(r))
+	for name, repo := range r {
+		cp := *repo
+		cp.tenancy = nil
+
+		cp.tenantRe = nil
+
+		if opts.Mode != TenantModeNone && !shared[name] {
+			o := opts
+			cp.tenancy = &o
+
+			if opts.Mode == TenantModeColumn {
+				cp.tenantRe = newTenantPatterns(name, opts.Column)
+			}
+		}
+
+		mapRepo[name] = &cp
+	}
+
+	return mapRepo
+}
+
+// TenantTable return table name for tenant from ctx according Repositories tenancy options.
+func (r Repositories) TenantTable(ctx context.Context, table Table) (Table, error) {
+	repo, found := r[table]
+	if !found {
+		return table, nil
+	}
+
+	sc, err := repo.scope(ctx)
+
+	return sc.table, err
+}
+
+// scope calc tenant scoping of repository call, return ErrTenantRequired if tenancy enabled and ctx has no tenant.
+func (r *repository) scope(ctx context.Context) (tenantScope, error) {
+	sc := tenantScope{table: r.name}
+
+	if r.tenancy == nil {
+		return sc, nil
+	}
+
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return sc, ErrTenantRequired
+	}
+
+	sc.tenant = tenant
+
+	switch r.tenancy.Mode {
+	case TenantModeSchema:
+		schema := r.tenancy.SchemaPrefix + tenant
+		if !tenantSchemaRe.MatchString(schema) {
+			return sc, ErrBadTenant
+		}
+		sc.schema = schema
+		sc.table = sc.qualify(r.name)
+
+	case TenantModeColumn:
+		sc.column = r.tenancy.Column
+		sc.cond = squirrel.Eq{sc.column: tenant}
+		sc.patterns = r.tenantRe
+	}
+
+	return sc, nil
+}
+
+func newTenantPatterns(table Table, column Column) *tenantPatterns {
+	return &tenantPatterns{
+		tableRef: regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+` + regexp.QuoteMeta(table) +
+			`\b(?:\s+(?:AS\s+)?([A-Za-z_][A-Za-z0-9_]*))?`),
+		param: regexp.MustCompile(`(^|[^:]):` + regexp.QuoteMeta(column) + `\b`),
+	}
+}
+
+// qualify return table name qualified by schema of tenant.
+func (sc tenantScope) qualify(table Table) Table {
+	if sc.schema == "" {
+		return table
+	}
+
+	return `"` + sc.schema + `".` + table
+}
+
+// where join condition with discriminator condition.
+func (sc tenantScope) where(cond Condition) Condition {
+	switch {
+	case sc.cond == nil:
+		return cond
+	case cond == nil:
+		return sc.cond
+	}
+
+	return squirrel.And{cond, sc.cond}
+}
+
+// whereAlias same as where, but discriminator column is qualified by alias of table (for joins).
+func (sc tenantScope) whereAlias(cond Condition, fromWithAlias string) Condition {
+	if sc.cond == nil {
+		return cond
+	}
+
+	fields := strings.Fields(fromWithAlias)
+	if len(fields) == 0 {
+		return sc.where(cond)
+	}
+
+	return tenantScope{cond: squirrel.Eq{fields[len(fields)-1] + "." + sc.column: sc.tenant}}.where(cond)
+}
+
+// insert add discriminator column to INSERT columns and values, value from ctx overwrite value from DTO.
+func (sc tenantScope) insert(columns []Column, values []Argument) ([]Column, []Argument) {
+	if sc.column == "" {
+		return columns, values
+	}
+
+	for i, col := range columns {
+		if col == sc.column && i < len(values) {
+			values = append([]Argument(nil), values...)
+			values[i] = sc.tenant
+
+			return columns, values
+		}
+	}
+
+	return append(append([]Column(nil), columns...), sc.column), append(append([]Argument(nil), values...), sc.tenant)
+}
+
+// set return SET map of UPDATE without discriminator column, so row can't be moved to other tenant.
+func (sc tenantScope) set(sm map[Column]Argument) map[Column]Argument {
+	if _, found := sm[sc.column]; sc.column == "" || !found {
+		return sm
+	}
+
+	cp := make(map[Column]Argument, len(sm))
+	for col, v := range sm {
+		if col != sc.column {
+			cp[col] = v
+		}
+	}
+
+	return cp
+}
+
+// selectBuilder add discriminator condition to caller select builder, discriminator column is qualified by alias
+// (or name) of table of repository in FROM or JOIN of qb.
+func (sc tenantScope) selectBuilder(qb squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if sc.cond == nil {
+		return qb
+	}
+
+	return qb.Where(squirrel.Eq{sc.tableRef(qb) + "." + sc.column: sc.tenant})
+}
+
+// tableRef return alias of table of repository in FROM or JOIN of qb, table name if it has no alias.
+func (sc tenantScope) tableRef(qb squirrel.SelectBuilder) string {
+	query, _, err := qb.ToSql()
+	if err != nil || sc.patterns == nil {
+		return sc.table
+	}
+
+	m := sc.patterns.tableRef.FindStringSubmatch(query)
+	if m == nil || m[1] == "" || sqlKeywords[strings.ToUpper(m[1])] {
+		return sc.table
+	}
+
+	return m[1]
+}
+
+func tableSet(tables []Table) map[Table]bool {
+	set := make(map[Table]bool, len(tables))
+	for _, t := range tables {
+		set[t] = true
+	}
+
+	return set
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type TenantPaginator struct {
+	BaseDTO
+	Name     string `db:"name"      orm_use_in:"select,create,update"`
+	TenantID string `db:"tenant_id" orm_use_in:"select"`
+
+	_ interface{} `orm_table_name:"Paginators"`
+}
+
+var tenantTimestamps = repotest.Defaults{"created_at": repotest.Now, "updated_at": repotest.Now}
+
+func TestTenancy_Column(t *testing.T) {
+	db := repotest.New(repotest.Table{Name: "Paginators", Defaults: tenantTimestamps})
+	defer func() { _ = db.Close() }()
+
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators", "Roles"}, nil).
+		WithTenancy(TenantOptions{Mode: TenantModeColumn, SharedTables: []Table{"Roles"}})
+
+	ctxA := WithTenant(context.Background(), "a")
+	ctxB := WithTenant(context.Background(), "b")
+
+	repo := repos.Repo("Paginators")
+
+	_, err := repo.Create(context.Background(), &TenantPaginator{Name: "no tenant"})
+	assert.Equal(t, ErrTenantRequired, errors.Cause(err))
+
+	idA, err := repo.Create(ctxA, &TenantPaginator{Name: "first"})
+	assert.Nil(t, err)
+	_, err = repo.Insert(ctxB, []Column{"name", TenantColumnDefault}, []Argument{"second", "a"})
+	assert.Nil(t, err)
+
+	rows := db.Rows("Paginators")
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, "a", rows[0][TenantColumnDefault])
+	assert.Equal(t, "b", rows[1][TenantColumnDefault], "tenant from ctx overwrite value")
+
+	var p TenantPaginator
+	assert.Nil(t, repo.Get(ctxA, idA, &p))
+	assert.Equal(t, "first", p.Name)
+	assert.NotNil(t, repo.Get(ctxB, idA, &p))
+
+	cnt, err := repo.Update(ctxB, idA, &TenantPaginator{Name: "hacked"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+
+	cnt, err = repo.UpdateCustom(ctxA, map[string]interface{}{"name": "updated"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	cnt, err = repo.UpdateCustom(ctxA, map[string]interface{}{"name": "updated", TenantColumnDefault: "b"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	assert.Equal(t, "a", db.Rows("Paginators")[0][TenantColumnDefault], "row is not moved to other tenant")
+
+	var ps []TenantPaginator
+	assert.Nil(t, repo.FindBy(ctxB, []Column{"*"}, squirrel.NotEq{"name": ""}, &ps))
+	assert.Equal(t, 1, len(ps))
+	assert.Equal(t, "second", ps[0].Name)
+
+	ps = ps[:0]
+	assert.Nil(t, repo.FindByExample(ctxA, &TenantPaginator{}, ExampleOptions{}, &ps))
+	assert.Equal(t, 1, len(ps))
+	assert.Equal(t, "updated", ps[0].Name)
+
+	total, err := repo.CountByQuery(ctxA, squirrel.Select("count(1)").From("Paginators"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), total)
+
+	_, err = repo.CountByQuery(context.Background(), squirrel.Select("count(1)").From("Paginators"))
+	assert.Equal(t, ErrTenantRequired, errors.Cause(err))
+
+	ps = ps[:0]
+	pr, err := repo.SelectWithPagePagination(ctxB, squirrel.Select("*").From("Paginators"),
+		PagePaginationParams{PageNumber: 1, PageSize: 10}, &ps)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), pr.CntPages)
+	assert.Equal(t, 1, len(ps))
+
+	cnt, err = repo.Delete(ctxB, idA)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+
+	// shared table is not scoped
+	_, err = repos.Repo("Roles").Insert(context.Background(), []Column{"name"}, []Argument{"admin"})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Rows("Roles")[0][TenantColumnDefault])
+
+	// original Repositories are not changed
+	_, err = NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators"}, nil).Repo("Paginators").
+		Create(context.Background(), &TenantPaginator{Name: "without tenancy"})
+	assert.Nil(t, err)
+}
+
+func TestTenancy_Schema(t *testing.T) {
+	db := repotest.New(
+		repotest.Table{Name: "tenant_a.Paginators", Defaults: tenantTimestamps},
+		repotest.Table{Name: "tenant_b.Paginators", Defaults: tenantTimestamps},
+	)
+	defer func() { _ = db.Close() }()
+
+	repos := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Paginators"}, nil).
+		WithTenancy(TenantOptions{Mode: TenantModeSchema, SchemaPrefix: "tenant_"})
+
+	ctxA := WithTenant(context.Background(), "a")
+	ctxB := WithTenant(context.Background(), "b")
+
+	table, err := repos.TenantTable(ctxA, "Paginators")
+	assert.Nil(t, err)
+	assert.Equal(t, `"tenant_a".Paginators`, table)
+
+	_, err = repos.TenantTable(WithTenant(context.Background(), "a; DROP TABLE users"), "Paginators")
+	assert.Equal(t, ErrBadTenant, errors.Cause(err))
+
+	_, err = repos.TenantTable(context.Background(), "Paginators")
+	assert.Equal(t, ErrTenantRequired, errors.Cause(err))
+
+	table, err = repos.TenantTable(context.Background(), "Unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, "Unknown", table)
+
+	repo := repos.Repo("Paginators")
+
+	id, err := repo.Create(ctxA, &Paginator{Name: "a"})
+	assert.Nil(t, err)
+	_, err = repo.Create(ctxB, &Paginator{Name: "b"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(db.Rows("tenant_a.Paginators")))
+	assert.Equal(t, 1, len(db.Rows("tenant_b.Paginators")))
+	assert.Equal(t, 0, len(db.Rows("Paginators")))
+
+	var p Paginator
+	assert.Nil(t, repo.Get(ctxB, id, &p))
+	assert.Equal(t, "b", p.Name)
+
+	_, err = repo.Delete(context.Background(), id)
+	assert.Equal(t, ErrTenantRequired, errors.Cause(err))
+
+	// queries of caller are not executed against unqualified tables
+	_, err = repo.GetRowsByQuery(ctxA, squirrel.Select("*").From("Paginators"))
+	assert.Equal(t, ErrSchemaScopeUnsupported, errors.Cause(err))
+
+	_, err = repo.CountByQuery(ctxA, squirrel.Select("count(1)").From("Paginators"))
+	assert.NotNil(t, err, "search_path is set by set_config, it is not supported by repotest")
+}
+
+func TestTenancy_SelectBuilder(t *testing.T) {
+	sc := tenantScope{table: "Paginators", column: TenantColumnDefault, tenant: "a"}
+	sc.cond = squirrel.Eq{sc.column: sc.tenant}
+	sc.patterns = newTenantPatterns(sc.table, sc.column)
+
+	for _, tc := range []struct {
+		qb       squirrel.SelectBuilder
+		expected string
+	}{
+		{
+			qb:       squirrel.Select("*").From("Paginators"),
+			expected: "SELECT * FROM Paginators WHERE Paginators.tenant_id = ?",
+		},
+		{
+			qb:       squirrel.Select("*").From("Paginators").Where("id > 1"),
+			expected: "SELECT * FROM Paginators WHERE id > 1 AND Paginators.tenant_id = ?",
+		},
+		{
+			qb:       squirrel.Select("p.name").From("Paginators AS p").Join("Roles r ON r.id = p.id"),
+			expected: "SELECT p.name FROM Paginators AS p JOIN Roles r ON r.id = p.id WHERE p.tenant_id = ?",
+		},
+		{
+			qb:       squirrel.Select("p.name").From("Roles r").Join("Paginators p ON r.id = p.id"),
+			expected: "SELECT p.name FROM Roles r JOIN Paginators p ON r.id = p.id WHERE p.tenant_id = ?",
+		},
+	} {
+		query, args, err := sc.selectBuilder(tc.qb).ToSql()
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, query)
+		assert.Equal(t, []interface{}{"a"}, args)
+	}
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/imperiuse/golib/sqlx/helper"
+)
+
+// sqlStateQueryCanceled - Postgres: canceling statement due to statement timeout (or user request).
+const sqlStateQueryCanceled = "57014"
+
+// ErrTimeout - query was not completed in default timeout of operation (see TimeoutError).
+var ErrTimeout = errors.New("repository: query timeout")
+
+type (
+	// TimeoutOptions - default timeouts of operations, they are applied only if ctx of call has no deadline.
+	// Zero timeout - operation is not bounded.
+	TimeoutOptions struct {
+		Read       time.Duration
+		Write      time.Duration
+		Pagination time.Duration
+
+		// StatementTimeout - propagate deadline of ctx to Postgres by SET LOCAL statement_timeout
+		// in transactions of repository (Create, audited writes, batched CopyFrom),
+		// so server stops the statement even if client is gone. Single statements are canceled by driver.
+		StatementTimeout bool
+	}
+
+	// TimeoutError - error of operation interrupted by default timeout.
+	// errors.Cause(err) == ErrTimeout, errors.Is(err, context.DeadlineExceeded) is true.
+	TimeoutError struct {
+		Repo    Repo
+		Op      Operation
+		Timeout time.Duration
+		Err     error
+	}
+)
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: repo %s, op %s, timeout %s: %v", ErrTimeout, e.Repo, e.Op, e.Timeout, e.Err)
+}
+
+// Cause - for errors.Cause of github.com/pkg/errors.
+func (e *TimeoutError) Cause() error {
+	return ErrTimeout
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout || target == context.DeadlineExceeded
+}
+
+// WithTimeouts return copy of Repositories with default timeouts of operations.
+func (r Repositories) WithTimeouts(opts TimeoutOptions) Repositories {
+	mapRepo := make(Repositories, len(r))
+	for name, repo := range r {
+		cp := *repo
+		cp.timeouts = &opts
+		mapRepo[name] = &cp
+	}
+
+	return mapRepo
+}
+
+func (o *TimeoutOptions) timeout(op Operation) time.Duration {
+	switch op {
+	case OpRead:
+		return o.Read
+	case OpWrite:
+		return o.Write
+	case OpPagination:
+		return o.Pagination
+	}
+
+	return 0
+}
+
+// operation return ctx of repository operation: it is marked by OperationInfo (if it is not nested operation)
+// and bounded by default timeout of op (if ctx has no deadline).
+// Returned func must be called (deferred) with error of operation:
+// it releases ctx and converts timeout error to TimeoutError.
+func (r *repository) operation(ctx context.Context, op Operation) (context.Context, func(err error) error) {
+	if _, nested := OperationFromContext(ctx); !nested {
+		ctx = WithOperation(ctx, OperationInfo{Repo: r.name, Op: op})
+	}
+
+	if r.timeouts == nil {
+		return ctx, func(err error) error { return err }
+	}
+
+	timeout := r.timeouts.timeout(op)
+	if _, hasDeadline := ctx.Deadline(); hasDeadline || timeout <= 0 {
+		return ctx, func(err error) error { return err }
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	return ctx, func(err error) error {
+		defer cancel()
+
+		if err == nil || !(ctx.Err() == context.DeadlineExceeded || isStatementTimeout(err)) {
+			return err
+		}
+
+		return &TimeoutError{Repo: r.name, Op: op, Timeout: timeout, Err: err}
+	}
+}
+
+// isStatementTimeout - Postgres canceled statement (pgconn.PgError and pq.Error implement SQLState).
+func isStatementTimeout(err error) bool {
+	for err != nil {
+		if e, ok := err.(interface{ SQLState() string }); ok {
+			return e.SQLState() == sqlStateQueryCanceled
+		}
+
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// withTransaction execute fns in transaction, statement_timeout is set by deadline of ctx if it is enabled.
+// If ctx already has transaction (see TxFromContext), fns are executed in it.
+func (r *repository) withTransaction(ctx context.Context, fns ...helper.TxFn) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		for _, fn := range fns {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if timeout, ok := r.statementTimeout(ctx); ok {
+		fns = append([]helper.TxFn{helper.StatementTimeout(ctx, timeout)}, fns...)
+	}
+
+	return helper.WithTransaction(ctx, nil, r.db, fns...)
+}
+
+// statementTimeout return statement_timeout of transactions by deadline of ctx, false if it is not enabled.
+func (r *repository) statementTimeout(ctx context.Context) (time.Duration, bool) {
+	if r.timeouts == nil || !r.timeouts.StatementTimeout || !isPostgres(r.db.DriverName()) {
+		return 0, false
+	}
+
+	deadline, ok := ctx.Deadline()
+
+	return time.Until(deadline), ok
+}
+
+func isPostgres(driverName string) bool {
+	switch driverName {
+	case "postgres", "pgx", "pgx/v4", "cloudsqlpostgres":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+// slowDB - connector whose queries wait until ctx is done.
+type slowDB struct {
+	SqlxDBConnectorI
+}
+
+func (db slowDB) QueryxContext(ctx context.Context, _ string, _ ...interface{}) (*sqlx.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type sqlStateErr string
+
+func (e sqlStateErr) Error() string    { return "pq: canceling statement due to statement timeout" }
+func (e sqlStateErr) SQLState() string { return string(e) }
+
+func TestTimeouts(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	_, err := db.Insert("Roles", repotest.Row{"name": "admin", "rights": 100})
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	opts := TimeoutOptions{Read: 20 * time.Millisecond}
+
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Roles"}, nil).WithTimeouts(opts).Repo("Roles")
+
+	var roles []Role
+	assert.Nil(t, repo.FindBy(ctx, []Column{"id", "name", "rights"}, squirrel.Gt{"rights": 0}, &roles))
+	assert.Equal(t, 1, len(roles))
+
+	slow := NewSqlxMapRepo(zap.NewNop(), slowDB{db}, []Table{"Roles"}, nil).WithTimeouts(opts).Repo("Roles")
+
+	err = slow.FindBy(ctx, []Column{"id", "name", "rights"}, squirrel.Gt{"rights": 0}, &roles)
+	assert.Equal(t, ErrTimeout, errors.Cause(err))
+	assert.True(t, stderrors.Is(err, context.DeadlineExceeded))
+
+	var timeoutErr *TimeoutError
+	assert.True(t, stderrors.As(err, &timeoutErr))
+	assert.Equal(t, OpRead, timeoutErr.Op)
+	assert.Equal(t, "Roles", timeoutErr.Repo)
+	assert.Equal(t, opts.Read, timeoutErr.Timeout)
+
+	// deadline of caller has priority, its error is not converted
+	callerCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	err = slow.FindBy(callerCtx, []Column{"id"}, squirrel.Gt{"rights": 0}, &roles)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrTimeout, errors.Cause(err))
+
+	assert.True(t, isStatementTimeout(errors.Wrap(sqlStateErr(sqlStateQueryCanceled), "wrapped")))
+	assert.False(t, isStatementTimeout(errors.Wrap(sqlStateErr("23505"), "wrapped")))
+	assert.False(t, isStatementTimeout(context.Canceled))
+}
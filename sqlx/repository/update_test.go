@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type Profile struct {
+	orm.Tracking
+
+	ID    int64  `db:"id"     orm_use_in:"select"`
+	Name  string `db:"name"   orm_use_in:"select,create,update"`
+	Email string `db:"email"  orm_use_in:"select,create,update"`
+	Age   int    `db:"age"    orm_use_in:"select,create,update"`
+}
+
+func (p *Profile) Identity() ID {
+	return p.ID
+}
+
+func TestUpdateFields(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Profiles"}, nil).Repo("Profiles")
+
+	id, err := repo.Create(ctx, &Profile{Name: "bob", Email: "bob@example.com", Age: 30})
+	assert.Nil(t, err)
+
+	ra, err := repo.UpdateFields(ctx, id, &Profile{Email: "new@example.com"}, "Email", "age")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ra)
+
+	var profile Profile
+	assert.Nil(t, repo.Get(ctx, id, &profile))
+	assert.Equal(t, Profile{ID: profile.ID, Name: "bob", Email: "new@example.com", Age: 0}, profile,
+		"name is not sent, zero age of mask is updated")
+
+	_, err = repo.UpdateFields(ctx, id, &profile, "ID")
+	assert.True(t, stderrors.Is(errors.Cause(err), orm.ErrNotUpdatable))
+
+	_, err = repo.UpdateFields(ctx, id, &profile)
+	assert.Equal(t, orm.ErrEmptyMask, errors.Cause(err))
+}
+
+func TestSave(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Profiles"}, nil).Repo("Profiles")
+
+	id, err := repo.Create(ctx, &Profile{Name: "bob", Email: "bob@example.com", Age: 30})
+	assert.Nil(t, err)
+
+	var profile Profile
+	assert.Nil(t, repo.Get(ctx, id, &profile))
+
+	_, err = repo.Save(ctx, &profile)
+	assert.Equal(t, orm.ErrNotTracked, errors.Cause(err))
+
+	assert.Nil(t, orm.Track(&profile))
+
+	ra, err := repo.Save(ctx, &profile)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ra, "nothing is changed")
+
+	_, err = db.ExecContext(ctx, "UPDATE Profiles SET name = $1", "alice") // concurrent change of other column
+	assert.Nil(t, err)
+	profile.Age = 31
+
+	ra, err = repo.Save(ctx, &profile)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ra)
+	assert.Equal(t, "alice", db.Rows("Profiles")[0]["name"], "not changed column is not overwritten")
+	assert.EqualValues(t, 31, db.Rows("Profiles")[0]["age"])
+
+	changes, err := orm.Changes(&profile)
+	assert.Nil(t, err)
+	assert.Empty(t, changes, "saved DTO is tracked again")
+
+	errRollback := errors.New("rollback")
+	r := repo.(*repository)
+
+	profile.Age = 32
+	err = r.inTransaction(ctx, func(ctx context.Context, _ *sqlx.Tx) error {
+		if _, err := r.Save(ctx, &profile); err != nil {
+			return err
+		}
+
+		changes, err := orm.Changes(&profile)
+		assert.Nil(t, err)
+		assert.Len(t, changes, 1, "snapshot is not refreshed before commit")
+
+		return errRollback
+	})
+	assert.Equal(t, errRollback, errors.Cause(err))
+	assert.EqualValues(t, 31, db.Rows("Profiles")[0]["age"])
+
+	changes, err = orm.Changes(&profile)
+	assert.Nil(t, err)
+	assert.Len(t, changes, 1, "rolled back changes are not saved")
+
+	assert.Nil(t, r.inTransaction(ctx, func(ctx context.Context, _ *sqlx.Tx) error {
+		_, err := r.Save(ctx, &profile)
+		return err
+	}))
+	assert.EqualValues(t, 32, db.Rows("Profiles")[0]["age"])
+
+	changes, err = orm.Changes(&profile)
+	assert.Nil(t, err)
+	assert.Empty(t, changes, "snapshot is refreshed after commit")
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/imperiuse/golib/reflect/orm"
+	"github.com/imperiuse/golib/sqlx/repository/repotest"
+)
+
+type Subscriber struct {
+	orm.Tracking
+
+	ID    int64  `db:"id"     orm_use_in:"select"`
+	Email string `db:"email"  orm_use_in:"select,create,update" orm_validate:"required,email"`
+	Plan  string `db:"plan"   orm_use_in:"select,create,update" orm_validate:"oneof=free pro"`
+}
+
+func (s *Subscriber) Identity() ID {
+	return s.ID
+}
+
+func TestValidation(t *testing.T) {
+	db := repotest.New()
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+	repo := NewSqlxMapRepo(zap.NewNop(), db, []Table{"Subscribers"}, nil).Repo("Subscribers")
+
+	_, err := repo.Create(ctx, &Subscriber{Email: "bob", Plan: "vip"})
+	assert.Equal(t, orm.ValidationErrors{
+		{Field: "Email", Column: "email", Rule: "email"},
+		{Field: "Plan", Column: "plan", Rule: "oneof", Param: "free pro"},
+	}, errors.Cause(err))
+	assert.Len(t, db.Rows("Subscribers"), 0)
+
+	subscriber := &Subscriber{Email: "bob@example.com", Plan: "free"}
+	id, err := repo.Create(ctx, subscriber)
+	assert.Nil(t, err)
+	subscriber.ID = id.(int64)
+
+	_, err = repo.Update(ctx, id, &Subscriber{Plan: "pro"})
+	assert.Equal(t, orm.ValidationErrors{{Field: "Email", Column: "email", Rule: "required"}}, errors.Cause(err))
+
+	ra, err := repo.UpdateFields(ctx, id, &Subscriber{Plan: "pro"}, "Plan")
+	assert.Nil(t, err, "only fields of mask are validated")
+	assert.Equal(t, int64(1), ra)
+
+	subscriber.Plan = "pro"
+	assert.Nil(t, orm.Track(subscriber))
+	subscriber.Email = "bob"
+	_, err = repo.Save(ctx, subscriber)
+	assert.Equal(t, orm.ValidationErrors{{Field: "Email", Column: "email", Rule: "email"}}, errors.Cause(err))
+	assert.Equal(t, "bob@example.com", db.Rows("Subscribers")[0]["email"])
+	assert.Equal(t, "pro", db.Rows("Subscribers")[0]["plan"])
+}